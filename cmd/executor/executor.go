@@ -1,14 +1,30 @@
 package main
 
 import (
-	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"os"
 
 	"github.com/grussorusso/serverledge/internal/executor"
 )
 
 func main() {
 	http.HandleFunc("/invoke", executor.InvokeHandler)
-	log.Fatal(http.ListenAndServe(fmt.Sprintf(":%d", executor.DEFAULT_EXECUTOR_PORT), nil))
+	http.HandleFunc(executor.READINESS_PATH, executor.ReadyHandler)
+
+	// the node may reach the executor through a Unix domain socket
+	if socketPath, ok := os.LookupEnv(executor.ENV_SOCKET); ok {
+		_ = os.Remove(socketPath)
+		listener, err := net.Listen("unix", socketPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		// the node accesses the socket through the group of the directory
+		_ = os.Chmod(socketPath, 0660)
+		go func() {
+			log.Fatal(http.Serve(listener, nil))
+		}()
+	}
+	log.Fatal(http.ListenAndServe(executor.ListenAddress(), nil))
 }
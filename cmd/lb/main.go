@@ -18,7 +18,7 @@ import (
 )
 
 func registerTerminationHandler(e *echo.Echo) {
-	c := make(chan os.Signal)
+	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt)
 
 	go func() {
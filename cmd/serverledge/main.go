@@ -28,13 +28,17 @@ func startAPIServer(e *echo.Echo) {
 	e.Use(middleware.Recover())
 
 	// Routes
-	e.POST("/invoke/:fun", api.InvokeFunction)
+	e.POST("/invoke/:fun", api.InvokeFunction, api.RateLimit)
+	e.POST("/offload/:fun", api.InvokeOffloadedFunction, api.PeersOnly, api.RateLimit)
 	e.POST("/prewarm", api.PrewarmFunction)
 	e.POST("/create", api.CreateFunction)
 	e.POST("/delete", api.DeleteFunction)
 	e.GET("/function", api.GetFunctions)
 	e.GET("/poll/:reqId", api.PollAsyncResult)
 	e.GET("/status", api.GetServerStatus)
+	e.GET("/autoscaler", api.GetAutoscalerStatus)
+	e.GET("/keepalive", api.GetKeepAliveStatus)
+	e.GET("/containers", api.GetContainers)
 
 	// Start server
 	portNumber := config.GetInt(config.API_PORT, 1323)
@@ -66,7 +70,7 @@ func cacheSetup() {
 }
 
 func registerTerminationHandler(r *registration.Registry, e *echo.Echo) {
-	c := make(chan os.Signal)
+	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt)
 
 	go func() {
@@ -127,14 +131,14 @@ func main() {
 	}
 	node.NodeIdentifier = myKey
 
-	go metrics.Init()
+	go metrics.Init(node.NodeIdentifier)
 
 	e := echo.New()
 
 	// Register a signal handler to cleanup things on termination
 	registerTerminationHandler(registry, e)
 
-	schedulingPolicy := createSchedulingPolicy()
+	schedulingPolicy := scheduling.NewConfiguredPolicy()
 	go scheduling.Run(schedulingPolicy)
 
 	if !isInCloud {
@@ -147,17 +151,3 @@ func main() {
 	startAPIServer(e)
 
 }
-
-func createSchedulingPolicy() scheduling.Policy {
-	policyConf := config.GetString(config.SCHEDULING_POLICY, "default")
-	log.Printf("Configured policy: %s\n", policyConf)
-	if policyConf == "cloudonly" {
-		return &scheduling.CloudOnlyPolicy{}
-	} else if policyConf == "edgecloud" {
-		return &scheduling.CloudEdgePolicy{}
-	} else if policyConf == "edgeonly" {
-		return &scheduling.EdgePolicy{}
-	} else {
-		return &scheduling.DefaultLocalPolicy{}
-	}
-}
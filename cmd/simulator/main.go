@@ -0,0 +1,51 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/grussorusso/serverledge/internal/config"
+	"github.com/grussorusso/serverledge/internal/simulation"
+)
+
+func main() {
+	configFileName := flag.String("config", "", "configuration file of the node")
+	scenarioFileName := flag.String("scenario", "", "scenario to simulate (JSON)")
+	recordsFileName := flag.String("records", "", "file where the records of the requests are written (JSON lines)")
+	quiet := flag.Bool("quiet", false, "disable the logs of the node")
+	flag.Parse()
+
+	if *scenarioFileName == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	config.ReadConfiguration(*configFileName)
+
+	scenario, err := simulation.ReadScenario(*scenarioFileName)
+	if err != nil {
+		log.Fatalf("Invalid scenario: %v", err)
+	}
+
+	var records io.Writer
+	if *recordsFileName != "" {
+		f, err := os.Create(*recordsFileName)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		records = f
+	}
+
+	if *quiet {
+		log.SetOutput(io.Discard)
+	}
+	summary, err := simulation.Run(scenario, records)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Simulation failed: %v\n", err)
+		os.Exit(1)
+	}
+	_ = summary.Write(os.Stdout)
+}
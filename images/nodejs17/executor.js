@@ -2,22 +2,48 @@ const path = require('path');
 const http = require('http');
 const { Worker } = require('worker_threads');
 
-// Funzione per eseguire l'elaborazione in un Worker
-function runWorker(data) {
+class TimeoutError extends Error {}
+
+// Funzione per eseguire l'elaborazione in un Worker.
+// Il Worker viene terminato allo scadere del timeout (in secondi, 0 = nessun
+// timeout) o se il nodo chiude la connessione.
+function runWorker(data, timeout, request) {
     return new Promise((resolve, reject) => {
-        const worker = new Worker('./worker.js', { workerData: data }); // Invia i dati al Worker
+        const worker = new Worker(path.join(__dirname, 'worker.js'), { workerData: data }); // Invia i dati al Worker
+
+        let timer = null;
+        if (timeout > 0) {
+            timer = setTimeout(() => {
+                reject(new TimeoutError(`Timeout di ${timeout}s scaduto`));
+                worker.terminate();
+            }, timeout * 1000);
+        }
+        const onClose = () => {
+            reject(new Error('Connessione chiusa dal nodo'));
+            worker.terminate();
+        };
+        request.socket.once('close', onClose);
+        const cleanup = () => {
+            clearTimeout(timer);
+            request.socket.removeListener('close', onClose);
+        };
 
-        worker.on('message', resolve); // Quando il Worker termina con successo
-        worker.on('error', reject);   // Gestione errori dal Worker
+        worker.on('message', (msg) => { cleanup(); resolve(msg); }); // Quando il Worker termina con successo
+        worker.on('error', (err) => { cleanup(); reject(err); });   // Gestione errori dal Worker
         worker.on('exit', (code) => {
+            cleanup();
             if (code !== 0) reject(new Error(`Worker terminato con codice ${code}`));
         });
     });
 }
 
 // Server HTTP
-http.createServer(async (request, response) => {
-    if (request.method !== 'POST') {
+const server = http.createServer(async (request, response) => {
+    if (request.method === 'GET' && request.url === '/ready') {
+        // endpoint di readiness: l'executor e' pronto appena risponde
+        response.writeHead(200);
+        response.end();
+    } else if (request.method !== 'POST') {
         response.writeHead(404);
         response.end('Invalid request method');
     } else {
@@ -36,14 +62,15 @@ http.createServer(async (request, response) => {
             // Prepara i dati da inviare al Worker
             const workerData = {
                 handler: reqbody["Handler"],
-                handler_dir: reqbody["HandlerDir"],
+                // la directory del codice puo' essere imposta dall'ambiente
+                handler_dir: process.env.EXECUTOR_HANDLER_DIR || reqbody["HandlerDir"],
                 params: reqbody["Params"],
                 context: process.env.CONTEXT !== "undefined" ? process.env.CONTEXT : {},
                 return_output: reqbody["ReturnOutput"]
             };
 
             // Esegui il Worker per l'elaborazione
-            const result = await runWorker(workerData);
+            const result = await runWorker(workerData, reqbody["Timeout"] || 0, request);
 
             response.writeHead(200, { 'Content-Type': contentType });
             response.end(JSON.stringify(result), 'utf-8');
@@ -53,13 +80,29 @@ http.createServer(async (request, response) => {
                 Output: "Output capture not supported for this runtime yet.",
                 Error: error.message
             };
-            response.writeHead(500, { 'Content-Type': contentType });
+            // 504 segnala al nodo che l'invocazione e' scaduta
+            response.writeHead(error instanceof TimeoutError ? 504 : 500, { 'Content-Type': contentType });
             response.end(JSON.stringify(resp), 'utf-8');
         }
     }
-}).listen(8080);
+});
+const port = parseInt(process.env.EXECUTOR_PORT || '8080');
+if (process.env.EXECUTOR_HOST) {
+    server.listen(port, process.env.EXECUTOR_HOST);
+} else {
+    server.listen(port);
+}
+
+console.log(`Server in ascolto sulla porta ${port}`);
 
-console.log('Server in ascolto sulla porta 8080');
+// il nodo puo' raggiungere l'executor tramite Unix domain socket
+const socketPath = process.env.EXECUTOR_SOCKET;
+if (socketPath) {
+    const fs = require('fs');
+    if (fs.existsSync(socketPath)) fs.unlinkSync(socketPath);
+    const unixServer = http.createServer(server.listeners('request')[0]);
+    unixServer.listen(socketPath, () => fs.chmodSync(socketPath, 0o660));
+}
 
 
 
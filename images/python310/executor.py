@@ -4,19 +4,32 @@ import sys
 import socket
 import json
 import importlib
+import multiprocessing
 from io import StringIO
-from socketserver import ThreadingMixIn
+import threading
+from socketserver import ThreadingMixIn, ThreadingUnixStreamServer
 from http.server import BaseHTTPRequestHandler, HTTPServer
 
 HOST = socket.gethostname()
 # Variabile globale per tracciare le directory aggiunte
 added_dirs = {}
 
+# gli handler sono eseguiti in processi figli, che possono essere terminati
+# allo scadere del timeout
+mp_context = multiprocessing.get_context("fork")
+
 
 # Classe server concorrente
 class ThreadingSimpleServer(ThreadingMixIn, HTTPServer):
     pass
 
+# Server concorrente su Unix domain socket
+class ThreadingUnixHTTPServer(ThreadingUnixStreamServer):
+    def server_bind(self):
+        ThreadingUnixStreamServer.server_bind(self)
+        self.server_name = "executor"
+        self.server_port = 0
+
 class CaptureOutput:
     def __enter__(self):
         self._stdout_output = ''
@@ -39,7 +52,40 @@ class CaptureOutput:
     def get_stderr(self):
         return self._stderr_output
 
+def run_handler(conn, module, func_name, params, context, return_output):
+    """Runs the handler in a child process, sending the response on conn."""
+    response = {}
+    try:
+        loaded_mod = importlib.import_module(module)
+        if not return_output:
+            result = getattr(loaded_mod, func_name)(params, context)
+            response["Output"] = ""
+        else:
+            with CaptureOutput() as capturer:
+                result = getattr(loaded_mod, func_name)(params, context)
+            response["Output"] = str(capturer.get_stdout()) + "\n" + str(capturer.get_stderr())
+
+        response["Result"] = json.dumps(result)
+        response["Success"] = True
+    except Exception as e:
+        print(e, file=sys.stderr)
+        response["Success"] = False
+    conn.send(response)
+    conn.close()
+
 class Executor(BaseHTTPRequestHandler):
+    def do_GET(self):
+        # readiness endpoint: the executor is ready once it serves requests
+        if self.path == "/ready":
+            self.send_response(200)
+        else:
+            self.send_response(404)
+        self.end_headers()
+
+    def address_string(self):
+        # client_address is empty for Unix domain sockets
+        return self.client_address[0] if self.client_address else "unix"
+
     def do_POST(self):
         content_length = int(self.headers['Content-Length']) 
         post_data = self.rfile.read(content_length) 
@@ -51,7 +97,8 @@ class Executor(BaseHTTPRequestHandler):
             return
 
         handler = request["Handler"] 
-        handler_dir = request["HandlerDir"]
+        # la directory del codice puo' essere imposta dall'ambiente
+        handler_dir = os.environ.get("EXECUTOR_HANDLER_DIR", request["HandlerDir"])
 
         try:
             params = request["Params"]
@@ -70,30 +117,43 @@ class Executor(BaseHTTPRequestHandler):
         # Get module name
         module, func_name = os.path.splitext(handler)
         func_name = func_name[1:] # strip initial dot
-        loaded_mod = None
 
-        return_output = bool(request["ReturnOutput"])
+        # the module is imported once by the executor, so that the handler
+        # processes inherit it instead of importing it at every invocation
+        try:
+            importlib.import_module(module)
+        except Exception:
+            pass # the error is reported by the handler process
 
-        response = {}
+        return_output = bool(request["ReturnOutput"])
+        timeout = float(request.get("Timeout") or 0)
+
+        # the handler process is killed if the invocation times out
+        # (0 = no timeout)
+        receiver, sender = mp_context.Pipe(duplex=False)
+        process = mp_context.Process(target=run_handler,
+                args=(sender, module, func_name, params, context, return_output))
+        process.start()
+        sender.close()
+
+        if not receiver.poll(timeout if timeout > 0 else None):
+            process.kill()
+            process.join()
+            receiver.close()
+            # 504 segnala al nodo che l'invocazione e' scaduta
+            self.send_response(504)
+            self.send_header("Content-type", "application/json")
+            self.end_headers()
+            self.wfile.write(bytes(json.dumps({"Success": False, "Output": ""}), "utf-8"))
+            return
 
         try:
-            # Call function
-            if loaded_mod is None:
-                loaded_mod = importlib.import_module(module)
-
-            if not return_output:
-                result = getattr(loaded_mod, func_name)(params, context)
-                response["Output"] = ""
-            else:
-                with CaptureOutput() as capturer:
-                    result = getattr(loaded_mod, func_name)(params, context)
-                response["Output"] = str(capturer.get_stdout()) + "\n" + str(capturer.get_stderr())
-
-            response["Result"] = json.dumps(result)
-            response["Success"] = True
-        except Exception as e:
-            print(e, file=sys.stderr)
-            response["Success"] = False
+            response = receiver.recv()
+        except EOFError:
+            # the handler process terminated without a response
+            response = {"Success": False}
+        process.join()
+        receiver.close()
 
         self.send_response(200)
         self.send_header("Content-type", "application/json")
@@ -102,12 +162,22 @@ class Executor(BaseHTTPRequestHandler):
 
 if __name__ == "__main__":
     # Porta e directory configurabili tramite argomenti
-    PORT = int(sys.argv[1]) if sys.argv[1:] else 8080
+    PORT = int(sys.argv[1]) if sys.argv[1:] else int(os.environ.get("EXECUTOR_PORT", 8080))
     if sys.argv[2:]:
         os.chdir(sys.argv[2])
+    ADDRESS = os.environ.get("EXECUTOR_HOST", "0.0.0.0")
 
     # Server concorrente
-    server = ThreadingSimpleServer(('0.0.0.0', PORT), Executor)
+    server = ThreadingSimpleServer((ADDRESS, PORT), Executor)
+
+    # il nodo puo' raggiungere l'executor tramite Unix domain socket
+    socket_path = os.environ.get("EXECUTOR_SOCKET")
+    if socket_path:
+        if os.path.exists(socket_path):
+            os.remove(socket_path)
+        unix_server = ThreadingUnixHTTPServer(socket_path, Executor)
+        os.chmod(socket_path, 0o660)
+        threading.Thread(target=unix_server.serve_forever, daemon=True).start()
     print(f"Serving HTTP traffic on {HOST} using port {PORT}")
     try:
         server.serve_forever()
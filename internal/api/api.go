@@ -12,6 +12,7 @@ import (
 	"time"
 
 	"github.com/grussorusso/serverledge/internal/client"
+	"github.com/grussorusso/serverledge/internal/clock"
 	"github.com/grussorusso/serverledge/internal/config"
 	"github.com/grussorusso/serverledge/internal/container"
 	"github.com/grussorusso/serverledge/internal/function"
@@ -40,6 +41,17 @@ func GetFunctions(c echo.Context) error {
 
 // InvokeFunction handles a function invocation request.
 func InvokeFunction(c echo.Context) error {
+	return invoke(c, false)
+}
+
+// InvokeOffloadedFunction handles an invocation offloaded by another node,
+// which holds the cluster concurrency slot of the request until it
+// receives the response.
+func InvokeOffloadedFunction(c echo.Context) error {
+	return invoke(c, true)
+}
+
+func invoke(c echo.Context, concurrencySlotHeld bool) error {
 	funcName := c.Param("fun")
 	fun, ok := function.GetFunction(funcName)
 	if !ok {
@@ -58,23 +70,58 @@ func InvokeFunction(c echo.Context) error {
 	defer requestsPool.Put(r)
 	r.Fun = fun
 	r.Params = invocationRequest.Params
-	r.Arrival = time.Now()
+	r.Arrival = clock.Now()
 	r.Class = function.ServiceClass(invocationRequest.QoSClass)
 	r.MaxRespT = invocationRequest.QoSMaxRespT
 	r.CanDoOffloading = invocationRequest.CanDoOffloading
 	r.Async = invocationRequest.Async
 	r.ReturnOutput = invocationRequest.ReturnOutput
+	r.ConcurrencySlotHeld = concurrencySlotHeld
+	r.Caller = requestCaller(c)
 	r.ReqId = fmt.Sprintf("%s-%s%d", fun, node.NodeIdentifier[len(node.NodeIdentifier)-5:], r.Arrival.Nanosecond())
 
+	timeout := function.EffectiveTimeout(fun, invocationRequest.Timeout)
+
 	if r.Async {
-		go scheduling.SubmitAsyncRequest(r)
+		if scheduling.IsOverloaded() {
+			scheduling.RejectRequest(fun)
+			return c.String(http.StatusServiceUnavailable, "Overloaded")
+		}
+		// async requests outlive the HTTP request
+		ctx, cancel := withTimeout(context.Background(), timeout)
+		r.Ctx = ctx
+		go func() {
+			defer cancel()
+			scheduling.SubmitAsyncRequest(r)
+		}()
 		return c.JSON(http.StatusOK, function.AsyncResponse{ReqId: r.ReqId})
 	}
 
+	// the request is cancelled if the client goes away
+	ctx, cancel := withTimeout(c.Request().Context(), timeout)
+	defer cancel()
+	r.Ctx = ctx
+
 	executionReport, err := scheduling.SubmitRequest(r)
 
-	if errors.Is(err, node.OutOfResourcesErr) {
+	if errors.Is(err, scheduling.TimeoutErr) {
+		return c.JSON(http.StatusGatewayTimeout, function.Response{Success: false, ExecutionReport: executionReport})
+	} else if errors.Is(err, context.Canceled) {
+		log.Printf("[%s] Request cancelled by the client\n", r)
+		return c.NoContent(http.StatusServiceUnavailable)
+	} else if errors.Is(err, node.ContainerFailedErr) {
+		log.Printf("Invocation failed: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, function.Response{Success: false, ExecutionReport: executionReport})
+	} else if errors.Is(err, scheduling.OverloadedErr) {
+		return c.String(http.StatusServiceUnavailable, "Overloaded")
+	} else if errors.Is(err, scheduling.RateLimitedErr) {
+		return rejectRateLimited(c, scheduling.RetryAfter(err))
+	} else if errors.Is(err, scheduling.ThrottledErr) {
+		return c.String(http.StatusTooManyRequests, "Throttled: function concurrency limit reached")
+	} else if errors.Is(err, node.OutOfResourcesErr) {
 		return c.String(http.StatusTooManyRequests, "")
+	} else if errors.Is(err, scheduling.DeadlineMissedErr) {
+		return c.JSON(http.StatusUnprocessableEntity, function.Response{Success: false, ExecutionReport: executionReport})
 	} else if err != nil {
 		log.Printf("Invocation failed: %v\n", err)
 		return c.String(http.StatusInternalServerError, "")
@@ -83,6 +130,15 @@ func InvokeFunction(c echo.Context) error {
 	}
 }
 
+// withTimeout returns a context expiring after the given number of seconds
+// (0 = no timeout).
+func withTimeout(parent context.Context, timeout float64) (context.Context, context.CancelFunc) {
+	if timeout <= 0.0 {
+		return context.WithCancel(parent)
+	}
+	return context.WithTimeout(parent, time.Duration(timeout*float64(time.Second)))
+}
+
 // PollAsyncResult checks for the result of an asynchronous invocation.
 func PollAsyncResult(c echo.Context) error {
 	reqId := c.Param("reqId")
@@ -138,11 +194,34 @@ func CreateFunction(c echo.Context) error {
 		}
 	}
 
+	if !node.IsValidSelectionStrategy(f.SelectionStrategy) {
+		return c.JSON(http.StatusBadRequest, "Invalid selection strategy.")
+	}
+
+	if f.Timeout < 0.0 {
+		return c.JSON(http.StatusBadRequest, "Invalid timeout.")
+	}
+
+	if f.MinWarm < 0 || f.KeepAlive < 0 {
+		return c.JSON(http.StatusBadRequest, "Invalid warm pool settings.")
+	}
+
+	if f.MaxConcurrency < 0 || f.ReservedConcurrency < 0 ||
+		(f.MaxConcurrency > 0 && f.ReservedConcurrency > f.MaxConcurrency) {
+		return c.JSON(http.StatusBadRequest, "Invalid concurrency settings.")
+	}
+
+	if f.RateLimit < 0 || f.RateBurst < 0 || f.CallerRateLimit < 0 || f.CallerRateBurst < 0 {
+		return c.JSON(http.StatusBadRequest, "Invalid rate limits.")
+	}
+
 	err = f.SaveToEtcd()
 	if err != nil {
 		log.Printf("Failed creation: %v\n", err)
 		return c.JSON(http.StatusServiceUnavailable, "")
 	}
+	node.ProvisionMinWarm(&f)
+
 	response := struct {
 		Created       string
 		InstanceLimit int64
@@ -194,21 +273,52 @@ func DecodeServiceClass(serviceClass string) (p function.ServiceClass) {
 
 // GetServerStatus simple api to check the current server status
 func GetServerStatus(c echo.Context) error {
-	node.Resources.RLock()
-	defer node.Resources.RUnlock()
+	concurrency := node.ConcurrencyStatusAll()
+	queueLengths := scheduling.GetQueueLengths()
+	functionQueueLengths := scheduling.GetFunctionQueueLengths()
+	intake := scheduling.GetIntakeStatus()
+	availableMemMB, availableCPUs := node.Resources.Available()
+
 	portNumber := config.GetInt("api.port", 1323)
 	url := fmt.Sprintf("http://%s:%d", utils.GetIpAddress().String(), portNumber)
 	response := registration.StatusInformation{
-		Url:            url,
-		AvailableMemMB: node.Resources.AvailableMemMB,
-		AvailableCPUs:  node.Resources.AvailableCPUs,
-		DropCount:      node.Resources.DropCount,
-		Coordinates:    *registration.Reg.Client.GetCoordinate(),
+		Url:                  url,
+		AvailableMemMB:       availableMemMB,
+		AvailableCPUs:        availableCPUs,
+		DropCount:            node.Resources.DropCount,
+		Coordinates:          *registration.Reg.Client.GetCoordinate(),
+		Concurrency:          concurrency,
+		QueueLengths:         queueLengths,
+		FunctionQueueLengths: functionQueueLengths,
+		Intake:               intake,
 	}
 
 	return c.JSON(http.StatusOK, response)
 }
 
+// GetAutoscalerStatus returns the demand forecasts and the recent decisions
+// of the autoscaler.
+func GetAutoscalerStatus(c echo.Context) error {
+	return c.JSON(http.StatusOK, node.GetAutoscalerStatus())
+}
+
+// GetKeepAliveStatus returns the inter-arrival histograms and the keep-alive
+// windows derived for each function.
+func GetKeepAliveStatus(c echo.Context) error {
+	return c.JSON(http.StatusOK, node.KeepAliveStatusAll())
+}
+
+// GetContainers lists the containers in the pools of the node, along with
+// the containers owned by the node according to the container runtime.
+func GetContainers(c echo.Context) error {
+	containers, err := node.ListContainers()
+	if err != nil {
+		log.Printf("Could not list containers: %v\n", err)
+		return c.String(http.StatusServiceUnavailable, "Container runtime unavailable")
+	}
+	return c.JSON(http.StatusOK, containers)
+}
+
 // PrewarmFunction handles a prewarming request.
 func PrewarmFunction(c echo.Context) error {
 	var req client.PrewarmingRequest
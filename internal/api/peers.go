@@ -0,0 +1,49 @@
+package api
+
+import (
+	"log"
+	"net"
+	"net/http"
+
+	"github.com/grussorusso/serverledge/internal/registration"
+	"github.com/labstack/echo/v4"
+)
+
+// context key set on the requests sent by a registered node
+const verifiedPeerKey = "verifiedPeer"
+
+// PeersOnly is a middleware rejecting with 403 the requests that do not come
+// from a node registered in etcd. The address of the TCP connection is
+// used, as forwarding headers can be set by any client.
+func PeersOnly(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		host := remoteHost(c)
+		ok, err := registration.IsRegisteredPeer(host)
+		if err != nil {
+			log.Printf("Could not check the registered nodes: %v\n", err)
+			return c.String(http.StatusServiceUnavailable, "")
+		}
+		if !ok {
+			log.Printf("Rejecting offloaded request from unknown host %s\n", host)
+			return c.String(http.StatusForbidden, "Not a registered node")
+		}
+		c.Set(verifiedPeerKey, true)
+		return next(c)
+	}
+}
+
+// isVerifiedPeer reports whether the request has been sent by a registered
+// node, as checked by PeersOnly.
+func isVerifiedPeer(c echo.Context) bool {
+	verified, _ := c.Get(verifiedPeerKey).(bool)
+	return verified
+}
+
+// remoteHost returns the address of the TCP connection of the request.
+func remoteHost(c echo.Context) string {
+	host, _, err := net.SplitHostPort(c.Request().RemoteAddr)
+	if err != nil {
+		return c.Request().RemoteAddr
+	}
+	return host
+}
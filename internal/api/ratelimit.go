@@ -0,0 +1,137 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/grussorusso/serverledge/internal/client"
+	"github.com/grussorusso/serverledge/internal/config"
+	"github.com/grussorusso/serverledge/internal/function"
+	"github.com/labstack/echo/v4"
+	"golang.org/x/time/rate"
+)
+
+// per-caller limiters not used for this long are discarded
+const idleLimiterTimeout = 10 * time.Minute
+
+type limiterEntry struct {
+	limiter  *rate.Limiter
+	limit    float64
+	burst    int
+	lastUsed time.Time
+}
+
+type rateLimiters struct {
+	sync.Mutex
+	limiters  map[string]*limiterEntry
+	lastSweep time.Time
+}
+
+var functionLimiters = &rateLimiters{limiters: make(map[string]*limiterEntry)}
+var callerLimiters = &rateLimiters{limiters: make(map[string]*limiterEntry)}
+
+// reserve takes at time now a token from the bucket identified by key, which
+// is (re)configured with the given limit and burst. If the bucket is empty,
+// it returns a nil reservation and the time to wait before the next request
+// can be accepted. The token is given back cancelling the reservation at the
+// same time now.
+func (rl *rateLimiters) reserve(key string, limit float64, burst int, now time.Time) (*rate.Reservation, time.Duration) {
+	rl.Lock()
+	defer rl.Unlock()
+
+	if now.Sub(rl.lastSweep) > idleLimiterTimeout {
+		for k, e := range rl.limiters {
+			if now.Sub(e.lastUsed) > idleLimiterTimeout {
+				delete(rl.limiters, k)
+			}
+		}
+		rl.lastSweep = now
+	}
+
+	if burst < 1 {
+		burst = int(math.Max(math.Ceil(limit), 1))
+	}
+	e, ok := rl.limiters[key]
+	if !ok || e.limit != limit || e.burst != burst {
+		// the limits may have been updated with the function
+		e = &limiterEntry{limiter: rate.NewLimiter(rate.Limit(limit), burst), limit: limit, burst: burst}
+		rl.limiters[key] = e
+	}
+	e.lastUsed = now
+
+	r := e.limiter.ReserveN(now, 1)
+	if delay := r.DelayFrom(now); delay > 0 {
+		r.CancelAt(now)
+		return nil, delay
+	}
+	return r, 0
+}
+
+// RateLimit is a middleware enforcing the invocation rate limits of each
+// function, both overall and for each caller. Requests exceeding the limits
+// are rejected with 429, reporting the time to wait in Retry-After.
+func RateLimit(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		fun, ok := function.GetFunction(c.Param("fun"))
+		if !ok {
+			return next(c) // unknown functions are handled by the API
+		}
+		if delay, ok := checkRateLimits(c, fun); !ok {
+			return rejectRateLimited(c, delay)
+		}
+		return next(c)
+	}
+}
+
+// checkRateLimits takes a token for an invocation of fun from the buckets of
+// the function and of the caller, returning false and the time to wait if
+// any of them is empty. No token is taken from a bucket if the request is
+// rejected.
+func checkRateLimits(c echo.Context, fun *function.Function) (time.Duration, bool) {
+	now := time.Now()
+	var funReservation *rate.Reservation
+	if fun.RateLimit > 0 {
+		r, delay := functionLimiters.reserve(fun.Name, fun.RateLimit, fun.RateBurst, now)
+		if r == nil {
+			return delay, false
+		}
+		funReservation = r
+	}
+
+	callerLimit, callerBurst := fun.CallerRateLimit, fun.CallerRateBurst
+	if callerLimit <= 0 {
+		callerLimit = config.GetFloat(config.API_CALLER_RATE_LIMIT, 0)
+		callerBurst = config.GetInt(config.API_CALLER_RATE_BURST, 0)
+	}
+	if callerLimit > 0 {
+		key := fmt.Sprintf("%s/%s", fun.Name, requestCaller(c))
+		if r, delay := callerLimiters.reserve(key, callerLimit, callerBurst, now); r == nil {
+			if funReservation != nil {
+				funReservation.CancelAt(now)
+			}
+			return delay, false
+		}
+	}
+	return 0, true
+}
+
+// requestCaller identifies the caller of an invocation. The caller header is
+// only trusted on the requests offloaded by a registered node: any other
+// caller is identified by the address of the TCP connection, as headers
+// can be set by any client.
+func requestCaller(c echo.Context) string {
+	if isVerifiedPeer(c) {
+		if caller := c.Request().Header.Get(client.CallerHeader); caller != "" {
+			return caller
+		}
+	}
+	return remoteHost(c)
+}
+
+func rejectRateLimited(c echo.Context, delay time.Duration) error {
+	c.Response().Header().Set("Retry-After", fmt.Sprintf("%d", int(math.Ceil(delay.Seconds()))))
+	return c.String(http.StatusTooManyRequests, "Rate limit exceeded")
+}
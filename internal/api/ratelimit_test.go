@@ -0,0 +1,126 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/grussorusso/serverledge/internal/client"
+	"github.com/grussorusso/serverledge/internal/function"
+	"github.com/labstack/echo/v4"
+)
+
+// invocationContext returns the context of an invocation received from
+// remoteAddr, optionally with the caller header.
+func invocationContext(remoteAddr, caller string) echo.Context {
+	req := httptest.NewRequest(http.MethodPost, "/invoke/f", nil)
+	req.RemoteAddr = remoteAddr
+	if caller != "" {
+		req.Header.Set(client.CallerHeader, caller)
+	}
+	return echo.New().NewContext(req, httptest.NewRecorder())
+}
+
+// offloadContext returns the context of an invocation offloaded by the
+// registered node at remoteAddr on behalf of caller.
+func offloadContext(remoteAddr, caller string) echo.Context {
+	c := invocationContext(remoteAddr, caller)
+	c.Set(verifiedPeerKey, true)
+	return c
+}
+
+func TestRateLimitersReserve(t *testing.T) {
+	rl := &rateLimiters{limiters: make(map[string]*limiterEntry)}
+
+	for i := 0; i < 2; i++ {
+		if r, _ := rl.reserve("f", 1.0, 2, time.Now()); r == nil {
+			t.Fatalf("request %d rejected within the burst", i)
+		}
+	}
+	r, delay := rl.reserve("f", 1.0, 2, time.Now())
+	if r != nil || delay <= 0 || delay > time.Second {
+		t.Fatalf("unexpected outcome beyond the burst: %v, %v", r, delay)
+	}
+	// rejected requests do not consume tokens
+	if _, delay2 := rl.reserve("f", 1.0, 2, time.Now()); delay2 > delay {
+		t.Fatalf("the delay grows with rejected requests: %v > %v", delay2, delay)
+	}
+
+	if r, _ := rl.reserve("g", 1.0, 2, time.Now()); r == nil {
+		t.Fatalf("buckets are not independent")
+	}
+	// updated limits replace the bucket
+	if r, _ := rl.reserve("f", 10.0, 0, time.Now()); r == nil {
+		t.Fatalf("the bucket has not been reconfigured")
+	}
+	if e := rl.limiters["f"]; e.burst != 10 {
+		t.Fatalf("the burst does not default to the limit: %d", e.burst)
+	}
+
+	// idle buckets are discarded
+	rl.limiters["g"].lastUsed = time.Now().Add(-2 * idleLimiterTimeout)
+	rl.lastSweep = time.Now().Add(-2 * idleLimiterTimeout)
+	rl.reserve("f", 10.0, 0, time.Now())
+	if _, ok := rl.limiters["g"]; ok {
+		t.Fatalf("idle bucket not discarded")
+	}
+}
+
+func TestCheckRateLimits(t *testing.T) {
+	defer func() {
+		functionLimiters = &rateLimiters{limiters: make(map[string]*limiterEntry)}
+		callerLimiters = &rateLimiters{limiters: make(map[string]*limiterEntry)}
+	}()
+	f := &function.Function{Name: "f", CallerRateLimit: 0.01, CallerRateBurst: 1}
+
+	if _, ok := checkRateLimits(invocationContext("10.0.0.1:1234", ""), f); !ok {
+		t.Fatalf("first request rejected")
+	}
+	if _, ok := checkRateLimits(invocationContext("10.0.0.1:1234", ""), f); ok {
+		t.Fatalf("caller rate limit not enforced")
+	}
+	if _, ok := checkRateLimits(invocationContext("10.0.0.2:1234", ""), f); !ok {
+		t.Fatalf("callers are not identified by their address")
+	}
+
+	// requests offloaded by the same node are limited by original caller
+	if _, ok := checkRateLimits(offloadContext("10.0.0.3:1234", "alice"), f); !ok {
+		t.Fatalf("first request of alice rejected")
+	}
+	if _, ok := checkRateLimits(offloadContext("10.0.0.3:1234", "bob"), f); !ok {
+		t.Fatalf("bob limited as alice")
+	}
+	delay, ok := checkRateLimits(offloadContext("10.0.0.4:1234", "alice"), f)
+	if ok || delay < 99*time.Second {
+		t.Fatalf("rate limit of alice not enforced: %v, %v", ok, delay)
+	}
+
+	// the caller header is ignored on requests not sent by a registered
+	// node, as are the forwarding headers
+	spoofed := invocationContext("10.0.0.1:1234", "mallory")
+	spoofed.Request().Header.Set(echo.HeaderXForwardedFor, "10.0.0.9")
+	if _, ok := checkRateLimits(spoofed, f); ok {
+		t.Fatalf("caller rate limit reset by spoofed headers")
+	}
+
+	// the function limit is shared by all the callers
+	g := &function.Function{Name: "g", RateLimit: 0.01, RateBurst: 1}
+	checkRateLimits(invocationContext("10.0.0.1:1234", ""), g)
+	if _, ok := checkRateLimits(invocationContext("10.0.0.2:1234", ""), g); ok {
+		t.Fatalf("function rate limit not enforced")
+	}
+
+	// requests rejected by the caller limit do not consume the function
+	// tokens
+	h := &function.Function{Name: "h", RateLimit: 0.01, RateBurst: 2, CallerRateLimit: 0.01, CallerRateBurst: 1}
+	checkRateLimits(invocationContext("10.0.0.1:1234", ""), h)
+	for i := 0; i < 3; i++ {
+		if _, ok := checkRateLimits(invocationContext("10.0.0.1:1234", ""), h); ok {
+			t.Fatalf("caller rate limit not enforced")
+		}
+	}
+	if _, ok := checkRateLimits(invocationContext("10.0.0.2:1234", ""), h); !ok {
+		t.Fatalf("function tokens consumed by rejected requests")
+	}
+}
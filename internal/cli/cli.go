@@ -31,6 +31,12 @@ var invokeCmd = &cobra.Command{
 	Run:   invoke,
 }
 
+var containersCmd = &cobra.Command{
+	Use:   "containers",
+	Short: "Lists the containers of the node, as known to the node and to the container runtime",
+	Run:   listContainers,
+}
+
 var pollCmd = &cobra.Command{
 	Use:   "poll",
 	Short: "Polls the result of an asynchronous invocation",
@@ -61,10 +67,13 @@ var statusCmd = &cobra.Command{
 	Run:   getStatus,
 }
 
-var funcName, runtime, handler, customImage, src, qosClass string
+var funcName, runtime, handler, customImage, src, qosClass, selectionStrategy string
 var requestId string
-var memory, maxFunctionInstances int64
-var cpuDemand, qosMaxRespT float64
+var memory, memoryPerInstance, maxFunctionInstances, minWarm, keepAlive int64
+var maxConcurrency, reservedConcurrency int64
+var cpuDemand, baseCPUDemand, qosMaxRespT, timeout float64
+var rateLimit, callerRateLimit float64
+var rateBurst, callerRateBurst int
 var params []string
 var paramsFile string
 var asyncInvocation bool
@@ -84,6 +93,7 @@ func Init() {
 	invokeCmd.Flags().StringVarP(&paramsFile, "params_file", "j", "", "File containing parameters (JSON)")
 	invokeCmd.Flags().BoolVarP(&asyncInvocation, "async", "a", false, "Asynchronous invocation")
 	invokeCmd.Flags().BoolVarP(&returnOutput, "ret_output", "o", false, "Capture function output (if supported by used runtime)")
+	invokeCmd.Flags().Float64VarP(&timeout, "timeout", "t", 0.0, "Invocation timeout in seconds (optional)")
 
 	rootCmd.AddCommand(createCmd)
 	createCmd.Flags().StringVarP(&funcName, "function", "f", "", "name of the function")
@@ -91,9 +101,21 @@ func Init() {
 	createCmd.Flags().StringVarP(&handler, "handler", "", "", "function handler (runtime specific)")
 	createCmd.Flags().Int64VarP(&maxFunctionInstances, "max_istances", "", 20, "Upper limit for the number of instances")
 	createCmd.Flags().Int64VarP(&memory, "memory", "", 128, "memory (in MB) for the function")
-	createCmd.Flags().Float64VarP(&cpuDemand, "cpu", "", 0.0, "estimated CPU demand for the function (1.0 = 1 core)")
+	createCmd.Flags().Int64VarP(&memoryPerInstance, "memory_per_instance", "", 0, "additional memory (in MB) for each active instance in a container")
+	createCmd.Flags().Float64VarP(&cpuDemand, "cpu", "", 0.0, "estimated CPU demand for each function instance (1.0 = 1 core)")
+	createCmd.Flags().Float64VarP(&baseCPUDemand, "cpu_base", "", 0.0, "CPU demand of each container, regardless of its active instances")
 	createCmd.Flags().StringVarP(&src, "src", "", "", "source for the function (single file, directory or TAR archive) (not necessary for runtime==custom)")
 	createCmd.Flags().StringVarP(&customImage, "custom_image", "", "", "custom container image (only if runtime == 'custom')")
+	createCmd.Flags().StringVarP(&selectionStrategy, "selection", "", "", "running container selection strategy: firstfit, leastloaded, binpacking (default: node setting)")
+	createCmd.Flags().Float64VarP(&timeout, "timeout", "", 0.0, "max execution time in seconds (default: no timeout)")
+	createCmd.Flags().Int64VarP(&minWarm, "min_warm", "", 0, "minimum number of warm containers kept on each node")
+	createCmd.Flags().Int64VarP(&keepAlive, "keep_alive", "", 0, "seconds an idle container is kept warm (default: node setting)")
+	createCmd.Flags().Int64VarP(&maxConcurrency, "max_concurrency", "", 0, "max concurrent invocations in the cluster (default: unlimited)")
+	createCmd.Flags().Int64VarP(&reservedConcurrency, "reserved_concurrency", "", 0, "concurrent invocations reserved in the cluster")
+	createCmd.Flags().Float64VarP(&rateLimit, "rate_limit", "", 0.0, "max invocations per second on each node (default: unlimited)")
+	createCmd.Flags().IntVarP(&rateBurst, "rate_burst", "", 0, "max burst of invocations on each node")
+	createCmd.Flags().Float64VarP(&callerRateLimit, "caller_rate_limit", "", 0.0, "max invocations per second of each caller (default: node setting)")
+	createCmd.Flags().IntVarP(&callerRateBurst, "caller_rate_burst", "", 0, "max burst of invocations of each caller")
 
 	rootCmd.AddCommand(deleteCmd)
 	deleteCmd.Flags().StringVarP(&funcName, "function", "f", "", "name of the function")
@@ -102,6 +124,8 @@ func Init() {
 
 	rootCmd.AddCommand(statusCmd)
 
+	rootCmd.AddCommand(containersCmd)
+
 	rootCmd.AddCommand(pollCmd)
 	pollCmd.Flags().StringVarP(&requestId, "request", "", "", "ID of the async request")
 
@@ -168,6 +192,7 @@ func invoke(cmd *cobra.Command, args []string) {
 		QoSMaxRespT:     qosMaxRespT,
 		CanDoOffloading: true,
 		ReturnOutput:    returnOutput,
+		Timeout:         timeout,
 		Async:           asyncInvocation}
 	invocationBody, err := json.Marshal(request)
 	if err != nil {
@@ -212,10 +237,22 @@ func create(cmd *cobra.Command, args []string) {
 
 	request := function.Function{Name: funcName, Handler: handler,
 		Runtime: runtime, MemoryMB: memory,
+		MemoryPerInstanceMB:  memoryPerInstance,
 		CPUDemand:            cpuDemand,
+		BaseCPUDemand:        baseCPUDemand,
 		TarFunctionCode:      encoded,
 		CustomImage:          customImage,
 		MaxFunctionInstances: maxFunctionInstances,
+		SelectionStrategy:    selectionStrategy,
+		Timeout:              timeout,
+		MinWarm:              minWarm,
+		KeepAlive:            keepAlive,
+		MaxConcurrency:       maxConcurrency,
+		ReservedConcurrency:  reservedConcurrency,
+		RateLimit:            rateLimit,
+		RateBurst:            rateBurst,
+		CallerRateLimit:      callerRateLimit,
+		CallerRateBurst:      callerRateBurst,
 	}
 	requestBody, err := json.Marshal(request)
 	if err != nil {
@@ -304,6 +341,16 @@ func getStatus(cmd *cobra.Command, args []string) {
 	utils.PrintJsonResponse(resp.Body)
 }
 
+func listContainers(cmd *cobra.Command, args []string) {
+	url := fmt.Sprintf("http://%s:%d/containers", ServerConfig.Host, ServerConfig.Port)
+	resp, err := http.Get(url)
+	if err != nil {
+		fmt.Printf("List request failed: %v\n", err)
+		os.Exit(2)
+	}
+	utils.PrintJsonResponse(resp.Body)
+}
+
 func poll(cmd *cobra.Command, args []string) {
 	if len(requestId) < 1 {
 		showHelpAndExit(cmd)
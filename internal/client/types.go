@@ -1,5 +1,10 @@
 package client
 
+// CallerHeader identifies the caller of an invocation for rate limiting;
+// if missing, the client IP address is used. Nodes offloading a request set
+// it to the original caller.
+const CallerHeader = "Serverledge-Caller"
+
 type InvocationRequest struct {
 	Params          map[string]interface{}
 	QoSClass        int64
@@ -8,6 +13,7 @@ type InvocationRequest struct {
 	CanDoOffloading bool
 	Async           bool
 	ReturnOutput    bool
+	Timeout         float64 // seconds (0 = function default)
 }
 
 type PrewarmingRequest struct {
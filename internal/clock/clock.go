@@ -0,0 +1,82 @@
+package clock
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// virtualClock runs speedup times faster than the real time, starting from
+// origin.
+type virtualClock struct {
+	origin  time.Time
+	speedup float64
+}
+
+// the clock of the node (nil = real time)
+var current atomic.Pointer[virtualClock]
+
+// SetSpeedup makes the clock of the node run speedup times faster than the
+// real time, starting from now. A speedup of 1 restores the real time. It is
+// meant to be called before the node starts (e.g., by simulations), as the
+// time observed by running components would jump.
+//
+// The clock is not a discrete-event clock: the real time spent by the node
+// between events (e.g., scheduling a request) is scaled as well, and depends
+// on the load of the host. The times observed by the node are thus biased
+// upwards by about speedup times its overhead, and runs are not exactly
+// reproducible.
+func SetSpeedup(speedup float64) {
+	if speedup <= 0.0 || speedup == 1.0 {
+		current.Store(nil)
+		return
+	}
+	current.Store(&virtualClock{origin: time.Now(), speedup: speedup})
+}
+
+// Speedup returns how many times the clock is faster than the real time.
+func Speedup() float64 {
+	if c := current.Load(); c != nil {
+		return c.speedup
+	}
+	return 1.0
+}
+
+// Now returns the current time of the node.
+func Now() time.Time {
+	c := current.Load()
+	if c == nil {
+		return time.Now()
+	}
+	return c.origin.Add(time.Duration(float64(time.Since(c.origin)) * c.speedup))
+}
+
+// Since returns the time elapsed since t, according to the clock of the node.
+func Since(t time.Time) time.Duration {
+	return Now().Sub(t)
+}
+
+// Real converts a duration of the node clock into real time.
+func Real(d time.Duration) time.Duration {
+	if c := current.Load(); c != nil {
+		return time.Duration(float64(d) / c.speedup)
+	}
+	return d
+}
+
+// Sleep pauses the current goroutine for d, according to the clock of the
+// node.
+func Sleep(d time.Duration) {
+	time.Sleep(Real(d))
+}
+
+// NewTicker returns a ticker ticking every d, according to the clock of the
+// node.
+func NewTicker(d time.Duration) *time.Ticker {
+	return time.NewTicker(Real(d))
+}
+
+// AfterFunc calls f in its own goroutine after d, according to the clock of
+// the node.
+func AfterFunc(d time.Duration, f func()) *time.Timer {
+	return time.AfterFunc(Real(d), f)
+}
@@ -6,6 +6,11 @@ const ETCD_ADDRESS = "etcd.address"
 //exposed port for serverledge APIs
 const API_PORT = "api.port"
 
+// default rate limit (requests/s) and burst for each API caller and function
+// (0 = unlimited)
+const API_CALLER_RATE_LIMIT = "api.ratelimit.caller"
+const API_CALLER_RATE_BURST = "api.ratelimit.callerburst"
+
 //REMOTE SERVER URL
 const CLOUD_URL = "cloud.server.url"
 
@@ -25,6 +30,52 @@ const POOL_CLEANUP_PERIOD = "janitor.interval"
 // container expiration time
 const CONTAINER_EXPIRATION_TIME = "container.expiration"
 
+// pauses idle warm containers, resuming them when reused
+const CONTAINER_PAUSE_IDLE = "container.pause"
+
+// enables keep-alive and pre-warm windows derived from the histogram of
+// function inter-arrival times (instead of the fixed expiration time)
+const CONTAINER_ADAPTIVE_KEEPALIVE = "container.keepalive.adaptive"
+
+// width (in seconds) of the inter-arrival histogram bins
+const CONTAINER_KEEPALIVE_BIN = "container.keepalive.bin"
+
+// number of bins of the inter-arrival histogram
+const CONTAINER_KEEPALIVE_BINS = "container.keepalive.bins"
+
+// inter-arrival times to observe before using the histogram
+const CONTAINER_KEEPALIVE_MIN_SAMPLES = "container.keepalive.minsamples"
+
+// enables learning the number of instances that can share a container (true/false)
+const CONTAINER_ADAPTIVE_CONCURRENCY = "container.concurrency.adaptive"
+
+// max tolerated slowdown of a function w.r.t. running a single instance per container (0.5 = 50%)
+const CONTAINER_CONCURRENCY_TOLERANCE = "container.concurrency.tolerance"
+
+// number of observed executions before the learned concurrency level is used
+const CONTAINER_CONCURRENCY_MIN_SAMPLES = "container.concurrency.minsamples"
+
+// one every N acquisitions may exceed the learned concurrency level by one instance (0 = never)
+const CONTAINER_CONCURRENCY_EXPLORATION = "container.concurrency.exploration"
+
+// strategy to pick a running container for a new function instance
+// Possible values: "firstfit", "leastloaded", "binpacking"
+const CONTAINER_SELECTION_STRATEGY = "container.selection"
+
+// policy to choose the warm containers to evict when memory is needed
+// Possible values: "lru", "lfu", "greedydual"
+const CONTAINER_EVICTION_POLICY = "container.eviction"
+
+// enables the autoscaler, which prewarms containers based on forecast arrivals
+const AUTOSCALER_ENABLED = "autoscaler.enabled"
+
+// interval (in seconds) between autoscaler decisions
+const AUTOSCALER_INTERVAL = "autoscaler.interval"
+
+// smoothing factors of the arrival rate level and trend (Holt's method)
+const AUTOSCALER_ALPHA = "autoscaler.alpha"
+const AUTOSCALER_BETA = "autoscaler.beta"
+
 // cache capacity
 const CACHE_SIZE = "cache.size"
 
@@ -34,6 +85,14 @@ const CACHE_CLEANUP = "cache.cleanup"
 //default expiration time assigned to a cache item (Seconds)
 const CACHE_ITEM_EXPIRATION = "cache.expiration"
 
+// max number of concurrent invocations in the cluster, shared by the
+// functions without reserved concurrency (0 = unlimited)
+const CLUSTER_CONCURRENCY_LIMIT = "cluster.concurrency"
+
+// if true, cluster-wide concurrency limits are not enforced while Etcd is
+// unavailable; otherwise, invocations are throttled
+const CLUSTER_CONCURRENCY_FAIL_OPEN = "cluster.failopen"
+
 // true if the current server is a remote cloud server
 const IS_IN_CLOUD = "cloud"
 
@@ -59,8 +118,86 @@ const METRICS_PROMETHEUS_HOST = "metrics.prometheus.host"
 const METRICS_PROMETHEUS_PORT = "metrics.prometheus.port"
 
 // Scheduling policy to use
-// Possible values: "qosaware", "default", "cloudonly"
+// Possible values: "qosaware", "default", "cloudonly", "edgecloud", "edgeonly", "edf"
 const SCHEDULING_POLICY = "scheduler.policy"
 
 // Capacity of the queue (possibly) used by the scheduler
 const SCHEDULER_QUEUE_CAPACITY = "scheduler.queue.capacity"
+
+// Type of the queue used by the scheduler
+// Possible values: "fifo", "priority"
+const SCHEDULER_QUEUE_TYPE = "scheduler.queue.type"
+
+// Minimum fraction of dequeued requests reserved to the LOW service class (priority queue only)
+const SCHEDULER_QUEUE_LOW_SHARE = "scheduler.queue.lowshare"
+
+// Reaches executors through Unix domain sockets, instead of the container network
+const EXECUTOR_UNIX_SOCKET = "container.executor.socket"
+
+// Host directory where executor sockets are created
+const EXECUTOR_SOCKET_DIR = "container.executor.socketdir"
+
+// Group ID sharing the executor sockets between the node and the containers
+// (default: the group of the node process)
+const EXECUTOR_SOCKET_GROUP = "container.executor.socketgroup"
+
+// Max time (in seconds) to wait for the executor of a new container to be ready
+const CONTAINER_READINESS_TIMEOUT = "container.readiness.timeout"
+
+// Removes containers that terminate unexpectedly from the pools (true by default)
+const CONTAINER_HEALTH_MONITOR = "container.health.monitor"
+
+// Replaces containers that terminate unexpectedly with new warm containers
+const CONTAINER_HEALTH_REPLACE = "container.health.replace"
+
+// Factory creating the containers of the node
+// Possible values: "docker", "process"
+const CONTAINER_FACTORY = "container.factory"
+
+// Directory where the process factory creates the working directories of containers
+const PROCESS_FACTORY_DIR = "container.process.dir"
+
+// Command starting the executor of process-based containers, unless overridden for the runtime
+const PROCESS_FACTORY_EXECUTOR = "container.process.executor"
+
+// Prefix of the keys setting the executor command of process-based containers for each runtime
+// (e.g., container.process.runtimes.python310)
+const PROCESS_FACTORY_RUNTIMES = "container.process.runtimes"
+
+// Parent cgroup (v2) of process-based containers, used to enforce their limits ("" to disable)
+const PROCESS_FACTORY_CGROUP = "container.process.cgroup"
+
+// Identifier of the node in the labels of its containers, which must not change across restarts
+const CONTAINER_OWNER = "container.owner"
+
+// Handling of the containers left by a previous run of the node
+// Possible values: "adopt", "destroy", "none"
+const CONTAINER_RECONCILE = "container.reconcile"
+
+// Max time (in seconds) to adopt the containers left by a previous run, after
+// which the containers not adopted yet are destroyed
+const CONTAINER_ADOPTION_TIMEOUT = "container.adoption.timeout"
+
+// Network of Docker containers
+// Possible values: "bridge" (default bridge network), "named" (network container.network.name),
+// "isolated" (a network for each function), "publish" (executor port published on the host)
+const CONTAINER_NETWORK_MODE = "container.network.mode"
+
+// Name of the network ("named" mode), or prefix of the names of the per-function networks ("isolated" mode)
+const CONTAINER_NETWORK_NAME = "container.network.name"
+
+// Container of the node (if any), connected to the networks of the executors so that it can reach them
+const CONTAINER_NETWORK_ATTACH = "container.network.attach"
+
+// Address of the host where published executor ports are reached ("publish" mode)
+const CONTAINER_NETWORK_HOST = "container.network.host"
+
+// Number of requests waiting for the scheduler beyond which new requests are rejected
+const SCHEDULER_INTAKE_CAPACITY = "scheduler.intake.capacity"
+
+// Number of completion notifications buffered for the scheduler
+const SCHEDULER_COMPLETIONS_CAPACITY = "scheduler.completions.capacity"
+
+// Number of completion notifications kept in the backlog when the buffer is
+// full, beyond which executions wait for the scheduler
+const SCHEDULER_COMPLETIONS_BACKLOG = "scheduler.completions.backlog"
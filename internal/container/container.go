@@ -2,23 +2,58 @@ package container
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"os"
+	"sync"
 	"time"
 
+	"github.com/grussorusso/serverledge/internal/clock"
+	"github.com/grussorusso/serverledge/internal/config"
 	"github.com/grussorusso/serverledge/internal/executor"
 )
 
-// NewContainer creates and starts a new container.
-func NewContainer(image, codeTar string, opts *ContainerOptions) (ContainerID, error) {
+// polling interval of the readiness endpoint of executors
+const readinessMinInterval = 5 * time.Millisecond
+const readinessMaxInterval = 100 * time.Millisecond
+
+// timeout of each readiness request
+const readinessRequestTimeout = time.Second
+
+// readiness times of new containers, until they are reported
+var readinessTimes sync.Map
+
+// NewContainer creates and starts a new container, and waits for its
+// executor to be ready.
+func NewContainer(image, codeTar string, opts *ContainerOptions) (*ContainerInfo, error) {
+	socketDir, err := socketDirFor(opts)
+	if err != nil {
+		return nil, err
+	}
+	opts.SocketDir = socketDir
+	if socketDir != "" {
+		// needed to reach the executor after a restart of the node
+		if opts.Labels == nil {
+			opts.Labels = make(map[string]string)
+		}
+		opts.Labels[LABEL_SOCKET_DIR] = socketDir
+	}
+
 	contID, err := cf.Create(image, opts)
 	if err != nil {
 		log.Printf("Failed container creation\n")
-		return "", err
+		if socketDir != "" {
+			_ = os.RemoveAll(socketDir)
+		}
+		return nil, err
+	}
+	if socketDir != "" {
+		socketDirs.Store(contID, socketDir) // removed by Destroy
 	}
 
 	if len(codeTar) > 0 {
@@ -26,33 +61,95 @@ func NewContainer(image, codeTar string, opts *ContainerOptions) (ContainerID, e
 		err = cf.CopyToContainer(contID, bytes.NewReader(decodedCode), "/app/")
 		if err != nil {
 			log.Printf("Failed code copy\n")
-			return "", err
+			_ = Destroy(contID)
+			return nil, err
 		}
 	}
 
 	err = cf.Start(contID)
 	if err != nil {
-		return "", err
+		_ = Destroy(contID)
+		return nil, err
+	}
+
+	info, err := cf.Inspect(contID)
+	if err != nil {
+		_ = Destroy(contID)
+		return nil, fmt.Errorf("could not inspect container %s: %v", contID, err)
 	}
 
-	return contID, nil
+	client := registerExecutorClient(info, opts)
+	readiness, err := waitForReadiness(context.Background(), client)
+	if err != nil {
+		log.Printf("Executor of container %s failed to start: %v\n", contID, err)
+		_ = Destroy(contID)
+		return nil, err
+	}
+	readinessTimes.Store(contID, readiness)
+
+	return info, nil
+}
+
+// Adopt resumes the management of a container created by a previous run of
+// the node, returning an error if its executor is not ready, or not before
+// ctx is done.
+func Adopt(ctx context.Context, info *ContainerInfo, concurrency int) error {
+	if info.State == STATE_PAUSED {
+		if err := cf.Unpause(info.ID); err != nil {
+			return err
+		}
+	}
+
+	opts := &ContainerOptions{Concurrency: concurrency, SocketDir: info.Labels[LABEL_SOCKET_DIR]}
+	if opts.SocketDir != "" {
+		socketDirs.Store(info.ID, opts.SocketDir) // removed by Destroy
+	}
+	client := registerExecutorClient(info, opts)
+	if _, err := waitForReadiness(ctx, client); err != nil {
+		forgetExecutorClient(info.ID)
+		return err
+	}
+	return nil
+}
+
+// List returns the containers, in any state, having all the given labels.
+func List(labels map[string]string) ([]*ContainerInfo, error) {
+	return cf.List(labels)
+}
+
+// TakeReadinessTime returns the time the executor of a new container took
+// to become ready. The time is only returned to the first caller, i.e.,
+// the execution that cold-started the container.
+func TakeReadinessTime(contID ContainerID) time.Duration {
+	if v, ok := readinessTimes.LoadAndDelete(contID); ok {
+		return v.(time.Duration)
+	}
+	return 0
 }
 
 // Execute interacts with the Executor running in the container to invoke the
-// function through a HTTP request.
-func Execute(contID ContainerID, req *executor.InvocationRequest) (*executor.InvocationResult, time.Duration, error) {
-	ipAddr, err := cf.GetIPAddress(contID)
+// function through a HTTP request. The executor is expected to be ready, so
+// the request is not retried. The request is aborted as soon as ctx is
+// done: in this case, the returned error wraps ctx.Err().
+func Execute(ctx context.Context, contID ContainerID, req *executor.InvocationRequest) (*executor.InvocationResult, error) {
+	client, err := getExecutorClient(contID)
 	if err != nil {
-		return nil, 0, fmt.Errorf("Failed to retrieve IP address for container: %v", err)
+		return nil, err
 	}
 
 	postBody, _ := json.Marshal(req)
-	postBodyB := bytes.NewBuffer(postBody)
 
-	resp, waitDuration, err := sendPostRequestWithRetries(fmt.Sprintf("http://%s:%d/invoke", ipAddr,
-		executor.DEFAULT_EXECUTOR_PORT), postBodyB)
-	if err != nil || resp == nil {
-		return nil, waitDuration, fmt.Errorf("Request to executor failed: %v", err)
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, client.baseURL+"/invoke", bytes.NewReader(postBody))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	resp, err := client.client.Do(httpReq)
+	if err != nil {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		return nil, fmt.Errorf("Request to executor failed: %w", err)
 	}
 
 	defer func(Body io.ReadCloser) {
@@ -62,55 +159,97 @@ func Execute(contID ContainerID, req *executor.InvocationRequest) (*executor.Inv
 		}
 	}(resp.Body)
 
+	if resp.StatusCode == http.StatusGatewayTimeout {
+		// the executor aborted the function before we did
+		return nil, fmt.Errorf("Executor timed out: %w", context.DeadlineExceeded)
+	}
+
 	d := json.NewDecoder(resp.Body)
 	response := &executor.InvocationResult{}
 	err = d.Decode(response)
 	if err != nil {
-		return nil, waitDuration, fmt.Errorf("Parsing executor response failed: %v", err)
+		return nil, fmt.Errorf("Parsing executor response failed: %w", err)
 	}
 
-	return response, waitDuration, nil
-}
-
-func GetMemoryMB(id ContainerID) (int64, error) {
-	return cf.GetMemoryMB(id)
+	return response, nil
 }
 
 func Destroy(id ContainerID) error {
+	readinessTimes.Delete(id)
+	forgetExecutorClient(id)
 	return cf.Destroy(id)
 }
 
-func sendPostRequestWithRetries(url string, body *bytes.Buffer) (*http.Response, time.Duration, error) {
-	const TIMEOUT_MILLIS = 30000
-	const MAX_BACKOFF_MILLIS = 500
-	var backoffMillis = 25
-	var totalWaitMillis = 0
-	var attempts = 1
-	var err error
+// Pause suspends all the processes in the container.
+func Pause(id ContainerID) error {
+	return cf.Pause(id)
+}
+
+// Unpause resumes a paused container.
+func Unpause(id ContainerID) error {
+	return cf.Unpause(id)
+}
 
-	for totalWaitMillis < TIMEOUT_MILLIS {
-		resp, err := http.Post(url, "application/json", body)
+// IsPaused returns whether the container is paused, as reported by the
+// factory.
+func IsPaused(id ContainerID) (bool, error) {
+	info, err := cf.Inspect(id)
+	if err != nil {
+		return false, err
+	}
+	return info.State == STATE_PAUSED, nil
+}
+
+// Events subscribes to the termination events of the containers.
+func Events(ctx context.Context) (<-chan ContainerEvent, <-chan error) {
+	return cf.Events(ctx)
+}
+
+// waitForReadiness polls the readiness endpoint of the executor of a new
+// container until it reports to be ready, and returns the time spent. It
+// gives up when ctx is done, returning an error wrapping ctx.Err().
+func waitForReadiness(ctx context.Context, client *executorClient) (time.Duration, error) {
+	timeout := time.Duration(config.GetInt(config.CONTAINER_READINESS_TIMEOUT, 30)) * time.Second
+	interval := readinessMinInterval
+	t0 := clock.Now()
+	for {
+		resp, err := client.ready(ctx)
 		if err == nil {
-			return resp, time.Duration(totalWaitMillis * int(time.Millisecond)), err
-		} else if attempts > 3 {
-			// It is common to have a failure after a cold start, so
-			// we avoid logging failures on the first attempt(s)
-			log.Printf("Warning: Retrying POST to executor (attempts: %d): %v\n", attempts, err)
+			_ = resp.Body.Close()
+			// executors not implementing the readiness endpoint are
+			// ready as soon as they reply
+			if resp.StatusCode != http.StatusServiceUnavailable {
+				return clock.Since(t0), nil
+			}
+			err = fmt.Errorf("executor not ready")
+		}
+		if clock.Since(t0) > timeout {
+			return clock.Since(t0), fmt.Errorf("Executor not ready after %v: %v", timeout, err)
 		}
 
-		time.Sleep(time.Duration(backoffMillis * int(time.Millisecond)))
-		totalWaitMillis += backoffMillis
-		attempts += 1
-
-		if backoffMillis < MAX_BACKOFF_MILLIS {
-			backoffMillis = minInt(backoffMillis*2, MAX_BACKOFF_MILLIS)
+		select {
+		case <-ctx.Done():
+			return clock.Since(t0), fmt.Errorf("Executor not ready: %w", ctx.Err())
+		case <-time.After(interval):
+		}
+		if interval < readinessMaxInterval {
+			interval = minDuration(2*interval, readinessMaxInterval)
 		}
 	}
+}
 
-	return nil, time.Duration(totalWaitMillis * int(time.Millisecond)), err
+// ready sends a readiness request to the executor.
+func (c *executorClient) ready(ctx context.Context) (*http.Response, error) {
+	ctx, cancel := context.WithTimeout(ctx, readinessRequestTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+executor.READINESS_PATH, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.client.Do(req)
 }
 
-func minInt(a, b int) int {
+func minDuration(a, b time.Duration) time.Duration {
 	if a <= b {
 		return a
 	} else {
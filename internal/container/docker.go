@@ -6,17 +6,32 @@ import (
 	"io"
 	"log"
 	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/client"
+	"github.com/docker/go-connections/nat"
 	"github.com/grussorusso/serverledge/internal/config"
+	"github.com/grussorusso/serverledge/internal/executor"
 	//	"github.com/docker/docker/pkg/stdcopy"
 )
 
 type DockerFactory struct {
 	cli *client.Client
 	ctx context.Context
+	// user-defined networks known to exist
+	networks map[string]bool
+	// containers created by this run on each dedicated network, which is
+	// removed when none is left
+	networkUsers      map[string]int
+	containerNetworks map[ContainerID]string
+	networksLock      sync.Mutex
 }
 
 func InitDockerContainerFactory() *DockerFactory {
@@ -26,7 +41,13 @@ func InitDockerContainerFactory() *DockerFactory {
 		panic(err)
 	}
 
-	dockerFact := &DockerFactory{cli, ctx}
+	dockerFact := &DockerFactory{
+		cli:               cli,
+		ctx:               ctx,
+		networks:          make(map[string]bool),
+		networkUsers:      make(map[string]int),
+		containerNetworks: make(map[ContainerID]string),
+	}
 	cf = dockerFact
 	return dockerFact
 }
@@ -43,23 +64,64 @@ func (cf *DockerFactory) Create(image string, opts *ContainerOptions) (Container
 		contResources.CPUQuota = (int64)(50000.0 * opts.CPUQuota)
 	}
 
-	resp, err := cf.cli.ContainerCreate(cf.ctx, &container.Config{
-		Image: image,
-		Cmd:   opts.Cmd,
-		Env:   opts.Env,
-		Tty:   false,
-	}, &container.HostConfig{Resources: contResources}, nil, nil, "")
+	hostConfig := &container.HostConfig{Resources: contResources}
+	env := opts.Env
+	if opts.SocketDir != "" {
+		// the executor also listens on a socket in the mounted directory
+		hostConfig.Binds = []string{fmt.Sprintf("%s:%s", opts.SocketDir, EXECUTOR_SOCKET_MOUNT)}
+		// the executor may run as any user: it accesses the directory
+		// through its group
+		hostConfig.GroupAdd = []string{strconv.Itoa(opts.SocketGroup)}
+		env = append(env, fmt.Sprintf("%s=%s/%s", executor.ENV_SOCKET, EXECUTOR_SOCKET_MOUNT, EXECUTOR_SOCKET_NAME))
+	}
 
-	if err != nil {
-		return "", fmt.Errorf("failed to create container: %v", err)
+	labels := opts.Labels
+	if opts.DedicatedNetwork {
+		// the network is also found when destroying containers adopted
+		// after a restart
+		labels = make(map[string]string, len(opts.Labels)+1)
+		for key, value := range opts.Labels {
+			labels[key] = value
+		}
+		labels[LABEL_NETWORK] = opts.Network
+	}
+
+	contConfig := &container.Config{
+		Image:  image,
+		Cmd:    opts.Cmd,
+		Env:    env,
+		Tty:    false,
+		Labels: labels,
+	}
+	if opts.Network != "" {
+		if err := cf.ensureNetwork(opts.Network, opts.DedicatedNetwork); err != nil {
+			return "", err
+		}
+		hostConfig.NetworkMode = container.NetworkMode(opts.Network)
+	}
+	if opts.PublishExecutorPort {
+		// a free host port is chosen by Docker
+		contConfig.ExposedPorts = nat.PortSet{executorPort: struct{}{}}
+		hostConfig.PortBindings = nat.PortMap{executorPort: []nat.PortBinding{{HostIP: publishBindAddress()}}}
 	}
 
-	id := resp.ID
+	resp, err := cf.cli.ContainerCreate(cf.ctx, contConfig, hostConfig, nil, nil, "")
+	if opts.DedicatedNetwork {
+		if err != nil {
+			cf.releaseNetwork(opts.Network)
+		} else {
+			cf.networksLock.Lock()
+			cf.containerNetworks[resp.ID] = opts.Network
+			cf.networksLock.Unlock()
+		}
+	}
 
-	r, err := cf.cli.ContainerInspect(cf.ctx, id)
-	log.Printf("Container %s has name %s\n", id, r.Name)
+	if err != nil {
+		return "", fmt.Errorf("failed to create container: %v", err)
+	}
 
-	return id, err
+	log.Printf("Created container %s\n", resp.ID)
+	return resp.ID, nil
 }
 
 func (cf *DockerFactory) CopyToContainer(contID ContainerID, content io.Reader, destPath string) error {
@@ -75,9 +137,66 @@ func (cf *DockerFactory) Start(contID ContainerID) error {
 }
 
 func (cf *DockerFactory) Destroy(contID ContainerID) error {
+	cf.networksLock.Lock()
+	network, counted := cf.containerNetworks[contID]
+	delete(cf.containerNetworks, contID)
+	cf.networksLock.Unlock()
+	if !counted && config.GetString(config.CONTAINER_NETWORK_MODE, NETWORK_BRIDGE) == NETWORK_ISOLATED {
+		// the container may have been created by a previous run
+		if contJson, err := cf.cli.ContainerInspect(cf.ctx, contID); err == nil {
+			network = contJson.Config.Labels[LABEL_NETWORK]
+		}
+	}
+
 	// force set to true causes running container to be killed (and then
 	// removed)
-	return cf.cli.ContainerRemove(cf.ctx, contID, types.ContainerRemoveOptions{Force: true})
+	err := cf.cli.ContainerRemove(cf.ctx, contID, types.ContainerRemoveOptions{Force: true})
+	if counted {
+		cf.releaseNetwork(network)
+	} else if network != "" && err == nil {
+		cf.removeUnusedNetwork(network)
+	}
+	return err
+}
+
+func (cf *DockerFactory) Pause(contID ContainerID) error {
+	return cf.cli.ContainerPause(cf.ctx, contID)
+}
+
+func (cf *DockerFactory) Unpause(contID ContainerID) error {
+	return cf.cli.ContainerUnpause(cf.ctx, contID)
+}
+
+// Events subscribes to the termination events of the containers. The
+// subscription ends when ctx is done or an error is returned.
+func (cf *DockerFactory) Events(ctx context.Context) (<-chan ContainerEvent, <-chan error) {
+	args := filters.NewArgs(filters.Arg("type", events.ContainerEventType),
+		filters.Arg("event", EVENT_DIE),
+		filters.Arg("event", EVENT_OOM),
+		filters.Arg("event", EVENT_KILL))
+	messages, errs := cf.cli.Events(ctx, types.EventsOptions{Filters: args})
+
+	containerEvents := make(chan ContainerEvent)
+	go func() {
+		for {
+			select {
+			case msg := <-messages:
+				event := ContainerEvent{ID: msg.Actor.ID, Action: msg.Action}
+				if code, err := strconv.Atoi(msg.Actor.Attributes["exitCode"]); err == nil {
+					event.ExitCode = code
+				}
+				select {
+				case containerEvents <- event:
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return containerEvents, errs
 }
 
 func (cf *DockerFactory) HasImage(image string) bool {
@@ -116,18 +235,170 @@ func (cf *DockerFactory) PullImage(image string) error {
 	return nil
 }
 
-func (cf *DockerFactory) GetIPAddress(contID ContainerID) (string, error) {
+func (cf *DockerFactory) Inspect(contID ContainerID) (*ContainerInfo, error) {
 	contJson, err := cf.cli.ContainerInspect(cf.ctx, contID)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	info := &ContainerInfo{
+		ID:       contID,
+		MemoryMB: contJson.HostConfig.Memory / 1048576,
+		Image:    contJson.Config.Image,
+		State:    contJson.State.Status,
+		Labels:   contJson.Config.Labels,
 	}
-	return contJson.NetworkSettings.IPAddress, nil
+	info.IPAddress, info.ExecutorPort = executorAddress(&contJson)
+	if contJson.HostConfig.CPUPeriod > 0 {
+		info.CPUQuota = float64(contJson.HostConfig.CPUQuota) / float64(contJson.HostConfig.CPUPeriod)
+	}
+	info.Created, _ = time.Parse(time.RFC3339Nano, contJson.Created)
+	return info, nil
 }
 
-func (cf *DockerFactory) GetMemoryMB(contID ContainerID) (int64, error) {
-	contJson, err := cf.cli.ContainerInspect(cf.ctx, contID)
+// List returns the containers, in any state, having all the given labels.
+func (cf *DockerFactory) List(labels map[string]string) ([]*ContainerInfo, error) {
+	args := filters.NewArgs()
+	for key, value := range labels {
+		args.Add("label", fmt.Sprintf("%s=%s", key, value))
+	}
+	containers, err := cf.cli.ContainerList(cf.ctx, types.ContainerListOptions{All: true, Filters: args})
 	if err != nil {
-		return -1, err
+		return nil, err
+	}
+
+	infos := make([]*ContainerInfo, 0, len(containers))
+	for _, c := range containers {
+		info, err := cf.Inspect(c.ID)
+		if err != nil {
+			continue // the container has been removed in the meantime
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+// port of the executor within the containers
+var executorPort = nat.Port(fmt.Sprintf("%d/tcp", executor.DEFAULT_EXECUTOR_PORT))
+
+// executorAddress returns the address and port (0 = default port) where the
+// executor of a container is reached, according to its network settings.
+func executorAddress(contJson *types.ContainerJSON) (string, int) {
+	settings := contJson.NetworkSettings
+	if settings == nil {
+		return "", 0
+	}
+	if bindings := settings.Ports[executorPort]; len(bindings) > 0 {
+		if port, err := strconv.Atoi(bindings[0].HostPort); err == nil {
+			return publishHost(), port
+		}
+	}
+	if mode := contJson.HostConfig.NetworkMode; mode.IsUserDefined() {
+		if endpoint, ok := settings.Networks[mode.NetworkName()]; ok && endpoint != nil {
+			return endpoint.IPAddress, 0
+		}
+	}
+	return settings.IPAddress, 0
+}
+
+// ensureNetwork creates a user-defined network, unless it exists, and
+// connects the container of the node to it (if configured). A dedicated
+// network is not removed until releaseNetwork is called for the new
+// container.
+func (cf *DockerFactory) ensureNetwork(name string, dedicated bool) error {
+	// networks are created once, even by concurrent cold starts
+	cf.networksLock.Lock()
+	defer cf.networksLock.Unlock()
+	if cf.networks[name] {
+		if dedicated {
+			cf.networkUsers[name]++
+		}
+		return nil
+	}
+
+	_, err := cf.cli.NetworkInspect(cf.ctx, name, types.NetworkInspectOptions{})
+	if client.IsErrNotFound(err) {
+		_, err = cf.cli.NetworkCreate(cf.ctx, name, types.NetworkCreate{CheckDuplicate: true, Driver: "bridge"})
+		if err == nil {
+			log.Printf("Created network %s\n", name)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("could not create network %s: %v", name, err)
+	}
+
+	if self := config.GetString(config.CONTAINER_NETWORK_ATTACH, ""); self != "" {
+		selfJson, err := cf.cli.ContainerInspect(cf.ctx, self)
+		if err != nil {
+			return fmt.Errorf("could not inspect the container of the node: %v", err)
+		}
+		if _, connected := selfJson.NetworkSettings.Networks[name]; !connected {
+			if err := cf.cli.NetworkConnect(cf.ctx, name, self, nil); err != nil {
+				return fmt.Errorf("could not connect the node to network %s: %v", name, err)
+			}
+		}
+	}
+
+	cf.networks[name] = true
+	if dedicated {
+		cf.networkUsers[name]++
+	}
+	return nil
+}
+
+// releaseNetwork is called when a container created by this run on a
+// dedicated network is gone, removing the network if it was the last one.
+func (cf *DockerFactory) releaseNetwork(name string) {
+	cf.networksLock.Lock()
+	defer cf.networksLock.Unlock()
+	cf.networkUsers[name]--
+	if cf.networkUsers[name] > 0 {
+		return
+	}
+	delete(cf.networkUsers, name)
+	cf.removeNetworkLocked(name)
+}
+
+// removeUnusedNetwork removes a dedicated network if no container is using
+// it.
+func (cf *DockerFactory) removeUnusedNetwork(name string) {
+	cf.networksLock.Lock()
+	defer cf.networksLock.Unlock()
+	if cf.networkUsers[name] > 0 {
+		return
+	}
+	cf.removeNetworkLocked(name)
+}
+
+// removeNetworkLocked removes a dedicated network, unless containers that
+// were not created by this run (e.g., adopted ones) are still connected to it.
+// The lock of the networks must be held, so that no container is being
+// created on the network.
+func (cf *DockerFactory) removeNetworkLocked(name string) {
+	netJson, err := cf.cli.NetworkInspect(cf.ctx, name, types.NetworkInspectOptions{})
+	if client.IsErrNotFound(err) {
+		delete(cf.networks, name)
+		return
+	} else if err != nil {
+		log.Printf("Could not inspect network %s: %v\n", name, err)
+		return
+	}
+
+	self := config.GetString(config.CONTAINER_NETWORK_ATTACH, "")
+	for id, endpoint := range netJson.Containers {
+		if self == "" || (id != self && !strings.HasPrefix(id, self) && endpoint.Name != self) {
+			return // still in use
+		}
+	}
+	if self != "" && len(netJson.Containers) > 0 {
+		if err := cf.cli.NetworkDisconnect(cf.ctx, name, self, true); err != nil {
+			log.Printf("Could not disconnect the node from network %s: %v\n", name, err)
+			return
+		}
+	}
+	if err := cf.cli.NetworkRemove(cf.ctx, name); err != nil {
+		log.Printf("Could not remove network %s: %v\n", name, err)
+		return
 	}
-	return contJson.HostConfig.Memory / 1048576, nil
+	delete(cf.networks, name)
+	log.Printf("Removed network %s\n", name)
 }
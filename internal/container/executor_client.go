@@ -0,0 +1,142 @@
+package container
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/grussorusso/serverledge/internal/config"
+	"github.com/grussorusso/serverledge/internal/executor"
+	"github.com/lithammer/shortuuid"
+)
+
+// Directory where the executor socket directory is mounted in containers,
+// when executors are reached through Unix domain sockets.
+const EXECUTOR_SOCKET_MOUNT = "/run/serverledge"
+
+// Name of the executor socket in the mounted directory.
+const EXECUTOR_SOCKET_NAME = "executor.sock"
+
+const executorIdleConnTimeout = 5 * time.Minute
+
+// executorClient keeps the connections to the executor of a container.
+type executorClient struct {
+	client  *http.Client
+	baseURL string
+}
+
+// executor clients of the containers, indexed by container ID
+var executorClients sync.Map
+
+// host directories of the executor sockets, indexed by container ID
+var socketDirs sync.Map
+
+// newExecutorTransport returns a keep-alive transport keeping up to
+// concurrency connections to an executor. If socketPath is not empty,
+// connections are established through the Unix domain socket.
+func newExecutorTransport(socketPath string, concurrency int) *http.Transport {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	tr := &http.Transport{
+		MaxIdleConns:        concurrency,
+		MaxIdleConnsPerHost: concurrency,
+		IdleConnTimeout:     executorIdleConnTimeout,
+		DisableCompression:  true,
+	}
+	if socketPath != "" {
+		dialer := &net.Dialer{}
+		tr.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, "unix", socketPath)
+		}
+	}
+	return tr
+}
+
+// newExecutorClient creates the client for the executor of a container,
+// listening at addr (host:port) or, if not empty, at socketPath.
+func newExecutorClient(addr string, socketPath string, concurrency int) *executorClient {
+	if socketPath != "" {
+		// the host is ignored when dialing the socket
+		addr = "executor"
+	}
+	return &executorClient{
+		client:  &http.Client{Transport: newExecutorTransport(socketPath, concurrency)},
+		baseURL: fmt.Sprintf("http://%s", addr),
+	}
+}
+
+// socketDirFor returns the host directory to mount in a new container for
+// the executor socket, or an empty string if sockets are not used. The
+// directory is only accessible to the node user and to the socket group,
+// which new files (i.e., the socket) inherit.
+func socketDirFor(opts *ContainerOptions) (string, error) {
+	if !config.GetBool(config.EXECUTOR_UNIX_SOCKET, false) {
+		return "", nil
+	}
+	baseDir := config.GetString(config.EXECUTOR_SOCKET_DIR, filepath.Join(os.TempDir(), "serverledge"))
+	if err := os.MkdirAll(baseDir, 0700); err != nil {
+		return "", fmt.Errorf("could not create the executor socket directory: %v", err)
+	}
+	dir := filepath.Join(baseDir, shortuuid.New())
+	if err := os.Mkdir(dir, 0770); err != nil {
+		return "", fmt.Errorf("could not create the executor socket directory: %v", err)
+	}
+	opts.SocketGroup = config.GetInt(config.EXECUTOR_SOCKET_GROUP, os.Getegid())
+	err := os.Chown(dir, -1, opts.SocketGroup)
+	if err == nil {
+		err = os.Chmod(dir, 0770|os.ModeSetgid)
+	}
+	if err != nil {
+		_ = os.Remove(dir)
+		return "", fmt.Errorf("could not set the permissions of the executor socket directory: %v", err)
+	}
+	return dir, nil
+}
+
+// registerExecutorClient creates the client for the executor of a new
+// container.
+func registerExecutorClient(info *ContainerInfo, opts *ContainerOptions) *executorClient {
+	var c *executorClient
+	if p, ok := cf.(ExecutorTransportProvider); ok {
+		c = &executorClient{
+			client:  &http.Client{Transport: p.ExecutorTransport(info)},
+			baseURL: fmt.Sprintf("http://%s", info.ID),
+		}
+	} else if opts.SocketDir != "" {
+		c = newExecutorClient("", filepath.Join(opts.SocketDir, EXECUTOR_SOCKET_NAME), opts.Concurrency)
+	} else {
+		port := info.ExecutorPort
+		if port == 0 {
+			port = executor.DEFAULT_EXECUTOR_PORT
+		}
+		c = newExecutorClient(net.JoinHostPort(info.IPAddress, strconv.Itoa(port)), "", opts.Concurrency)
+	}
+	executorClients.Store(info.ID, c)
+	return c
+}
+
+// getExecutorClient returns the client for the executor of a container.
+func getExecutorClient(contID ContainerID) (*executorClient, error) {
+	if c, ok := executorClients.Load(contID); ok {
+		return c.(*executorClient), nil
+	}
+	return nil, fmt.Errorf("unknown container %s", contID)
+}
+
+// forgetExecutorClient closes the connections to the executor of a container
+// being destroyed, and removes its socket directory.
+func forgetExecutorClient(contID ContainerID) {
+	if c, ok := executorClients.LoadAndDelete(contID); ok {
+		c.(*executorClient).client.CloseIdleConnections()
+	}
+	if dir, ok := socketDirs.LoadAndDelete(contID); ok {
+		_ = os.RemoveAll(dir.(string))
+	}
+}
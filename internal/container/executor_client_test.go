@@ -0,0 +1,147 @@
+package container
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/grussorusso/serverledge/internal/executor"
+)
+
+// concurrent invocations sent to the executor in the benchmarks
+const benchConcurrency = 16
+
+// countConnections counts the connections accepted by server, which must
+// not be started yet.
+func countConnections(server *httptest.Server) *int64 {
+	var conns int64
+	server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt64(&conns, 1)
+		}
+	}
+	return &conns
+}
+
+// fakeExecutor replies to invocations with a constant result.
+func fakeExecutor() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/invoke", func(w http.ResponseWriter, r *http.Request) {
+		req := &executor.InvocationRequest{}
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(&executor.InvocationResult{Success: true, Result: "42"})
+	})
+	mux.HandleFunc(executor.READINESS_PATH, executor.ReadyHandler)
+	return mux
+}
+
+// startUnixExecutor creates a fake executor listening on a Unix domain
+// socket (the server must be started by the caller).
+func startUnixExecutor(t testing.TB) (*httptest.Server, string) {
+	socketPath := filepath.Join(t.TempDir(), EXECUTOR_SOCKET_NAME)
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatalf("could not listen on %s: %v", socketPath, err)
+	}
+	server := httptest.NewUnstartedServer(fakeExecutor())
+	server.Listener = listener
+	return server, socketPath
+}
+
+// useClient registers c as the executor client of a fake container.
+func useClient(t testing.TB, c *executorClient) ContainerID {
+	contID := ContainerID(strings.ReplaceAll(t.Name(), "/", "-"))
+	executorClients.Store(contID, c)
+	t.Cleanup(func() { forgetExecutorClient(contID) })
+	return contID
+}
+
+func TestExecuteUnixSocket(t *testing.T) {
+	server, socketPath := startUnixExecutor(t)
+	server.Start()
+	defer server.Close()
+
+	c := newExecutorClient("", socketPath, 1)
+	if _, err := waitForReadiness(context.Background(), c); err != nil {
+		t.Fatalf("executor not ready: %v", err)
+	}
+
+	contID := useClient(t, c)
+	result, err := Execute(context.Background(), contID, &executor.InvocationRequest{})
+	if err != nil {
+		t.Fatalf("execution failed: %v", err)
+	}
+	if !result.Success || result.Result != "42" {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+}
+
+// benchmarkExecute measures the time per invocation with benchConcurrency
+// concurrent invocations, and the connections opened per invocation.
+func benchmarkExecute(b *testing.B, c *executorClient, conns *int64) {
+	contID := useClient(b, c)
+	req := &executor.InvocationRequest{Params: map[string]interface{}{"n": 17}}
+
+	b.ResetTimer()
+	var wg sync.WaitGroup
+	for w := 0; w < benchConcurrency; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := w; i < b.N; i += benchConcurrency {
+				if _, err := Execute(context.Background(), contID, req); err != nil {
+					b.Error(err)
+					return
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	b.ReportMetric(float64(atomic.LoadInt64(conns))/float64(b.N), "conns/op")
+}
+
+// BenchmarkExecuteDefaultClient uses a client configured as
+// http.DefaultClient, which was used before per-container pools.
+func BenchmarkExecuteDefaultClient(b *testing.B) {
+	server := httptest.NewUnstartedServer(fakeExecutor())
+	conns := countConnections(server)
+	server.Start()
+	defer server.Close()
+
+	c := &executorClient{
+		client:  &http.Client{Transport: http.DefaultTransport.(*http.Transport).Clone()},
+		baseURL: server.URL,
+	}
+	benchmarkExecute(b, c, conns)
+}
+
+func BenchmarkExecutePooledTCP(b *testing.B) {
+	server := httptest.NewUnstartedServer(fakeExecutor())
+	conns := countConnections(server)
+	server.Start()
+	defer server.Close()
+
+	c := newExecutorClient(server.Listener.Addr().String(), "", benchConcurrency)
+	benchmarkExecute(b, c, conns)
+}
+
+func BenchmarkExecuteUnixSocket(b *testing.B) {
+	server, socketPath := startUnixExecutor(b)
+	conns := countConnections(server)
+	server.Start()
+	defer server.Close()
+
+	c := newExecutorClient("", socketPath, benchConcurrency)
+	benchmarkExecute(b, c, conns)
+}
@@ -1,7 +1,13 @@
 package container
 
 import (
+	"context"
 	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/grussorusso/serverledge/internal/config"
 )
 
 // A Factory to create and manage container.
@@ -12,26 +18,129 @@ type Factory interface {
 	Destroy(ContainerID) error
 	HasImage(string) bool
 	PullImage(string) error
-	GetIPAddress(ContainerID) (string, error)
-	GetMemoryMB(id ContainerID) (int64, error)
+	Inspect(ContainerID) (*ContainerInfo, error)
+	Pause(ContainerID) error
+	Unpause(ContainerID) error
+	Events(context.Context) (<-chan ContainerEvent, <-chan error)
+	List(labels map[string]string) ([]*ContainerInfo, error)
+}
+
+// ContainerEvent notifies the termination of a container (or the kernel
+// killing one of its processes because of memory exhaustion).
+type ContainerEvent struct {
+	ID       ContainerID
+	Action   string // EVENT_DIE, EVENT_OOM or EVENT_KILL
+	ExitCode int    // only for EVENT_DIE
 }
 
+const (
+	EVENT_DIE  = "die"
+	EVENT_OOM  = "oom"
+	EVENT_KILL = "kill"
+)
+
 // ContainerOptions contains options for container creation.
 type ContainerOptions struct {
 	Cmd      []string
 	Env      []string
 	MemoryMB int64
 	CPUQuota float64
+	// max number of concurrent invocations, i.e., connections to the executor
+	Concurrency int
+	// host directory mounted at EXECUTOR_SOCKET_MOUNT for the executor
+	// socket (set by NewContainer if Unix domain sockets are enabled)
+	SocketDir string
+	// group owning SocketDir, added to the processes of the container
+	SocketGroup int
+	Labels      map[string]string
+	// user-defined network the container is attached to, created if
+	// needed ("" = default bridge network)
+	Network string
+	// Network only serves the containers of a function, and it is removed
+	// with the last of them
+	DedicatedNetwork bool
+	// the executor port is published on a host port, through which the
+	// executor is reached
+	PublishExecutorPort bool
 }
 
+// Labels attached by the node to its containers, so that they can be
+// recognized after a restart.
+const (
+	LABEL_OWNER       = "serverledge.owner"     // node owning the container
+	LABEL_INSTANCE    = "serverledge.instance"  // run of the node that created the container
+	LABEL_FUNCTION    = "serverledge.function"  // function served by the container
+	LABEL_CODE_DIGEST = "serverledge.digest"    // digest of the function code
+	LABEL_SOCKET_DIR  = "serverledge.socketdir" // host directory of the executor socket
+	LABEL_NETWORK     = "serverledge.network"   // dedicated network of the container
+)
+
+// States of the containers reported by the factory.
+const (
+	STATE_CREATED = "created"
+	STATE_RUNNING = "running"
+	STATE_PAUSED  = "paused"
+	STATE_EXITED  = "exited"
+)
+
 type ContainerID = string
 
+// ContainerInfo describes a started container. It is retrieved once, when the
+// container is created, so that the node never inspects containers again.
+type ContainerInfo struct {
+	ID           ContainerID
+	IPAddress    string
+	ExecutorPort int     // 0 if the executor listens on executor.DEFAULT_EXECUTOR_PORT
+	MemoryMB     int64   // memory limit
+	CPUQuota     float64 // CPU limit (0 = unlimited)
+	Image        string
+	Created      time.Time
+	State        string // as reported by the factory (e.g., STATE_RUNNING)
+	Labels       map[string]string
+}
+
 // cf is the container factory for the node
 var cf Factory
 
+// Container factories that can be selected in the configuration.
+const (
+	DOCKER_FACTORY  = "docker"
+	PROCESS_FACTORY = "process"
+)
+
+// InitContainerFactory initializes the container factory selected in the
+// configuration, unless a factory has already been set (e.g., by a
+// simulation).
+func InitContainerFactory() Factory {
+	if cf != nil {
+		return cf
+	}
+	switch name := config.GetString(config.CONTAINER_FACTORY, DOCKER_FACTORY); name {
+	case PROCESS_FACTORY:
+		return InitProcessContainerFactory()
+	case DOCKER_FACTORY:
+	default:
+		log.Printf("Unknown container factory '%s': using %s\n", name, DOCKER_FACTORY)
+	}
+	return InitDockerContainerFactory()
+}
+
 func DownloadImage(image string, forceRefresh bool) error {
 	if forceRefresh || !cf.HasImage(image) {
 		return cf.PullImage(image)
 	}
 	return nil
 }
+
+// ExecutorTransportProvider is implemented by factories whose executors are
+// not reached through the network (e.g., simulated ones).
+type ExecutorTransportProvider interface {
+	// ExecutorTransport returns the transport for the requests to the
+	// executor of a container.
+	ExecutorTransport(info *ContainerInfo) http.RoundTripper
+}
+
+// SetFactory sets the container factory for the node.
+func SetFactory(f Factory) {
+	cf = f
+}
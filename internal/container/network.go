@@ -0,0 +1,74 @@
+package container
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"net"
+	"regexp"
+	"sync"
+
+	"github.com/grussorusso/serverledge/internal/config"
+)
+
+// Network modes of the containers.
+const (
+	NETWORK_BRIDGE   = "bridge"   // default bridge network
+	NETWORK_NAMED    = "named"    // user-defined network shared by all the containers
+	NETWORK_ISOLATED = "isolated" // user-defined network for each function
+	NETWORK_PUBLISH  = "publish"  // executor port published on the host
+)
+
+// name (or prefix of the names) of the user-defined networks
+const defaultNetworkName = "serverledge"
+
+// host where published executor ports are reached by default
+const defaultPublishHost = "127.0.0.1"
+
+// characters not allowed in Docker network names
+var invalidNetworkChars = regexp.MustCompile(`[^a-zA-Z0-9_.-]`)
+
+var unknownNetworkMode sync.Once
+
+// SetNetworkOptions sets the network options of a new container serving the
+// given function, according to the configured network mode.
+func SetNetworkOptions(opts *ContainerOptions, functionName string) {
+	name := config.GetString(config.CONTAINER_NETWORK_NAME, defaultNetworkName)
+	switch mode := config.GetString(config.CONTAINER_NETWORK_MODE, NETWORK_BRIDGE); mode {
+	case NETWORK_NAMED:
+		opts.Network = name
+	case NETWORK_ISOLATED:
+		opts.Network = functionNetworkName(name, functionName)
+		opts.DedicatedNetwork = true
+	case NETWORK_PUBLISH:
+		opts.PublishExecutorPort = true
+	case NETWORK_BRIDGE, "":
+	default:
+		unknownNetworkMode.Do(func() {
+			log.Printf("Unknown network mode '%s': using %s\n", mode, NETWORK_BRIDGE)
+		})
+	}
+}
+
+// functionNetworkName returns the name of the network of a function in
+// isolated mode. Invalid characters are replaced, hence a digest of the
+// function name keeps the names of different functions distinct.
+func functionNetworkName(prefix string, functionName string) string {
+	digest := sha256.Sum256([]byte(functionName))
+	return prefix + "-" + invalidNetworkChars.ReplaceAllString(functionName, "_") + "-" + hex.EncodeToString(digest[:4])
+}
+
+// publishHost returns the address of the host where published executor
+// ports are reached.
+func publishHost() string {
+	return config.GetString(config.CONTAINER_NETWORK_HOST, defaultPublishHost)
+}
+
+// publishBindAddress returns the host address executor ports are published
+// on: the loopback interface only if executors are reached through it.
+func publishBindAddress() string {
+	if ip := net.ParseIP(publishHost()); ip != nil && ip.IsLoopback() {
+		return ip.String()
+	}
+	return ""
+}
@@ -0,0 +1,78 @@
+package container
+
+import (
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/go-connections/nat"
+	"github.com/grussorusso/serverledge/internal/config"
+	"github.com/spf13/viper"
+)
+
+func TestSetNetworkOptions(t *testing.T) {
+	for _, key := range []string{config.CONTAINER_NETWORK_MODE, config.CONTAINER_NETWORK_NAME} {
+		key, prev := key, viper.Get(key)
+		t.Cleanup(func() { viper.Set(key, prev) })
+	}
+	viper.Set(config.CONTAINER_NETWORK_NAME, "sl")
+
+	cases := []struct {
+		mode      string
+		network   string
+		dedicated bool
+		publish   bool
+	}{
+		{"", "", false, false},
+		{NETWORK_BRIDGE, "", false, false},
+		{NETWORK_NAMED, "sl", false, false},
+		{NETWORK_ISOLATED, "sl-my_func.v2-735b6bdf", true, false},
+		{NETWORK_PUBLISH, "", false, true},
+	}
+	for _, c := range cases {
+		viper.Set(config.CONTAINER_NETWORK_MODE, c.mode)
+		opts := &ContainerOptions{}
+		SetNetworkOptions(opts, "my/func.v2")
+		if opts.Network != c.network || opts.DedicatedNetwork != c.dedicated || opts.PublishExecutorPort != c.publish {
+			t.Errorf("mode %q: unexpected options %+v", c.mode, opts)
+		}
+	}
+
+	// names differing in invalid characters only get distinct networks
+	if functionNetworkName("sl", "a/b") == functionNetworkName("sl", "a_b") {
+		t.Errorf("functions a/b and a_b share the same network")
+	}
+}
+
+func TestExecutorAddress(t *testing.T) {
+	inspect := func(mode string, settings *types.NetworkSettings) *types.ContainerJSON {
+		return &types.ContainerJSON{
+			ContainerJSONBase: &types.ContainerJSONBase{HostConfig: &container.HostConfig{NetworkMode: container.NetworkMode(mode)}},
+			NetworkSettings:   settings,
+		}
+	}
+
+	bridge := &types.NetworkSettings{DefaultNetworkSettings: types.DefaultNetworkSettings{IPAddress: "172.17.0.2"}}
+	if addr, port := executorAddress(inspect("default", bridge)); addr != "172.17.0.2" || port != 0 {
+		t.Errorf("default bridge: got %s:%d", addr, port)
+	}
+
+	named := &types.NetworkSettings{Networks: map[string]*network.EndpointSettings{"sl": {IPAddress: "10.1.0.3"}}}
+	if addr, port := executorAddress(inspect("sl", named)); addr != "10.1.0.3" || port != 0 {
+		t.Errorf("user-defined network: got %s:%d", addr, port)
+	}
+
+	viper.Set(config.CONTAINER_NETWORK_HOST, "192.168.1.5")
+	defer viper.Set(config.CONTAINER_NETWORK_HOST, nil)
+	published := &types.NetworkSettings{
+		NetworkSettingsBase:    types.NetworkSettingsBase{Ports: nat.PortMap{executorPort: {{HostIP: "0.0.0.0", HostPort: "49153"}}}},
+		DefaultNetworkSettings: types.DefaultNetworkSettings{IPAddress: "172.17.0.2"},
+	}
+	if addr, port := executorAddress(inspect("default", published)); addr != "192.168.1.5" || port != 49153 {
+		t.Errorf("published port: got %s:%d", addr, port)
+	}
+	if bind := publishBindAddress(); bind != "" {
+		t.Errorf("ports of a non-loopback host bound to %q", bind)
+	}
+}
@@ -0,0 +1,391 @@
+package container
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grussorusso/serverledge/internal/config"
+	"github.com/grussorusso/serverledge/internal/executor"
+	"github.com/grussorusso/serverledge/utils"
+	"github.com/lithammer/shortuuid"
+)
+
+// Variables inherited by executors from the environment of the node, needed
+// to find and run the runtimes. The rest of the environment (e.g., the
+// credentials of the node) is not exposed to functions.
+var inheritedEnv = []string{"PATH", "LANG", "LC_ALL", "SYSTEMROOT"}
+
+// ProcessFactory runs the executor of each container as a local process, so
+// that nodes do not need Docker. Each container gets its own working
+// directory, where the function code is extracted, and a loopback port for
+// the executor. On Linux, memory and CPU limits are enforced through cgroup
+// v2, if available.
+type ProcessFactory struct {
+	sync.Mutex
+	dir         string // parent of the working directories
+	cgroup      string // parent cgroup; empty if limits are not enforced
+	sandboxes   map[ContainerID]*sandbox
+	subscribers map[*eventSubscriber]struct{}
+}
+
+// sandbox is a container of the process factory.
+type sandbox struct {
+	info    ContainerInfo
+	dir     string
+	command []string
+	opts    ContainerOptions
+	cgroup  string
+	cmd     *exec.Cmd     // set once started
+	exited  chan struct{} // closed when the executor process terminates
+}
+
+type eventSubscriber struct {
+	ctx    context.Context
+	events chan ContainerEvent
+}
+
+// the executor of process-based containers only listens on the loopback
+// interface
+const loopbackAddress = "127.0.0.1"
+
+func InitProcessContainerFactory() *ProcessFactory {
+	dir := config.GetString(config.PROCESS_FACTORY_DIR, filepath.Join(os.TempDir(), "serverledge-sandboxes"))
+	// working directories left by a previous run are removed
+	if err := os.RemoveAll(dir); err != nil {
+		log.Printf("Could not clean up %s: %v\n", dir, err)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		panic(err)
+	}
+
+	pf := &ProcessFactory{
+		dir:         dir,
+		cgroup:      initCgroup(config.GetString(config.PROCESS_FACTORY_CGROUP, defaultCgroupParent)),
+		sandboxes:   make(map[ContainerID]*sandbox),
+		subscribers: make(map[*eventSubscriber]struct{}),
+	}
+	cf = pf
+	log.Printf("Process container factory initialized (directory: %s, cgroup: %q)\n", dir, pf.cgroup)
+	return pf
+}
+
+// executorCommand returns the command starting the executor for an image:
+// the command configured for its runtime, if any, or the default one.
+func executorCommand(image string) []string {
+	command := config.GetString(config.PROCESS_FACTORY_EXECUTOR, "executor")
+	for runtime, info := range RuntimeToInfo {
+		if info.Image == image {
+			command = config.GetString(config.PROCESS_FACTORY_RUNTIMES+"."+runtime, command)
+			break
+		}
+	}
+	return strings.Fields(command)
+}
+
+// freeLoopbackPort returns a TCP port that is currently free on the loopback
+// interface.
+func freeLoopbackPort() (int, error) {
+	listener, err := net.Listen("tcp", net.JoinHostPort(loopbackAddress, "0"))
+	if err != nil {
+		return 0, err
+	}
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port, nil
+}
+
+func (pf *ProcessFactory) getSandbox(contID ContainerID) (*sandbox, error) {
+	pf.Lock()
+	defer pf.Unlock()
+	s, ok := pf.sandboxes[contID]
+	if !ok {
+		return nil, fmt.Errorf("no such container: %s", contID)
+	}
+	return s, nil
+}
+
+func (pf *ProcessFactory) Create(image string, opts *ContainerOptions) (ContainerID, error) {
+	command := executorCommand(image)
+	if len(command) == 0 {
+		return "", fmt.Errorf("no executor command configured for image %s", image)
+	}
+
+	contID := shortuuid.New()
+	dir := filepath.Join(pf.dir, contID)
+	for _, d := range []string{dir, filepath.Join(dir, "app"), filepath.Join(dir, "tmp")} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			_ = os.RemoveAll(dir)
+			return "", fmt.Errorf("failed to create container: %v", err)
+		}
+	}
+
+	s := &sandbox{
+		info: ContainerInfo{
+			ID:        contID,
+			IPAddress: loopbackAddress,
+			MemoryMB:  opts.MemoryMB,
+			CPUQuota:  opts.CPUQuota,
+			Image:     image,
+			Created:   time.Now(),
+			State:     STATE_CREATED,
+			Labels:    opts.Labels,
+		},
+		dir:     dir,
+		command: command,
+		opts:    *opts,
+		exited:  make(chan struct{}),
+	}
+	pf.Lock()
+	pf.sandboxes[contID] = s
+	pf.Unlock()
+
+	log.Printf("Created container %s\n", contID)
+	return contID, nil
+}
+
+// CopyToContainer extracts a tar archive in the working directory of the
+// container.
+func (pf *ProcessFactory) CopyToContainer(contID ContainerID, content io.Reader, destPath string) error {
+	s, err := pf.getSandbox(contID)
+	if err != nil {
+		return err
+	}
+	return utils.Untar(content, filepath.Join(s.dir, destPath))
+}
+
+func (pf *ProcessFactory) Start(contID ContainerID) error {
+	s, err := pf.getSandbox(contID)
+	if err != nil {
+		return err
+	}
+	port, err := freeLoopbackPort()
+	if err != nil {
+		return err
+	}
+	cgroup, err := createCgroup(pf.cgroup, contID, &s.opts)
+	if err != nil {
+		return fmt.Errorf("could not create the cgroup of %s: %v", contID, err)
+	}
+
+	cmd := exec.Command(s.command[0], s.command[1:]...)
+	cmd.Dir = s.dir
+	cmd.Env = executorEnv(s.dir)
+	cmd.Env = append(cmd.Env, s.opts.Env...)
+	cmd.Env = append(cmd.Env,
+		fmt.Sprintf("%s=%s", executor.ENV_EXECUTOR_HOST, loopbackAddress),
+		fmt.Sprintf("%s=%d", executor.ENV_EXECUTOR_PORT, port),
+		fmt.Sprintf("%s=%s", executor.ENV_HANDLER_DIR, filepath.Join(s.dir, "app")),
+		fmt.Sprintf("%s=%s", executor.ENV_TMP_DIR, filepath.Join(s.dir, "tmp")),
+		fmt.Sprintf("TMPDIR=%s", filepath.Join(s.dir, "tmp")))
+	if s.opts.SocketDir != "" {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", executor.ENV_SOCKET, filepath.Join(s.opts.SocketDir, EXECUTOR_SOCKET_NAME)))
+	}
+
+	logFile, err := os.Create(filepath.Join(s.dir, "executor.log"))
+	if err != nil {
+		removeCgroup(cgroup)
+		return err
+	}
+	defer logFile.Close()
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+
+	cgroupFile, err := configureProcess(cmd, cgroup)
+	if err != nil {
+		removeCgroup(cgroup)
+		return err
+	}
+	// the parent-death signal is bound to the thread starting the process,
+	// which must not change while the process is being started
+	runtime.LockOSThread()
+	err = cmd.Start()
+	runtime.UnlockOSThread()
+	if cgroupFile != nil {
+		_ = cgroupFile.Close()
+	}
+	if err != nil {
+		removeCgroup(cgroup)
+		return fmt.Errorf("could not start the executor of %s: %v", contID, err)
+	}
+
+	pf.Lock()
+	s.cmd = cmd
+	s.cgroup = cgroup
+	s.info.ExecutorPort = port
+	s.info.State = STATE_RUNNING
+	pf.Unlock()
+
+	go pf.wait(s)
+	return nil
+}
+
+// executorEnv returns the minimal environment of an executor running in dir.
+func executorEnv(dir string) []string {
+	env := []string{fmt.Sprintf("HOME=%s", dir)}
+	for _, key := range inheritedEnv {
+		if value, ok := os.LookupEnv(key); ok {
+			env = append(env, fmt.Sprintf("%s=%s", key, value))
+		}
+	}
+	return env
+}
+
+// wait notifies the termination of the executor process of a container.
+func (pf *ProcessFactory) wait(s *sandbox) {
+	_ = s.cmd.Wait()
+	exitCode := s.cmd.ProcessState.ExitCode()
+	oom := oomKilled(s.cgroup)
+
+	pf.Lock()
+	s.info.State = STATE_EXITED
+	pf.Unlock()
+	close(s.exited)
+
+	if oom {
+		pf.emit(ContainerEvent{ID: s.info.ID, Action: EVENT_OOM})
+	}
+	pf.emit(ContainerEvent{ID: s.info.ID, Action: EVENT_DIE, ExitCode: exitCode})
+}
+
+// Destroy kills the processes of the container and removes its working
+// directory.
+func (pf *ProcessFactory) Destroy(contID ContainerID) error {
+	pf.Lock()
+	s, ok := pf.sandboxes[contID]
+	delete(pf.sandboxes, contID)
+	pf.Unlock()
+	if !ok {
+		return fmt.Errorf("no such container: %s", contID)
+	}
+
+	if s.cmd != nil {
+		select {
+		case <-s.exited:
+		default:
+			if err := killProcess(s.cmd); err != nil {
+				log.Printf("Could not kill the executor of %s: %v\n", contID, err)
+			}
+			<-s.exited
+		}
+	}
+	removeCgroup(s.cgroup)
+	return os.RemoveAll(s.dir)
+}
+
+func (pf *ProcessFactory) Pause(contID ContainerID) error {
+	return pf.setRunning(contID, false)
+}
+
+func (pf *ProcessFactory) Unpause(contID ContainerID) error {
+	return pf.setRunning(contID, true)
+}
+
+// setRunning suspends or resumes the processes of a container.
+func (pf *ProcessFactory) setRunning(contID ContainerID, running bool) error {
+	s, err := pf.getSandbox(contID)
+	if err != nil {
+		return err
+	}
+	pf.Lock()
+	defer pf.Unlock()
+	if s.cmd == nil || s.info.State == STATE_EXITED {
+		return fmt.Errorf("container %s is not running", contID)
+	}
+	if running {
+		err = resumeProcess(s.cmd)
+		s.info.State = STATE_RUNNING
+	} else {
+		err = pauseProcess(s.cmd)
+		s.info.State = STATE_PAUSED
+	}
+	return err
+}
+
+// HasImage returns true if an executor command is configured for the image.
+func (pf *ProcessFactory) HasImage(image string) bool {
+	return len(executorCommand(image)) > 0
+}
+
+func (pf *ProcessFactory) PullImage(image string) error {
+	return fmt.Errorf("images cannot be pulled by the process factory: %s", image)
+}
+
+func (pf *ProcessFactory) Inspect(contID ContainerID) (*ContainerInfo, error) {
+	s, err := pf.getSandbox(contID)
+	if err != nil {
+		return nil, err
+	}
+	pf.Lock()
+	defer pf.Unlock()
+	info := s.info
+	return &info, nil
+}
+
+// Events subscribes to the termination events of the containers. The
+// subscription ends when ctx is done.
+func (pf *ProcessFactory) Events(ctx context.Context) (<-chan ContainerEvent, <-chan error) {
+	sub := &eventSubscriber{ctx: ctx, events: make(chan ContainerEvent)}
+	pf.Lock()
+	pf.subscribers[sub] = struct{}{}
+	pf.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		pf.Lock()
+		delete(pf.subscribers, sub)
+		pf.Unlock()
+	}()
+	return sub.events, make(chan error)
+}
+
+func (pf *ProcessFactory) emit(event ContainerEvent) {
+	pf.Lock()
+	subscribers := make([]*eventSubscriber, 0, len(pf.subscribers))
+	for sub := range pf.subscribers {
+		subscribers = append(subscribers, sub)
+	}
+	pf.Unlock()
+
+	for _, sub := range subscribers {
+		select {
+		case sub.events <- event:
+		case <-sub.ctx.Done():
+		}
+	}
+}
+
+// List returns the containers having all the given labels. Containers do not
+// survive the node, hence only containers of the current run are returned.
+func (pf *ProcessFactory) List(labels map[string]string) ([]*ContainerInfo, error) {
+	pf.Lock()
+	defer pf.Unlock()
+	infos := make([]*ContainerInfo, 0)
+	for _, s := range pf.sandboxes {
+		matching := true
+		for key, value := range labels {
+			matching = matching && s.info.Labels[key] == value
+		}
+		if matching {
+			info := s.info
+			infos = append(infos, &info)
+		}
+	}
+	return infos, nil
+}
+
+// cpu.max period (as for Docker containers)
+const cgroupCPUPeriod = 50000
+
+func cgroupCPUMax(cpuQuota float64) string {
+	return strconv.FormatInt(int64(cgroupCPUPeriod*cpuQuota), 10) + " " + strconv.Itoa(cgroupCPUPeriod)
+}
@@ -0,0 +1,153 @@
+//go:build linux
+
+package container
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const defaultCgroupParent = "/sys/fs/cgroup/serverledge"
+
+// initCgroup prepares the parent cgroup of the containers, returning an
+// empty string if limits cannot be enforced.
+func initCgroup(parent string) string {
+	if parent == "" {
+		return ""
+	}
+	if _, err := os.Stat("/sys/fs/cgroup/cgroup.controllers"); err != nil {
+		log.Printf("cgroup v2 is not available: container limits are not enforced\n")
+		return ""
+	}
+	if err := os.MkdirAll(parent, 0755); err != nil {
+		log.Printf("Could not create cgroup %s: %v (container limits are not enforced)\n", parent, err)
+		return ""
+	}
+
+	// cgroups left by a previous run are removed, killing their processes
+	entries, _ := os.ReadDir(parent)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			removeCgroup(filepath.Join(parent, entry.Name()))
+		}
+	}
+
+	if err := os.WriteFile(filepath.Join(parent, "cgroup.subtree_control"), []byte("+cpu +memory"), 0644); err != nil {
+		log.Printf("Could not enable the cpu and memory controllers in %s: %v (container limits are not enforced)\n", parent, err)
+		return ""
+	}
+	return parent
+}
+
+// createCgroup creates the cgroup of a container, setting its limits.
+func createCgroup(parent string, contID ContainerID, opts *ContainerOptions) (string, error) {
+	if parent == "" {
+		return "", nil
+	}
+	cgroup := filepath.Join(parent, contID)
+	if err := os.Mkdir(cgroup, 0755); err != nil {
+		return "", err
+	}
+
+	var err error
+	if opts.MemoryMB > 0 {
+		err = os.WriteFile(filepath.Join(cgroup, "memory.max"), []byte(strconv.FormatInt(opts.MemoryMB*1048576, 10)), 0644)
+		// as for Docker containers, the memory limit also applies to swap
+		_ = os.WriteFile(filepath.Join(cgroup, "memory.swap.max"), []byte("0"), 0644)
+	}
+	if err == nil && opts.CPUQuota > 0.0 {
+		err = os.WriteFile(filepath.Join(cgroup, "cpu.max"), []byte(cgroupCPUMax(opts.CPUQuota)), 0644)
+	}
+	if err != nil {
+		removeCgroup(cgroup)
+		return "", err
+	}
+	return cgroup, nil
+}
+
+// removeCgroup kills the processes left in a cgroup and removes it.
+func removeCgroup(cgroup string) {
+	if cgroup == "" {
+		return
+	}
+	if err := os.WriteFile(filepath.Join(cgroup, "cgroup.kill"), []byte("1"), 0644); err != nil {
+		// cgroup.kill is only available since Linux 5.14
+		content, _ := os.ReadFile(filepath.Join(cgroup, "cgroup.procs"))
+		for _, pid := range strings.Fields(string(content)) {
+			if p, err := strconv.Atoi(pid); err == nil {
+				_ = syscall.Kill(p, syscall.SIGKILL)
+			}
+		}
+	}
+
+	// the cgroup can be removed once its processes have terminated
+	for i := 0; i < 100; i++ {
+		if err := syscall.Rmdir(cgroup); err == nil || os.IsNotExist(err) {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	log.Printf("Could not remove cgroup %s\n", cgroup)
+}
+
+// oomKilled returns true if the kernel killed a process of the cgroup
+// because of memory exhaustion.
+func oomKilled(cgroup string) bool {
+	if cgroup == "" {
+		return false
+	}
+	content, err := os.ReadFile(filepath.Join(cgroup, "memory.events"))
+	if err != nil {
+		return false
+	}
+	for _, line := range strings.Split(string(content), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && fields[0] == "oom_kill" && fields[1] != "0" {
+			return true
+		}
+	}
+	return false
+}
+
+// configureProcess makes the executor the leader of a new process group,
+// started in the cgroup of the container (if any). The returned file must be
+// closed once the process has started.
+func configureProcess(cmd *exec.Cmd, cgroup string) (*os.File, error) {
+	// the executor is killed if the node terminates (as long as the thread
+	// starting it is alive, see go.dev/issue/27505)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true, Pdeathsig: syscall.SIGKILL}
+	if cgroup == "" {
+		return nil, nil
+	}
+	f, err := os.Open(cgroup)
+	if err != nil {
+		return nil, fmt.Errorf("could not open cgroup %s: %v", cgroup, err)
+	}
+	cmd.SysProcAttr.UseCgroupFD = true
+	cmd.SysProcAttr.CgroupFD = int(f.Fd())
+	return f, nil
+}
+
+// signalProcess sends a signal to the process group of the executor.
+func signalProcess(cmd *exec.Cmd, sig syscall.Signal) error {
+	return syscall.Kill(-cmd.Process.Pid, sig)
+}
+
+func pauseProcess(cmd *exec.Cmd) error {
+	return signalProcess(cmd, syscall.SIGSTOP)
+}
+
+func resumeProcess(cmd *exec.Cmd) error {
+	return signalProcess(cmd, syscall.SIGCONT)
+}
+
+func killProcess(cmd *exec.Cmd) error {
+	return signalProcess(cmd, syscall.SIGKILL)
+}
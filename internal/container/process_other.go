@@ -0,0 +1,46 @@
+//go:build !linux
+
+package container
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+)
+
+// cgroups are only supported on Linux
+const defaultCgroupParent = ""
+
+func initCgroup(parent string) string {
+	if parent != "" {
+		log.Printf("cgroups are not supported on this platform: container limits are not enforced\n")
+	}
+	return ""
+}
+
+func createCgroup(_ string, _ ContainerID, _ *ContainerOptions) (string, error) {
+	return "", nil
+}
+
+func removeCgroup(_ string) {}
+
+func oomKilled(_ string) bool {
+	return false
+}
+
+func configureProcess(_ *exec.Cmd, _ string) (*os.File, error) {
+	return nil, nil
+}
+
+func pauseProcess(_ *exec.Cmd) error {
+	return fmt.Errorf("pausing processes is not supported on this platform")
+}
+
+func resumeProcess(_ *exec.Cmd) error {
+	return fmt.Errorf("pausing processes is not supported on this platform")
+}
+
+func killProcess(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
@@ -0,0 +1,131 @@
+package container
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grussorusso/serverledge/internal/config"
+	"github.com/grussorusso/serverledge/internal/executor"
+	"github.com/spf13/viper"
+)
+
+// if set, the test binary runs as the executor of a process-based container
+const envTestExecutor = "SERVERLEDGE_TEST_EXECUTOR"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(envTestExecutor) != "" {
+		log.Fatal(http.ListenAndServe(executor.ListenAddress(), fakeExecutor()))
+	}
+	os.Exit(m.Run())
+}
+
+// codeTar returns a base64-encoded tar archive containing a single file.
+func codeTar(t *testing.T, name string, content string) string {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content))}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tw.Write([]byte(content)); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes())
+}
+
+func TestProcessFactory(t *testing.T) {
+	viper.Set(config.PROCESS_FACTORY_DIR, t.TempDir())
+	viper.Set(config.PROCESS_FACTORY_EXECUTOR, os.Args[0])
+	viper.Set(config.PROCESS_FACTORY_CGROUP, "")
+	pf := InitProcessContainerFactory()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events, _ := Events(ctx)
+
+	info, err := NewContainer("test-image", codeTar(t, "function.py", "def handler(): pass"), &ContainerOptions{
+		MemoryMB:    128,
+		Concurrency: 1,
+		Env:         []string{envTestExecutor + "=1"},
+		Labels:      map[string]string{LABEL_FUNCTION: "f"},
+	})
+	if err != nil {
+		t.Fatalf("could not create the container: %v", err)
+	}
+	if info.IPAddress != loopbackAddress || info.ExecutorPort == 0 || info.State != STATE_RUNNING {
+		t.Fatalf("unexpected container info: %+v", info)
+	}
+	if _, err := os.Stat(filepath.Join(pf.dir, info.ID, "app", "function.py")); err != nil {
+		t.Fatalf("function code not extracted: %v", err)
+	}
+
+	result, err := Execute(context.Background(), info.ID, &executor.InvocationRequest{})
+	if err != nil || !result.Success || result.Result != "42" {
+		t.Fatalf("unexpected result: %+v (%v)", result, err)
+	}
+
+	if infos, _ := List(map[string]string{LABEL_FUNCTION: "f"}); len(infos) != 1 || infos[0].ID != info.ID {
+		t.Fatalf("unexpected containers: %+v", infos)
+	}
+	if infos, _ := List(map[string]string{LABEL_FUNCTION: "g"}); len(infos) != 0 {
+		t.Fatalf("unexpected containers: %+v", infos)
+	}
+
+	if err := Pause(info.ID); err != nil {
+		t.Fatalf("could not pause the container: %v", err)
+	}
+	if err := Unpause(info.ID); err != nil {
+		t.Fatalf("could not unpause the container: %v", err)
+	}
+	if _, err := Execute(context.Background(), info.ID, &executor.InvocationRequest{}); err != nil {
+		t.Fatalf("execution failed after unpausing: %v", err)
+	}
+
+	// the termination of the executor is notified
+	s, _ := pf.getSandbox(info.ID)
+	_ = s.cmd.Process.Kill()
+	select {
+	case event := <-events:
+		if event.ID != info.ID || event.Action != EVENT_DIE {
+			t.Fatalf("unexpected event: %+v", event)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("termination not notified")
+	}
+
+	if err := Destroy(info.ID); err != nil {
+		t.Fatalf("could not destroy the container: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(pf.dir, info.ID)); !os.IsNotExist(err) {
+		t.Fatalf("working directory not removed: %v", err)
+	}
+}
+
+func TestExecutorEnv(t *testing.T) {
+	t.Setenv("PATH", "/usr/bin")
+	t.Setenv("SERVERLEDGE_TEST_SECRET", "secret")
+
+	env := executorEnv("/sandbox")
+	vars := make(map[string]string)
+	for _, v := range env {
+		key, value, _ := strings.Cut(v, "=")
+		vars[key] = value
+	}
+	if vars["PATH"] != "/usr/bin" || vars["HOME"] != "/sandbox" {
+		t.Fatalf("unexpected environment: %v", env)
+	}
+	if _, ok := vars["SERVERLEDGE_TEST_SECRET"]; ok {
+		t.Fatalf("the environment of the node is exposed: %v", env)
+	}
+}
@@ -1,3 +1,19 @@
 package executor
 
 const DEFAULT_EXECUTOR_PORT = 8080
+
+// READINESS_PATH is the endpoint of the executor replying 200 once it is
+// ready to serve invocations. The executors of the bundled runtimes are
+// ready as soon as they reply; custom executors may reply 503 while they
+// are initializing, which the node treats as not ready.
+const READINESS_PATH = "/ready"
+
+// Environment variables overriding the defaults of the executor, e.g., when
+// it runs as a local process instead of in a container.
+const (
+	ENV_EXECUTOR_HOST = "EXECUTOR_HOST"        // address to listen on (default: all)
+	ENV_EXECUTOR_PORT = "EXECUTOR_PORT"        // port to listen on (default: DEFAULT_EXECUTOR_PORT)
+	ENV_HANDLER_DIR   = "EXECUTOR_HANDLER_DIR" // overrides the HandlerDir of requests
+	ENV_TMP_DIR       = "EXECUTOR_TMP_DIR"     // directory for temporary files (default: /tmp)
+	ENV_SOCKET        = "EXECUTOR_SOCKET"      // Unix domain socket to listen on, too
+)
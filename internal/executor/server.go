@@ -1,17 +1,34 @@
 package executor
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 )
 
-const resultFile = "/tmp/_executor_result.json"
-const paramsFile = "/tmp/_executor.params"
+var resultFile = filepath.Join(envOrDefault(ENV_TMP_DIR, "/tmp"), "_executor_result.json")
+var paramsFile = filepath.Join(envOrDefault(ENV_TMP_DIR, "/tmp"), "_executor.params")
+
+func envOrDefault(key string, defaultValue string) string {
+	if value, ok := os.LookupEnv(key); ok && value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+// ListenAddress returns the address the executor listens on.
+func ListenAddress() string {
+	return net.JoinHostPort(os.Getenv(ENV_EXECUTOR_HOST), envOrDefault(ENV_EXECUTOR_PORT, strconv.Itoa(DEFAULT_EXECUTOR_PORT)))
+}
 
 func readExecutionResult(resultFile string) string {
 	content, err := os.ReadFile(resultFile)
@@ -23,6 +40,13 @@ func readExecutionResult(resultFile string) string {
 	return string(content)
 }
 
+// ReadyHandler reports that the executor is ready to serve invocations. As
+// handlers run in new processes upon each invocation, nothing has to be
+// loaded in advance: the executor is ready as soon as it serves requests.
+func ReadyHandler(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
+
 func InvokeHandler(w http.ResponseWriter, r *http.Request) {
 	// Parse request
 	reqDecoder := json.NewDecoder(r.Body)
@@ -33,6 +57,10 @@ func InvokeHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if handlerDir, ok := os.LookupEnv(ENV_HANDLER_DIR); ok {
+		req.HandlerDir = handlerDir
+	}
+
 	// Set environment variables
 	err = os.Setenv("RESULT_FILE", resultFile)
 	err = errors.Join(err, os.Setenv("HANDLER", req.Handler))
@@ -69,10 +97,24 @@ func InvokeHandler(w http.ResponseWriter, r *http.Request) {
 		cmd = strings.Split(customCmd, " ")
 	}
 
+	// The handler process is killed if the invocation times out or the
+	// node closes the connection (e.g., because it cancelled the request)
+	ctx := r.Context()
+	if req.Timeout > 0.0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(req.Timeout*float64(time.Second)))
+		defer cancel()
+	}
+
 	var resp *InvocationResult
-	execCmd := exec.Command(cmd[0], cmd[1:]...)
+	execCmd := exec.CommandContext(ctx, cmd[0], cmd[1:]...)
+	execCmd.WaitDelay = time.Second // do not wait for orphans holding the output pipe
 	out, err := execCmd.CombinedOutput()
-	if err != nil {
+	if ctx.Err() != nil {
+		log.Printf("Invocation aborted: %v\n", ctx.Err())
+		http.Error(w, ctx.Err().Error(), http.StatusGatewayTimeout)
+		return
+	} else if err != nil {
 		log.Printf("cmd.Run() failed with %s\n", err)
 		if req.ReturnOutput {
 			resp = &InvocationResult{Success: false, Output: string(out)}
@@ -6,6 +6,7 @@ type InvocationRequest struct {
 	Handler      string
 	HandlerDir   string
 	ReturnOutput bool
+	Timeout      float64 // seconds (0 = no timeout)
 }
 
 type InvocationResult struct {
@@ -1,6 +1,8 @@
 package function
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"time"
@@ -16,11 +18,23 @@ type Function struct {
 	Name                 string
 	Runtime              string  // example: python310
 	MaxFunctionInstances int64   //Upper limit for the number of instances
-	MemoryMB             int64   // MB
-	CPUDemand            float64 // 1.0 -> 1 core
+	MemoryMB             int64   // MB (per container)
+	MemoryPerInstanceMB  int64   // additional MB for each active instance in a container
+	CPUDemand            float64 // 1.0 -> 1 core (per active instance)
+	BaseCPUDemand        float64 // CPU used by a container regardless of its active instances
 	Handler              string  // example: "module.function_name"
 	TarFunctionCode      string  // input is .tar
 	CustomImage          string  // used if custom runtime is chosen
+	SelectionStrategy    string  // running container selection strategy (overrides the node default)
+	Timeout              float64 // max execution time in seconds (0 = no timeout)
+	MinWarm              int64   // containers always kept on each node
+	KeepAlive            int64   // seconds an idle container is kept warm (0 = node default)
+	MaxConcurrency       int64   // max concurrent invocations in the cluster (0 = unlimited)
+	ReservedConcurrency  int64   // concurrent invocations guaranteed within cluster.concurrency
+	RateLimit            float64 // max invocations per second on each node (0 = unlimited)
+	RateBurst            int     // max burst of invocations on each node
+	CallerRateLimit      float64 // max invocations per second of each caller (0 = node default)
+	CallerRateBurst      int     // max burst of invocations of each caller
 
 }
 
@@ -32,6 +46,10 @@ func getEtcdKey(funcName string) string {
 	return fmt.Sprintf("/function/%s", funcName)
 }
 
+// ReservationEtcdPrefix is the prefix of the keys storing the reserved
+// concurrency of each function.
+const ReservationEtcdPrefix = "/reservation/"
+
 // GetFunction retrieves a Function given its name.
 func GetFunction(name string) (*Function, bool) {
 
@@ -51,10 +69,33 @@ func GetFunction(name string) (*Function, bool) {
 
 }
 
+// ContainerCPUDemand returns the CPU committed by a container serving the
+// given number of instances.
+func (f *Function) ContainerCPUDemand(instances int64) float64 {
+	return f.BaseCPUDemand + float64(instances)*f.CPUDemand
+}
+
+// ContainerMemoryMB returns the memory committed by a container serving the
+// given number of instances.
+func (f *Function) ContainerMemoryMB(instances int64) int64 {
+	return f.MemoryMB + instances*f.MemoryPerInstanceMB
+}
+
 func (f *Function) String() string {
 	return f.Name
 }
 
+// CodeDigest returns a digest of the runtime and code of the function, which
+// identifies the containers able to serve it.
+func (f *Function) CodeDigest() string {
+	h := sha256.New()
+	for _, part := range []string{f.Runtime, f.CustomImage, f.TarFunctionCode} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
 func getFromCache(name string) (*Function, bool) {
 	localCache := cache.GetCacheInstance()
 	f, found := localCache.Get(name)
@@ -99,7 +140,11 @@ func (f *Function) SaveToEtcd() error {
 	if err != nil {
 		return fmt.Errorf("Could not marshal function: %v", err)
 	}
-	_, err = cli.Put(ctx, f.getEtcdKey(), string(payload))
+	ops := []clientv3.Op{clientv3.OpPut(f.getEtcdKey(), string(payload))}
+	if f.ReservedConcurrency > 0 {
+		ops = append(ops, clientv3.OpPut(ReservationEtcdPrefix+f.Name, fmt.Sprintf("%d", f.ReservedConcurrency)))
+	}
+	_, err = cli.Txn(ctx).Then(ops...).Commit()
 	if err != nil {
 		return fmt.Errorf("Failed Put: %v", err)
 	}
@@ -118,8 +163,10 @@ func (f *Function) Delete() error {
 	}
 	ctx := context.TODO()
 
-	dresp, err := cli.Delete(ctx, f.getEtcdKey())
-	if err != nil || dresp.Deleted != 1 {
+	tresp, err := cli.Txn(ctx).Then(
+		clientv3.OpDelete(f.getEtcdKey()),
+		clientv3.OpDelete(ReservationEtcdPrefix+f.Name)).Commit()
+	if err != nil || tresp.Responses[0].GetResponseDeleteRange().Deleted != 1 {
 		return fmt.Errorf("Failed Delete: %v", err)
 	}
 
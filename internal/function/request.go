@@ -1,6 +1,7 @@
 package function
 
 import (
+	"context"
 	"fmt"
 	"time"
 )
@@ -11,10 +12,15 @@ type Request struct {
 	Fun     *Function
 	Params  map[string]interface{}
 	Arrival time.Time
+	Ctx     context.Context // cancelled on timeout or when the client goes away
 	RequestQoS
 	CanDoOffloading bool
 	Async           bool
-	ReturnOutput    bool
+	// the cluster concurrency slot has already been acquired (e.g., by the
+	// node offloading this request)
+	ConcurrencySlotHeld bool
+	ReturnOutput        bool
+	Caller              string // identifies the client for rate limiting
 }
 
 type RequestQoS struct {
@@ -31,6 +37,11 @@ type ExecutionReport struct {
 	Duration       float64
 	SchedAction    string
 	Output         string
+	DeadlineMissed bool    // true if the response time exceeded the request MaxRespT
+	TimedOut       bool    // true if the execution was aborted because of a timeout
+	UnpauseTime    float64 // time spent resuming a paused warm container (s)
+	ReadinessTime  float64 // time spent waiting for the executor of a new container (s)
+	FailureReason  string  `json:",omitempty"` // why the container failed during the execution (e.g., "OOMKilled")
 }
 
 type Response struct {
@@ -42,6 +53,25 @@ type AsyncResponse struct {
 	ReqId string
 }
 
+// EffectiveTimeout returns the timeout (in seconds) for an invocation of f,
+// i.e., the smallest between the function timeout and the requested one
+// (0 = no timeout).
+func EffectiveTimeout(f *Function, requested float64) float64 {
+	if f.Timeout > 0.0 && (requested <= 0.0 || f.Timeout < requested) {
+		return f.Timeout
+	}
+	if requested > 0.0 {
+		return requested
+	}
+	return 0.0
+}
+
+// MissesDeadline returns true if the given response time exceeds the max
+// response time requested for r (if any).
+func (r *Request) MissesDeadline(respTime float64) bool {
+	return r.MaxRespT > 0.0 && respTime > r.MaxRespT
+}
+
 func (r *Request) String() string {
 	return fmt.Sprintf("[%s] Rq-%s", r.Fun.Name, r.ReqId)
 }
@@ -53,3 +83,14 @@ const (
 	HIGH_PERFORMANCE               = 1
 	HIGH_AVAILABILITY              = 2
 )
+
+func (c ServiceClass) String() string {
+	switch c {
+	case HIGH_PERFORMANCE:
+		return "performance"
+	case HIGH_AVAILABILITY:
+		return "availability"
+	default:
+		return "low"
+	}
+}
@@ -6,7 +6,6 @@ import (
 	"net/http"
 
 	"github.com/grussorusso/serverledge/internal/config"
-	"github.com/grussorusso/serverledge/internal/node"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
@@ -17,7 +16,7 @@ var Enabled bool
 var registry = prometheus.NewRegistry()
 var nodeIdentifier string
 
-func Init() {
+func Init(nodeID string) {
 	if config.GetBool(config.METRICS_ENABLED, false) {
 		log.Println("Metrics enabled.")
 		Enabled = true
@@ -26,7 +25,7 @@ func Init() {
 		return
 	}
 
-	nodeIdentifier = node.NodeIdentifier
+	nodeIdentifier = nodeID
 	registerGlobalMetrics()
 
 	handler := promhttp.HandlerFor(registry, promhttp.HandlerOpts{
@@ -51,6 +50,22 @@ var (
 		Buckets: durationBuckets,
 	},
 		[]string{"node", "function"})
+	QueueLengths = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "sedge_queue_length",
+		Help: "Number of queued requests per function",
+	}, []string{"node", "function"})
+	AdmittedRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "sedge_admitted_total",
+		Help: "The total number of requests admitted to the scheduler",
+	}, []string{"node", "function"})
+	RejectedRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "sedge_rejected_total",
+		Help: "The total number of requests rejected because the scheduler intake was full",
+	}, []string{"node", "function"})
+	Evictions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "sedge_evictions_total",
+		Help: "The total number of warm containers evicted to free memory",
+	}, []string{"node", "function", "policy"})
 )
 
 var durationBuckets = []float64{0.002, 0.005, 0.010, 0.02, 0.03, 0.05, 0.1, 0.15, 0.3, 0.6, 1.0}
@@ -61,8 +76,27 @@ func AddCompletedInvocation(funcName string) {
 func AddFunctionDurationValue(funcName string, duration float64) {
 	ExecutionTimes.With(prometheus.Labels{"function": funcName, "node": nodeIdentifier}).Observe(duration)
 }
+func SetQueueLength(funcName string, length int) {
+	QueueLengths.With(prometheus.Labels{"function": funcName, "node": nodeIdentifier}).Set(float64(length))
+}
+
+func AddEviction(funcName string, policy string) {
+	Evictions.With(prometheus.Labels{"function": funcName, "node": nodeIdentifier, "policy": policy}).Inc()
+}
+
+func AddAdmittedRequest(funcName string) {
+	AdmittedRequests.With(prometheus.Labels{"function": funcName, "node": nodeIdentifier}).Inc()
+}
+
+func AddRejectedRequest(funcName string) {
+	RejectedRequests.With(prometheus.Labels{"function": funcName, "node": nodeIdentifier}).Inc()
+}
 
 func registerGlobalMetrics() {
 	registry.MustRegister(CompletedInvocations)
 	registry.MustRegister(ExecutionTimes)
+	registry.MustRegister(QueueLengths)
+	registry.MustRegister(Evictions)
+	registry.MustRegister(AdmittedRequests)
+	registry.MustRegister(RejectedRequests)
 }
@@ -0,0 +1,278 @@
+package node
+
+import (
+	"log"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/grussorusso/serverledge/internal/clock"
+	"github.com/grussorusso/serverledge/internal/config"
+	"github.com/grussorusso/serverledge/internal/container"
+	"github.com/grussorusso/serverledge/internal/function"
+)
+
+// number of recent decisions reported by the status API
+const autoscalerHistory = 50
+
+// functionForecast tracks the arrival rate of a function and forecasts its
+// short-term demand with Holt's linear exponential smoothing.
+type functionForecast struct {
+	fun      *function.Function
+	arrivals int64 // arrivals in the current interval
+	samples  int64
+	level    float64
+	trend    float64
+
+	status FunctionForecast
+}
+
+// FunctionForecast describes the demand forecast for a function.
+type FunctionForecast struct {
+	ArrivalRate       float64 // arrivals per second in the last interval
+	ForecastRate      float64 // arrivals per second expected in the next interval
+	AvgDuration       float64 // average execution time (s)
+	ExpectedInstances int64   // concurrent instances expected in the next interval
+	RunningContainers int
+	WarmContainers    int
+	TargetWarm        int // warm containers the autoscaler aims at
+}
+
+// AutoscalerDecision describes an action taken by the autoscaler.
+type AutoscalerDecision struct {
+	Time       time.Time
+	Function   string
+	Action     string // "prewarm" or "release"
+	Containers int
+	Reason     string
+}
+
+// AutoscalerStatus reports the state of the autoscaler.
+type AutoscalerStatus struct {
+	Enabled   bool
+	Interval  float64 // seconds
+	Functions map[string]FunctionForecast
+	Decisions []AutoscalerDecision // most recent first
+}
+
+type autoscaler struct {
+	sync.Mutex
+	interval  time.Duration
+	alpha     float64
+	beta      float64
+	functions map[string]*functionForecast
+	decisions []AutoscalerDecision
+}
+
+var autoscalerInstance *autoscaler
+var autoscalerOnce sync.Once
+
+// StartAutoscaler starts the autoscaler, if enabled in the configuration.
+func StartAutoscaler() {
+	if !config.GetBool(config.AUTOSCALER_ENABLED, false) {
+		return
+	}
+
+	autoscalerOnce.Do(func() {
+		interval := config.GetInt(config.AUTOSCALER_INTERVAL, 10)
+		if interval < 1 {
+			interval = 10
+		}
+		a := &autoscaler{
+			interval:  time.Duration(interval) * time.Second,
+			alpha:     config.GetFloat(config.AUTOSCALER_ALPHA, 0.5),
+			beta:      config.GetFloat(config.AUTOSCALER_BETA, 0.3),
+			functions: make(map[string]*functionForecast),
+		}
+		log.Printf("Autoscaler started (interval: %v)\n", a.interval)
+		go a.run()
+
+		// arrivals are recorded only once the autoscaler is running
+		Resources.Lock()
+		autoscalerInstance = a
+		Resources.Unlock()
+	})
+}
+
+// RecordArrival notifies the autoscaler and the keep-alive policy about a
+// new request for a function.
+func RecordArrival(f *function.Function) {
+	getKeepAliveTracker().recordArrival(f)
+
+	Resources.RLock()
+	a := autoscalerInstance
+	Resources.RUnlock()
+	if a == nil {
+		return
+	}
+
+	a.Lock()
+	defer a.Unlock()
+	ff, ok := a.functions[f.Name]
+	if !ok {
+		ff = &functionForecast{}
+		a.functions[f.Name] = ff
+	}
+	ff.fun = f
+	ff.arrivals++
+}
+
+func (a *autoscaler) run() {
+	ticker := clock.NewTicker(a.interval)
+	for range ticker.C {
+		a.scale()
+	}
+}
+
+// forecast updates the smoothed arrival rate of a function and returns the
+// rate expected in the next interval.
+func (a *autoscaler) forecast(ff *functionForecast) float64 {
+	rate := float64(ff.arrivals) / a.interval.Seconds()
+	ff.arrivals = 0
+	ff.samples++
+
+	if ff.samples == 1 {
+		ff.level = rate
+		ff.trend = 0.0
+	} else {
+		level := a.alpha*rate + (1.0-a.alpha)*(ff.level+ff.trend)
+		ff.trend = a.beta*(level-ff.level) + (1.0-a.beta)*ff.trend
+		ff.level = level
+	}
+
+	ff.status.ArrivalRate = rate
+	ff.status.ForecastRate = math.Max(ff.level+ff.trend, 0.0)
+	return ff.status.ForecastRate
+}
+
+// scale updates the forecasts and adjusts the number of warm containers of
+// each function.
+func (a *autoscaler) scale() {
+	type action struct {
+		fun     *function.Function
+		delta   int // containers to prewarm (>0) or release (<0)
+		reason  string
+		release []container.ContainerID
+	}
+	actions := make([]action, 0)
+
+	a.Lock()
+	for name, ff := range a.functions {
+		rate := a.forecast(ff)
+		pending := len(actions)
+
+		fp := lockFunctionPool(ff.fun)
+		s := &ff.status
+		s.AvgDuration = fp.avgDuration
+		// Little's law: concurrent instances = arrival rate * duration
+		s.ExpectedInstances = int64(math.Ceil(rate * fp.avgDuration))
+		perContainer := fp.concurrency.effectiveLimit(ff.fun.MaxFunctionInstances)
+		neededContainers := int((s.ExpectedInstances + perContainer - 1) / perContainer)
+		s.RunningContainers = fp.running.Len()
+		s.WarmContainers = fp.warm.Len()
+		s.TargetWarm = neededContainers - s.RunningContainers
+		if s.TargetWarm < 0 {
+			s.TargetWarm = 0
+		}
+
+		if s.WarmContainers < s.TargetWarm {
+			actions = append(actions, action{fun: ff.fun, delta: s.TargetWarm - s.WarmContainers,
+				reason: "forecast demand exceeds available containers"})
+		} else if s.WarmContainers > s.TargetWarm {
+			// only containers prewarmed by the autoscaler and never
+			// used are released; the others expire as usual
+			surplus := s.WarmContainers - s.TargetWarm
+			if floor := int(ff.fun.MinWarm); s.TargetWarm < floor {
+				surplus = s.WarmContainers - floor // never go below MinWarm
+			}
+			released := make([]container.ContainerID, 0)
+			for elem := fp.warm.Front(); elem != nil && len(released) < surplus; {
+				wc := elem.Value.(*warmContainer)
+				next := elem.Next()
+				if wc.autoscaled {
+					fp.warm.Remove(elem)
+					releaseResources(0, wc.res.memoryMB)
+					released = append(released, wc.contID)
+				}
+				elem = next
+			}
+			if len(released) > 0 {
+				actions = append(actions, action{fun: ff.fun, delta: -len(released), release: released,
+					reason: "forecast demand decreased"})
+			}
+		}
+		fp.Unlock()
+
+		if s.ArrivalRate == 0.0 && s.ForecastRate < 1e-3 && len(actions) == pending {
+			// the function is idle: stop tracking it
+			delete(a.functions, name)
+		}
+	}
+	a.Unlock()
+
+	for _, act := range actions {
+		count := 0
+		if act.delta > 0 {
+			for count < act.delta {
+				// prewarmed containers must not evict other ones
+				if _, err := newWarmContainer(act.fun, false, true); err != nil {
+					break
+				}
+				count++
+			}
+			if count < act.delta {
+				act.reason += " (limited by available memory)"
+			}
+		} else {
+			for _, contID := range act.release {
+				forgetContainer(contID)
+				if err := container.Destroy(contID); err != nil {
+					log.Printf("Error while destroying container %s: %s\n", contID, err)
+				}
+			}
+			count = len(act.release)
+		}
+		if count == 0 {
+			continue
+		}
+
+		decision := AutoscalerDecision{Time: clock.Now(), Function: act.fun.Name, Containers: count, Reason: act.reason}
+		if act.delta > 0 {
+			decision.Action = "prewarm"
+		} else {
+			decision.Action = "release"
+		}
+		log.Printf("Autoscaler: %s %d container(s) for %s: %s\n", decision.Action, count, act.fun.Name, act.reason)
+
+		a.Lock()
+		a.decisions = append([]AutoscalerDecision{decision}, a.decisions...)
+		if len(a.decisions) > autoscalerHistory {
+			a.decisions = a.decisions[:autoscalerHistory]
+		}
+		a.Unlock()
+	}
+}
+
+// GetAutoscalerStatus returns the current forecasts and the recent decisions
+// of the autoscaler.
+func GetAutoscalerStatus() AutoscalerStatus {
+	Resources.RLock()
+	a := autoscalerInstance
+	Resources.RUnlock()
+	if a == nil {
+		return AutoscalerStatus{Enabled: false}
+	}
+
+	a.Lock()
+	defer a.Unlock()
+	status := AutoscalerStatus{
+		Enabled:   true,
+		Interval:  a.interval.Seconds(),
+		Functions: make(map[string]FunctionForecast),
+		Decisions: append([]AutoscalerDecision{}, a.decisions...),
+	}
+	for name, ff := range a.functions {
+		status.Functions[name] = ff.status
+	}
+	return status
+}
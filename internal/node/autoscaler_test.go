@@ -0,0 +1,160 @@
+package node
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/grussorusso/serverledge/internal/container"
+	"github.com/grussorusso/serverledge/internal/function"
+)
+
+func newTestAutoscaler() *autoscaler {
+	return &autoscaler{
+		interval:  10 * time.Second,
+		alpha:     0.5,
+		beta:      0.3,
+		functions: make(map[string]*functionForecast),
+	}
+}
+
+// track makes the autoscaler observe the given arrivals for f in the
+// current interval.
+func (a *autoscaler) track(f *function.Function, arrivals int64) {
+	ff, ok := a.functions[f.Name]
+	if !ok {
+		ff = &functionForecast{}
+		a.functions[f.Name] = ff
+	}
+	ff.fun = f
+	ff.arrivals = arrivals
+}
+
+// markAutoscaled flags the given warm containers of f as prewarmed by the
+// autoscaler.
+func markAutoscaled(f *function.Function, ids ...container.ContainerID) {
+	fp := lockFunctionPool(f)
+	defer fp.Unlock()
+	for elem := fp.warm.Front(); elem != nil; elem = elem.Next() {
+		wc := elem.Value.(*warmContainer)
+		for _, id := range ids {
+			if wc.contID == id {
+				wc.autoscaled = true
+			}
+		}
+	}
+}
+
+func TestAutoscalerForecast(t *testing.T) {
+	a := newTestAutoscaler()
+	ff := &functionForecast{}
+
+	// the expected rate (req/s) after each interval
+	cases := []struct {
+		arrivals int64
+		forecast float64
+	}{
+		{100, 10.0},  // the first sample sets the level
+		{200, 16.5},  // level 15, trend 1.5: the increase is extrapolated
+		{0, 7.275},   // level 8.25, trend -0.975
+		{0, 1.57125}, // level 3.6375, trend -2.06625
+		{0, 0.0},     // level 0.785625, trend -2.3019375: clamped at zero
+	}
+	for i, c := range cases {
+		ff.arrivals = c.arrivals
+		if rate := a.forecast(ff); math.Abs(rate-c.forecast) > 1e-9 {
+			t.Fatalf("interval %d: forecast %f, expected %f", i, rate, c.forecast)
+		}
+	}
+	if ff.arrivals != 0 || ff.status.ArrivalRate != 0.0 {
+		t.Fatalf("arrivals not reset: %+v", ff)
+	}
+}
+
+func TestAutoscalerPrewarm(t *testing.T) {
+	factory := &creatingFactory{}
+	resetNode(1024, 1.0)
+	container.SetFactory(factory)
+
+	f := testFunction("f", 128)
+	f.Runtime = "python310"
+	addWarmContainers(t, f, 1, time.Now().Add(time.Hour))
+	fp := lockFunctionPool(f)
+	fp.avgDuration = 1.0
+	fp.Unlock()
+
+	// 3 req/s lasting 1 s each need 3 containers, one of which is warm
+	a := newTestAutoscaler()
+	a.track(f, 30)
+	a.scale()
+
+	status := a.functions[f.Name].status
+	if status.ExpectedInstances != 3 || status.TargetWarm != 3 {
+		t.Fatalf("unexpected forecast: %+v", status)
+	}
+	if created := factory.creationCount(); created != 2 {
+		t.Fatalf("expected 2 prewarmed containers, got %d", created)
+	}
+	if warm := WarmStatus()[f.Name]; warm != 3 {
+		t.Fatalf("expected 3 warm containers, got %d", warm)
+	}
+	if len(a.decisions) != 1 || a.decisions[0].Action != "prewarm" || a.decisions[0].Containers != 2 {
+		t.Fatalf("unexpected decisions: %+v", a.decisions)
+	}
+	expectAvailable(t, 1024-3*128, 1.0)
+}
+
+func TestAutoscalerRelease(t *testing.T) {
+	factory := resetNode(1024, 1.0)
+
+	f := testFunction("f", 128)
+	addWarmContainers(t, f, 4, time.Now().Add(time.Hour))
+	markAutoscaled(f, "f-2", "f-3")
+	f.MinWarm = 3 // set afterwards, not to provision containers
+
+	// no demand is expected, but the pool is kept at MinWarm
+	a := newTestAutoscaler()
+	a.track(f, 0)
+	a.scale()
+	if warm := WarmStatus()[f.Name]; warm != 3 {
+		t.Fatalf("expected 3 warm containers, got %d", warm)
+	}
+
+	// without the floor, only the containers prewarmed by the autoscaler
+	// are released
+	f.MinWarm = 0
+	a.scale()
+	if warm := WarmStatus()[f.Name]; warm != 2 {
+		t.Fatalf("expected 2 warm containers, got %d", warm)
+	}
+	destroyed := map[container.ContainerID]bool{}
+	for _, contID := range factory.destroyed {
+		destroyed[contID] = true
+	}
+	if len(destroyed) != 2 || !destroyed["f-2"] || !destroyed["f-3"] {
+		t.Fatalf("unexpected destroyed containers: %v", factory.destroyed)
+	}
+	expectAvailable(t, 1024-2*128, 1.0)
+
+	if len(a.decisions) != 2 || a.decisions[0].Action != "release" || a.decisions[0].Containers != 1 {
+		t.Fatalf("unexpected decisions: %+v", a.decisions)
+	}
+}
+
+func TestAutoscalerPrunesIdleFunctions(t *testing.T) {
+	resetNode(1024, 1.0)
+	idle := testFunction("idle", 128)
+	busy := testFunction("busy", 128)
+
+	a := newTestAutoscaler()
+	a.track(idle, 0)
+	a.track(busy, 10)
+	a.scale()
+
+	if _, ok := a.functions[idle.Name]; ok {
+		t.Fatalf("idle function still tracked")
+	}
+	if _, ok := a.functions[busy.Name]; !ok {
+		t.Fatalf("busy function no longer tracked")
+	}
+}
@@ -0,0 +1,203 @@
+package node
+
+import (
+	"math"
+
+	"github.com/grussorusso/serverledge/internal/config"
+	"github.com/grussorusso/serverledge/internal/function"
+)
+
+// concurrencyModel learns how the duration of a function grows with the
+// number of instances sharing the same container. Durations are fitted with
+// the exponential model d(c) = d(1) * exp(alpha*(c-1)), as done offline by
+// opt_deg.py, and the effective concurrency level is the largest c whose
+// expected slowdown d(c)/d(1) does not exceed 1+tolerance.
+type concurrencyModel struct {
+	enabled    bool
+	tolerance  float64
+	minSamples int64
+
+	// every exploration-th acquisition may exceed the learned limit by one
+	// instance, so that the model keeps observing the next level
+	exploration  int64
+	acquisitions int64
+
+	levels  []concurrencyLevelStats // levels[i] refers to concurrency level i+1
+	samples int64
+
+	fitted       bool
+	alpha        float64
+	baseDuration float64
+	limit        int64
+}
+
+type concurrencyLevelStats struct {
+	count      int64
+	logDurMean float64 // moving average of log(duration)
+}
+
+// ConcurrencyStatus describes the learned concurrency level for a function.
+type ConcurrencyStatus struct {
+	Adaptive           bool
+	MaxInstances       int64   // upper bound configured for the function
+	EffectiveInstances int64   // instances currently allowed per container
+	Samples            int64   // durations observed so far
+	Fitted             bool    // whether the model has enough samples to be used
+	Alpha              float64 // exponential slowdown coefficient
+	BaseDuration       float64 // estimated duration with a single instance (s)
+	SamplesPerLevel    map[int64]int64
+}
+
+// samples older than ~1/minLevelWeight observations are progressively forgotten
+const minLevelWeight = 0.05
+
+func newConcurrencyModel() *concurrencyModel {
+	return &concurrencyModel{
+		enabled:     config.GetBool(config.CONTAINER_ADAPTIVE_CONCURRENCY, false),
+		tolerance:   config.GetFloat(config.CONTAINER_CONCURRENCY_TOLERANCE, 0.5),
+		minSamples:  int64(config.GetInt(config.CONTAINER_CONCURRENCY_MIN_SAMPLES, 20)),
+		exploration: int64(config.GetInt(config.CONTAINER_CONCURRENCY_EXPLORATION, 10)),
+	}
+}
+
+// effectiveLimit returns the number of instances that can share a container.
+func (m *concurrencyModel) effectiveLimit(maxInstances int64) int64 {
+	if maxInstances < 1 {
+		maxInstances = 1
+	}
+	if !m.enabled || !m.fitted || m.limit > maxInstances {
+		return maxInstances
+	}
+	return m.limit
+}
+
+// admissionLimit returns the number of instances that can share a container
+// when a new instance is acquired. Periodically, one more instance than the
+// learned limit is allowed: otherwise, the durations above the limit would
+// never be observed again and the model could not recover from an
+// underestimate.
+func (m *concurrencyModel) admissionLimit(maxInstances int64) int64 {
+	limit := m.effectiveLimit(maxInstances)
+	if !m.enabled || !m.fitted || m.exploration <= 0 || limit >= maxInstances {
+		return limit
+	}
+	m.acquisitions++
+	if m.acquisitions%m.exploration == 0 {
+		return limit + 1
+	}
+	return limit
+}
+
+// observe records the duration of an execution that started while the
+// container was serving the given number of instances.
+func (m *concurrencyModel) observe(instances int64, duration float64, maxInstances int64) {
+	if !m.enabled || instances < 1 || duration <= 0.0 {
+		return
+	}
+
+	for int64(len(m.levels)) < instances {
+		m.levels = append(m.levels, concurrencyLevelStats{})
+	}
+	level := &m.levels[instances-1]
+	level.count++
+	w := math.Max(1.0/float64(level.count), minLevelWeight)
+	level.logDurMean = (1-w)*level.logDurMean + w*math.Log(duration)
+	m.samples++
+
+	if m.samples >= m.minSamples {
+		m.fit(maxInstances)
+	}
+}
+
+// fit estimates the model parameters via weighted least squares on the
+// log-durations observed at each concurrency level.
+func (m *concurrencyModel) fit(maxInstances int64) {
+	var sumW, sumX, sumY, sumXX, sumXY float64
+	distinctLevels := 0
+	for i, l := range m.levels {
+		if l.count == 0 {
+			continue
+		}
+		distinctLevels++
+		w := float64(l.count)
+		x := float64(i)
+		sumW += w
+		sumX += w * x
+		sumY += w * l.logDurMean
+		sumXX += w * x * x
+		sumXY += w * x * l.logDurMean
+	}
+
+	if distinctLevels < 2 {
+		// the slowdown cannot be estimated yet: keep the configured bound
+		m.fitted = false
+		return
+	}
+
+	den := sumW*sumXX - sumX*sumX
+	if den == 0.0 {
+		m.fitted = false
+		return
+	}
+	m.alpha = (sumW*sumXY - sumX*sumY) / den
+	m.baseDuration = math.Exp((sumY - m.alpha*sumX) / sumW)
+	m.fitted = true
+
+	if m.alpha <= 0.0 {
+		m.limit = maxInstances
+	} else {
+		m.limit = int64(math.Floor(math.Log(1.0+m.tolerance)/m.alpha)) + 1
+	}
+	if m.limit < 1 {
+		m.limit = 1
+	} else if m.limit > maxInstances {
+		m.limit = maxInstances
+	}
+}
+
+func (m *concurrencyModel) status(maxInstances int64) ConcurrencyStatus {
+	perLevel := make(map[int64]int64)
+	for i, l := range m.levels {
+		if l.count > 0 {
+			perLevel[int64(i+1)] = l.count
+		}
+	}
+	return ConcurrencyStatus{
+		Adaptive:           m.enabled,
+		MaxInstances:       maxInstances,
+		EffectiveInstances: m.effectiveLimit(maxInstances),
+		Samples:            m.samples,
+		Fitted:             m.fitted,
+		Alpha:              m.alpha,
+		BaseDuration:       m.baseDuration,
+		SamplesPerLevel:    perLevel,
+	}
+}
+
+// ObserveExecution feeds the concurrency model of a function with the duration
+// of an execution, started when the given number of instances (as returned by
+// the acquisition of the container) were sharing its container.
+func ObserveExecution(f *function.Function, instances int64, duration float64) {
+	fp := lockFunctionPool(f)
+	defer fp.Unlock()
+	fp.executions++
+	if fp.executions == 1 {
+		fp.avgDuration = duration
+	} else {
+		fp.avgDuration = 0.9*fp.avgDuration + 0.1*duration
+	}
+
+	fp.concurrency.observe(instances, duration, f.MaxFunctionInstances)
+}
+
+// ConcurrencyStatusAll returns the learned concurrency level for each function
+// with a container pool on this node.
+func ConcurrencyStatusAll() map[string]ConcurrencyStatus {
+	status := make(map[string]ConcurrencyStatus)
+	for _, pool := range functionPools() {
+		pool.Lock()
+		status[pool.fun.Name] = pool.concurrency.status(pool.maxInstances)
+		pool.Unlock()
+	}
+	return status
+}
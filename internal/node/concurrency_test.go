@@ -0,0 +1,86 @@
+package node
+
+import (
+	"math"
+	"testing"
+)
+
+func testConcurrencyModel() *concurrencyModel {
+	return &concurrencyModel{enabled: true, tolerance: 0.5, minSamples: 10, exploration: 4}
+}
+
+func TestConcurrencyModelFit(t *testing.T) {
+	m := testConcurrencyModel()
+	const alpha, base = 0.2, 0.1
+	for i := 0; i < 20; i++ {
+		for c := int64(1); c <= 4; c++ {
+			m.observe(c, base*math.Exp(alpha*float64(c-1)), 8)
+		}
+	}
+	if !m.fitted {
+		t.Fatalf("model not fitted after %d samples", m.samples)
+	}
+	if math.Abs(m.alpha-alpha) > 1e-6 || math.Abs(m.baseDuration-base) > 1e-6 {
+		t.Fatalf("expected alpha=%f base=%f, got alpha=%f base=%f", alpha, base, m.alpha, m.baseDuration)
+	}
+	// exp(0.2*(c-1)) <= 1.5 for c <= 3
+	if limit := m.effectiveLimit(8); limit != 3 {
+		t.Fatalf("expected limit 3, got %d", limit)
+	}
+	if limit := m.effectiveLimit(2); limit != 2 {
+		t.Fatalf("the limit exceeds the configured bound: %d", limit)
+	}
+}
+
+func TestConcurrencyModelNeedsTwoLevels(t *testing.T) {
+	m := testConcurrencyModel()
+	for i := 0; i < 50; i++ {
+		m.observe(1, 0.1, 8)
+	}
+	if m.fitted {
+		t.Fatalf("model fitted with a single concurrency level")
+	}
+	if limit := m.effectiveLimit(8); limit != 8 {
+		t.Fatalf("expected the configured bound, got %d", limit)
+	}
+
+	m.enabled = false
+	m.observe(2, 0.1, 8)
+	if m.samples != 50 {
+		t.Fatalf("samples observed by a disabled model")
+	}
+}
+
+func TestConcurrencyModelExploration(t *testing.T) {
+	m := testConcurrencyModel()
+	// a steep slowdown limits the containers to a single instance
+	for i := 0; i < 10; i++ {
+		m.observe(1, 0.1, 4)
+		m.observe(2, 1.0, 4)
+	}
+	if limit := m.effectiveLimit(4); limit != 1 {
+		t.Fatalf("expected limit 1, got %d", limit)
+	}
+
+	explored := 0
+	for i := 0; i < 8; i++ {
+		switch m.admissionLimit(4) {
+		case 1:
+		case 2:
+			explored++
+		default:
+			t.Fatalf("unexpected admission limit")
+		}
+	}
+	if explored != 2 {
+		t.Fatalf("expected 2 explorations out of 8 acquisitions, got %d", explored)
+	}
+
+	// once the slowdown vanishes, the observed durations raise the limit
+	for i := 0; i < 200; i++ {
+		m.observe(2, 0.1, 4)
+	}
+	if limit := m.effectiveLimit(4); limit != 4 {
+		t.Fatalf("the limit did not recover: %d", limit)
+	}
+}
@@ -0,0 +1,261 @@
+package node
+
+import (
+	"log"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/grussorusso/serverledge/internal/config"
+	"github.com/grussorusso/serverledge/internal/container"
+	"github.com/grussorusso/serverledge/internal/function"
+	"github.com/grussorusso/serverledge/internal/metrics"
+)
+
+// Policies for choosing the warm containers to evict under memory pressure.
+const (
+	LRU_EVICTION         = "lru"
+	LFU_EVICTION         = "lfu"
+	GREEDY_DUAL_EVICTION = "greedydual"
+)
+
+// EvictionCandidate describes a warm container that may be evicted.
+type EvictionCandidate struct {
+	Function      string
+	ContID        container.ContainerID
+	MemoryMB      int64
+	LastUsed      time.Time // when the container became idle
+	Frequency     int64     // invocations of the function served on this node
+	ColdStartTime float64   // average cold start time of the function (s)
+}
+
+// EvictionPolicy chooses which warm containers are evicted when memory is
+// needed for a new container.
+type EvictionPolicy interface {
+	Name() string
+	// Priority returns the retention priority of a container that has just
+	// become idle: containers with the lowest priority are evicted first.
+	Priority(c *EvictionCandidate) float64
+	// Evicted notifies the policy that a container with the given priority
+	// has been evicted.
+	Evicted(c *EvictionCandidate, priority float64)
+}
+
+// LRUEvictionPolicy evicts the containers idle for the longest time.
+type LRUEvictionPolicy struct{}
+
+// LFUEvictionPolicy evicts containers of the least frequently invoked
+// functions first.
+type LFUEvictionPolicy struct{}
+
+// GreedyDualEvictionPolicy implements the Greedy-Dual-Size-Frequency policy:
+// the priority of a container is clock + frequency*coldStartTime/memory, thus
+// favoring frequently invoked functions with expensive cold starts and small
+// memory footprint. The clock is advanced to the priority of each victim, so
+// that containers idle for long eventually age out.
+type GreedyDualEvictionPolicy struct {
+	mu    sync.Mutex
+	clock float64
+}
+
+func (p *LRUEvictionPolicy) Name() string { return LRU_EVICTION }
+
+func (p *LRUEvictionPolicy) Priority(c *EvictionCandidate) float64 {
+	return float64(c.LastUsed.UnixNano())
+}
+
+func (p *LRUEvictionPolicy) Evicted(_ *EvictionCandidate, _ float64) {}
+
+func (p *LFUEvictionPolicy) Name() string { return LFU_EVICTION }
+
+func (p *LFUEvictionPolicy) Priority(c *EvictionCandidate) float64 {
+	return float64(c.Frequency)
+}
+
+func (p *LFUEvictionPolicy) Evicted(_ *EvictionCandidate, _ float64) {}
+
+func (p *GreedyDualEvictionPolicy) Name() string { return GREEDY_DUAL_EVICTION }
+
+func (p *GreedyDualEvictionPolicy) Priority(c *EvictionCandidate) float64 {
+	size := math.Max(float64(c.MemoryMB), 1.0)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.clock + float64(c.Frequency)*c.ColdStartTime/size
+}
+
+func (p *GreedyDualEvictionPolicy) Evicted(_ *EvictionCandidate, priority float64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.clock = math.Max(p.clock, priority)
+}
+
+func newEvictionPolicy(name string) EvictionPolicy {
+	switch name {
+	case LRU_EVICTION:
+		return &LRUEvictionPolicy{}
+	case LFU_EVICTION:
+		return &LFUEvictionPolicy{}
+	case GREEDY_DUAL_EVICTION:
+		return &GreedyDualEvictionPolicy{}
+	default:
+		log.Printf("Unknown eviction policy '%s': using %s\n", name, LRU_EVICTION)
+		return &LRUEvictionPolicy{}
+	}
+}
+
+var evictionPolicy EvictionPolicy
+var evictionPolicyOnce sync.Once
+
+// getEvictionPolicy returns the eviction policy configured for the node.
+func getEvictionPolicy() EvictionPolicy {
+	evictionPolicyOnce.Do(func() {
+		evictionPolicy = newEvictionPolicy(config.GetString(config.CONTAINER_EVICTION_POLICY, LRU_EVICTION))
+	})
+	return evictionPolicy
+}
+
+// evictionCandidate describes a warm container of the pool.
+func (fp *ContainerPool) evictionCandidate(wc *warmContainer) *EvictionCandidate {
+	return &EvictionCandidate{
+		Function:      fp.fun.Name,
+		ContID:        wc.contID,
+		MemoryMB:      wc.res.memoryMB,
+		LastUsed:      wc.lastUsed,
+		Frequency:     fp.invocations,
+		ColdStartTime: fp.coldStartTime,
+	}
+}
+
+// ObserveColdStart records the initialization time of a cold start for the
+// function, used by cost-aware eviction policies.
+func ObserveColdStart(f *function.Function, initTime float64) {
+	fp := lockFunctionPool(f)
+	defer fp.Unlock()
+	fp.coldStarts++
+	if fp.coldStarts == 1 {
+		fp.coldStartTime = initTime
+	} else {
+		fp.coldStartTime = 0.9*fp.coldStartTime + 0.1*initTime
+	}
+}
+
+type itemToDismiss struct {
+	pool      *ContainerPool
+	fun       *function.Function
+	candidate *EvictionCandidate
+	priority  float64
+}
+
+// dismissContainer frees at least requiredMemoryMB by destroying warm
+// containers, chosen by the configured eviction policy. Containers are only
+// destroyed if enough memory can be freed overall.
+// No pool must be locked by the caller.
+func dismissContainer(requiredMemoryMB int64) bool {
+	policy := getEvictionPolicy()
+
+	// first phase: rank the warm containers, excluding the MinWarm ones
+	// with the highest priority of each pool
+	var candidates []itemToDismiss
+	for _, funPool := range functionPools() {
+		var poolCandidates []itemToDismiss
+		funPool.Lock()
+		for elem := funPool.warm.Front(); elem != nil; elem = elem.Next() {
+			wc := elem.Value.(*warmContainer)
+			poolCandidates = append(poolCandidates, itemToDismiss{
+				pool:      funPool,
+				fun:       funPool.fun,
+				candidate: funPool.evictionCandidate(wc),
+				priority:  wc.priority,
+			})
+		}
+		evictable := len(poolCandidates) - int(funPool.fun.MinWarm)
+		funPool.Unlock()
+		if evictable <= 0 {
+			continue // the pool is at its floor
+		}
+		sortByEvictionOrder(poolCandidates)
+		candidates = append(candidates, poolCandidates[:evictable]...)
+	}
+	sortByEvictionOrder(candidates)
+
+	var availableMB int64 = 0
+	for _, item := range candidates {
+		availableMB += item.candidate.MemoryMB
+	}
+	if availableMB < requiredMemoryMB {
+		return false
+	}
+
+	// second phase: cleanup, skipping containers acquired in the meantime
+	var cleanedMB int64 = 0
+	var dismissed []container.ContainerID
+	evicted := make(map[*ContainerPool]*function.Function)
+	for _, item := range candidates {
+		if cleanedMB >= requiredMemoryMB {
+			break
+		}
+		c := item.candidate
+		if !item.pool.removeWarmContainer(c.ContID) {
+			continue
+		}
+		log.Printf("Evicting container %s of %s (policy: %s, priority: %f, reason: %d MB needed)\n",
+			c.ContID, c.Function, policy.Name(), item.priority, requiredMemoryMB)
+		policy.Evicted(c, item.priority)
+		if metrics.Enabled {
+			metrics.AddEviction(c.Function, policy.Name())
+		}
+
+		dismissed = append(dismissed, c.ContID)
+		cleanedMB += c.MemoryMB
+		evicted[item.pool] = item.fun
+	}
+
+	// third phase: containers are destroyed in parallel without holding any
+	// lock, and their memory is released once it is actually freed
+	var wg sync.WaitGroup
+	for _, contID := range dismissed {
+		wg.Add(1)
+		go func(contID container.ContainerID) {
+			defer wg.Done()
+			destroyContainer(contID)
+		}(contID)
+	}
+	wg.Wait()
+	releaseResources(0, cleanedMB)
+
+	// pools are never evicted below MinWarm, but MinWarm may have been
+	// raised by a function update in the meantime
+	for _, f := range evicted {
+		ProvisionMinWarm(f)
+	}
+
+	return cleanedMB >= requiredMemoryMB
+}
+
+// sortByEvictionOrder sorts containers by increasing retention priority.
+func sortByEvictionOrder(items []itemToDismiss) {
+	sort.SliceStable(items, func(i, j int) bool {
+		if items[i].priority != items[j].priority {
+			return items[i].priority < items[j].priority
+		}
+		return items[i].candidate.LastUsed.Before(items[j].candidate.LastUsed)
+	})
+}
+
+// removeWarmContainer removes a warm container from the pool, returning false
+// if it is no longer warm or the pool is at its floor.
+func (fp *ContainerPool) removeWarmContainer(contID container.ContainerID) bool {
+	fp.Lock()
+	defer fp.Unlock()
+	if int64(fp.warm.Len()) <= fp.fun.MinWarm {
+		return false
+	}
+	for elem := fp.warm.Front(); elem != nil; elem = elem.Next() {
+		if elem.Value.(*warmContainer).contID == contID {
+			fp.warm.Remove(elem)
+			return true
+		}
+	}
+	return false
+}
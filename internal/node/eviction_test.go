@@ -0,0 +1,172 @@
+package node
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/grussorusso/serverledge/internal/container"
+)
+
+// setEvictionPolicy replaces the eviction policy configured for the node.
+func setEvictionPolicy(p EvictionPolicy) {
+	evictionPolicyOnce.Do(func() {})
+	evictionPolicy = p
+}
+
+func TestEvictionPolicyPriorities(t *testing.T) {
+	now := time.Now()
+	recent := &EvictionCandidate{MemoryMB: 128, LastUsed: now, Frequency: 1, ColdStartTime: 1.0}
+	old := &EvictionCandidate{MemoryMB: 128, LastUsed: now.Add(-time.Minute), Frequency: 10, ColdStartTime: 1.0}
+	large := &EvictionCandidate{MemoryMB: 1024, LastUsed: now, Frequency: 10, ColdStartTime: 1.0}
+	slow := &EvictionCandidate{MemoryMB: 1024, LastUsed: now, Frequency: 10, ColdStartTime: 10.0}
+
+	// each pair is listed in eviction order
+	cases := []struct {
+		policy  EvictionPolicy
+		evicted *EvictionCandidate
+		kept    *EvictionCandidate
+	}{
+		{&LRUEvictionPolicy{}, old, recent},
+		{&LFUEvictionPolicy{}, recent, old},
+		{&GreedyDualEvictionPolicy{}, recent, old}, // less frequent
+		{&GreedyDualEvictionPolicy{}, large, old},  // larger
+		{&GreedyDualEvictionPolicy{}, large, slow}, // cheaper cold start
+	}
+	for i, c := range cases {
+		if c.policy.Priority(c.evicted) >= c.policy.Priority(c.kept) {
+			t.Errorf("case %d (%s): unexpected eviction order", i, c.policy.Name())
+		}
+	}
+}
+
+func TestGreedyDualAging(t *testing.T) {
+	p := &GreedyDualEvictionPolicy{}
+	frequent := &EvictionCandidate{MemoryMB: 100, Frequency: 100, ColdStartTime: 1.0}
+	rare := &EvictionCandidate{MemoryMB: 100, Frequency: 1, ColdStartTime: 1.0}
+
+	idle := p.Priority(frequent)
+	if idle <= p.Priority(rare) {
+		t.Fatalf("frequent functions are not favored")
+	}
+	// after enough evictions, containers idle since long are evicted before
+	// the ones that have just become idle
+	p.Evicted(frequent, idle)
+	if p.Priority(rare) <= idle {
+		t.Fatalf("the priority of new idle containers is not aged")
+	}
+}
+
+func TestDismissContainerOrder(t *testing.T) {
+	defer setEvictionPolicy(&LRUEvictionPolicy{})
+	setEvictionPolicy(&LFUEvictionPolicy{})
+	resetNode(512, 1.0)
+
+	hot := testFunction("hot", 128)
+	cold := testFunction("cold", 128)
+	for f, invocations := range map[string]int64{"hot": 100, "cold": 1} {
+		fp := lockFunctionPool(testFunction(f, 128))
+		fp.invocations = invocations
+		fp.Unlock()
+	}
+	addWarmContainers(t, hot, 2, time.Now().Add(time.Hour))
+	addWarmContainers(t, cold, 2, time.Now().Add(time.Hour))
+	expectAvailable(t, 0, 1.0)
+
+	if !dismissContainer(200) {
+		t.Fatalf("could not free 200 MB")
+	}
+	if status := WarmStatus(); status["hot"] != 2 || status["cold"] != 0 {
+		t.Fatalf("unexpected warm containers after eviction: %v", status)
+	}
+	expectAvailable(t, 256, 1.0)
+
+	// containers are not evicted if not enough memory can be freed
+	if dismissContainer(512) {
+		t.Fatalf("more memory than available freed")
+	}
+	if status := WarmStatus(); status["hot"] != 2 {
+		t.Fatalf("containers evicted in vain: %v", status)
+	}
+}
+
+func TestDismissContainerKeepsMinWarm(t *testing.T) {
+	resetNode(512, 1.0)
+
+	kept := testFunction("kept", 128)
+	other := testFunction("other", 128)
+	addWarmContainers(t, kept, 3, time.Now().Add(time.Hour))
+	addWarmContainers(t, other, 1, time.Now().Add(time.Hour))
+	kept.MinWarm = 2 // set afterwards, not to provision containers
+
+	if dismissContainer(384) {
+		t.Fatalf("MinWarm containers evicted")
+	}
+	if !dismissContainer(256) {
+		t.Fatalf("could not free 256 MB")
+	}
+	if status := WarmStatus(); status["kept"] != 2 || status["other"] != 0 {
+		t.Fatalf("unexpected warm containers after eviction: %v", status)
+	}
+	expectAvailable(t, 256, 1.0)
+}
+
+// slowFactory takes some time to destroy containers, as Docker does.
+type slowFactory struct {
+	fakeFactory
+	delay time.Duration
+}
+
+func (f *slowFactory) Destroy(contID container.ContainerID) error {
+	time.Sleep(f.delay)
+	return f.fakeFactory.Destroy(contID)
+}
+
+// BenchmarkDismissContainer evicts the warm containers of several functions
+// while another goroutine repeatedly locks all the pools, reporting the max
+// time it waited for the locks: as containers are destroyed without holding
+// any lock, it is expected to be much lower than the destruction delay.
+func BenchmarkDismissContainer(b *testing.B) {
+	const functions = 8
+	const delay = 10 * time.Millisecond
+
+	var maxWait time.Duration
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		resetNode(functions*2*128, 1.0)
+		container.SetFactory(&slowFactory{delay: delay})
+		for j := 0; j < functions; j++ {
+			addWarmContainers(b, testFunction(fmt.Sprintf("f%d", j), 128), 2, time.Now().Add(time.Hour))
+		}
+
+		done := make(chan struct{})
+		stopped := make(chan struct{})
+		go func() {
+			defer close(stopped)
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				start := time.Now()
+				WarmStatus()
+				if wait := time.Since(start); wait > maxWait {
+					maxWait = wait
+				}
+				time.Sleep(100 * time.Microsecond) // leave the CPU to the eviction
+			}
+		}()
+		b.StartTimer()
+
+		if !dismissContainer(functions * 2 * 128) {
+			b.Fatalf("could not free the memory")
+		}
+
+		b.StopTimer()
+		close(done)
+		<-stopped
+		b.StartTimer()
+	}
+	b.ReportMetric(float64(maxWait.Nanoseconds()), "max-lock-wait-ns")
+}
@@ -0,0 +1,227 @@
+package node
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/grussorusso/serverledge/internal/clock"
+	"github.com/grussorusso/serverledge/internal/config"
+	"github.com/grussorusso/serverledge/internal/container"
+	"github.com/grussorusso/serverledge/internal/function"
+)
+
+// Reasons reported for executions interrupted by the termination of their
+// container.
+const (
+	FAILURE_OOM_KILLED = "OOMKilled"
+	FAILURE_EXITED     = "ContainerExited"
+)
+
+var ContainerFailedErr = errors.New("the container terminated during the execution")
+
+// delay before subscribing again to container events after a failure
+const healthResubscribeDelay = 5 * time.Second
+
+// time the failure reason of a terminated container is kept, so that the
+// executions interrupted by the termination can report it
+const healthRetention = time.Minute
+
+// containerHealth tracks the liveness of a container.
+type containerHealth struct {
+	dead   chan struct{} // closed when the container terminates
+	oom    bool          // true if the kernel killed a process of the container
+	reason string        // set when the container terminates
+}
+
+var health = struct {
+	sync.Mutex
+	containers map[container.ContainerID]*containerHealth
+}{containers: make(map[container.ContainerID]*containerHealth)}
+
+// getHealth returns the health record of a container, creating it if needed.
+// The caller must hold the health lock.
+func getHealth(contID container.ContainerID) *containerHealth {
+	h, ok := health.containers[contID]
+	if !ok {
+		h = &containerHealth{dead: make(chan struct{})}
+		health.containers[contID] = h
+	}
+	return h
+}
+
+// StartHealthMonitor starts watching the termination of the containers of
+// the node, if enabled in the configuration. Terminated containers are
+// removed from the pools and, if configured, replaced by new warm ones.
+func StartHealthMonitor() {
+	if !config.GetBool(config.CONTAINER_HEALTH_MONITOR, true) {
+		return
+	}
+	go monitorHealth()
+}
+
+func monitorHealth() {
+	for {
+		ctx, cancel := context.WithCancel(context.Background())
+		events, errs := container.Events(ctx)
+		err := watchContainerEvents(events, errs)
+		cancel()
+		log.Printf("Container events subscription failed: %v\n", err)
+		time.Sleep(healthResubscribeDelay)
+	}
+}
+
+func watchContainerEvents(events <-chan container.ContainerEvent, errs <-chan error) error {
+	for {
+		select {
+		case event := <-events:
+			handleContainerEvent(event)
+		case err := <-errs:
+			return err
+		}
+	}
+}
+
+func handleContainerEvent(event container.ContainerEvent) {
+	switch event.Action {
+	case container.EVENT_OOM:
+		if ownsContainer(event.ID) {
+			log.Printf("Container %s ran out of memory\n", event.ID)
+			health.Lock()
+			getHealth(event.ID).oom = true
+			health.Unlock()
+		}
+	case container.EVENT_KILL:
+		if ownsContainer(event.ID) {
+			log.Printf("Container %s is being killed\n", event.ID)
+		}
+	case container.EVENT_DIE:
+		handleContainerTermination(event.ID, event.ExitCode)
+	}
+}
+
+// ownsContainer returns true if the container belongs to a pool of the node.
+func ownsContainer(contID container.ContainerID) bool {
+	for _, fp := range functionPools() {
+		if fp.hasContainer(contID) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasContainer returns true if the container belongs to the pool.
+func (fp *ContainerPool) hasContainer(contID container.ContainerID) bool {
+	fp.Lock()
+	defer fp.Unlock()
+	for elem := fp.warm.Front(); elem != nil; elem = elem.Next() {
+		if elem.Value.(*warmContainer).contID == contID {
+			return true
+		}
+	}
+	for elem := fp.running.Front(); elem != nil; elem = elem.Next() {
+		if elem.Value.(*containerRunning).contID == contID {
+			return true
+		}
+	}
+	return false
+}
+
+// handleContainerTermination removes a terminated container from its pool,
+// releasing its resources and interrupting the executions it was serving.
+// Containers destroyed by the node itself have already been removed.
+func handleContainerTermination(contID container.ContainerID, exitCode int) {
+	var fun *function.Function
+	for _, pool := range functionPools() {
+		if fun = pool.removeTerminatedContainer(contID); fun != nil {
+			break
+		}
+	}
+	if fun == nil {
+		return
+	}
+
+	health.Lock()
+	h := getHealth(contID)
+	if h.oom {
+		h.reason = FAILURE_OOM_KILLED
+	} else {
+		h.reason = FAILURE_EXITED
+	}
+	close(h.dead)
+	health.Unlock()
+	log.Printf("Container %s of %s terminated (exit code: %d, reason: %s)\n", contID, fun, exitCode, h.reason)
+
+	clock.AfterFunc(healthRetention, func() {
+		health.Lock()
+		delete(health.containers, contID)
+		health.Unlock()
+	})
+
+	forgetPaused(contID)
+	if err := container.Destroy(contID); err != nil {
+		log.Printf("Error while removing terminated container %s: %v\n", contID, err)
+	}
+
+	if config.GetBool(config.CONTAINER_HEALTH_REPLACE, false) {
+		if _, err := NewWarmContainer(fun, false); err != nil {
+			log.Printf("Could not replace terminated container %s: %v\n", contID, err)
+		}
+	}
+	ProvisionMinWarm(fun)
+}
+
+// removeTerminatedContainer removes a container from the pool, releasing all
+// of its resources. It returns the function of the container, or nil if the
+// container is not in the pool.
+func (fp *ContainerPool) removeTerminatedContainer(contID container.ContainerID) *function.Function {
+	fp.Lock()
+	defer fp.Unlock()
+	for elem := fp.warm.Front(); elem != nil; elem = elem.Next() {
+		if elem.Value.(*warmContainer).contID == contID {
+			fp.warm.Remove(elem)
+			releaseResources(0, elem.Value.(*warmContainer).res.memoryMB)
+			return fp.fun
+		}
+	}
+	for elem := fp.running.Front(); elem != nil; elem = elem.Next() {
+		if rc := elem.Value.(*containerRunning); rc.contID == contID {
+			fp.running.Remove(elem)
+			releaseResources(rc.res.cpu(rc.FuncCounter), rc.res.memory(rc.FuncCounter))
+			return fp.fun
+		}
+	}
+	return nil
+}
+
+// ContainerDied returns a channel that is closed if the container terminates
+// unexpectedly.
+func ContainerDied(contID container.ContainerID) <-chan struct{} {
+	health.Lock()
+	defer health.Unlock()
+	return getHealth(contID).dead
+}
+
+// FailureReason returns the reason of the termination of a container, or an
+// empty string if the container did not terminate unexpectedly.
+func FailureReason(contID container.ContainerID) string {
+	health.Lock()
+	defer health.Unlock()
+	if h, ok := health.containers[contID]; ok {
+		return h.reason
+	}
+	return ""
+}
+
+// forgetContainer discards the state of a container being destroyed by the
+// node.
+func forgetContainer(contID container.ContainerID) {
+	forgetPaused(contID)
+	health.Lock()
+	if h, ok := health.containers[contID]; ok && h.reason == "" {
+		delete(health.containers, contID)
+	}
+	health.Unlock()
+}
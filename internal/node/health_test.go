@@ -0,0 +1,123 @@
+package node
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/grussorusso/serverledge/internal/config"
+	"github.com/grussorusso/serverledge/internal/container"
+	"github.com/spf13/viper"
+)
+
+func expectDead(t *testing.T, contID container.ContainerID, reason string) {
+	t.Helper()
+	select {
+	case <-ContainerDied(contID):
+	default:
+		t.Fatalf("termination of %s not signalled", contID)
+	}
+	if r := FailureReason(contID); r != reason {
+		t.Fatalf("unexpected failure reason for %s: %q", contID, r)
+	}
+}
+
+func TestTerminationOfWarmContainer(t *testing.T) {
+	factory := resetNode(1024, 1.0)
+	f := testFunction("f", 128)
+	addWarmContainers(t, f, 2, time.Now().Add(time.Hour))
+
+	handleContainerEvent(container.ContainerEvent{ID: "f-0", Action: container.EVENT_DIE, ExitCode: 1})
+
+	if status := WarmStatus(); status[f.Name] != 1 {
+		t.Fatalf("terminated container still in the pool: %v", status)
+	}
+	expectAvailable(t, 896, 1.0)
+	if factory.destroyedCount() != 1 || factory.destroyed[0] != "f-0" {
+		t.Fatalf("terminated container not removed: %v", factory.destroyed)
+	}
+	expectDead(t, "f-0", FAILURE_EXITED)
+}
+
+func TestTerminationOfRunningContainer(t *testing.T) {
+	resetNode(1024, 1.0)
+	f := testFunction("f", 128)
+	addWarmContainers(t, f, 1, time.Now().Add(time.Hour))
+	contID, err := AcquireWarmContainer(f)
+	if err != nil {
+		t.Fatalf("could not acquire the warm container: %v", err)
+	}
+	died := ContainerDied(contID)
+
+	handleContainerEvent(container.ContainerEvent{ID: contID, Action: container.EVENT_OOM})
+	handleContainerEvent(container.ContainerEvent{ID: contID, Action: container.EVENT_DIE, ExitCode: 137})
+
+	select {
+	case <-died:
+	default:
+		t.Fatalf("the execution has not been interrupted")
+	}
+	expectDead(t, contID, FAILURE_OOM_KILLED)
+	// the resources of the execution are released as well
+	expectAvailable(t, 1024, 1.0)
+	if HasInitializedContainer(f) {
+		t.Fatalf("terminated container still in the pool")
+	}
+
+	// the later release of the execution is ignored
+	ReleaseResources(contID, f)
+	expectAvailable(t, 1024, 1.0)
+}
+
+func TestTerminationOfUnknownContainer(t *testing.T) {
+	factory := resetNode(1024, 1.0)
+	f := testFunction("f", 128)
+	addWarmContainers(t, f, 1, time.Now().Add(time.Hour))
+
+	// e.g., a container destroyed by the node itself
+	handleContainerEvent(container.ContainerEvent{ID: "other", Action: container.EVENT_OOM})
+	handleContainerEvent(container.ContainerEvent{ID: "other", Action: container.EVENT_DIE})
+	if factory.destroyedCount() != 0 || WarmStatus()[f.Name] != 1 {
+		t.Fatalf("unexpected removal of containers")
+	}
+	if FailureReason("other") != "" {
+		t.Fatalf("failure reported for an unknown container")
+	}
+	forgetContainer("other")
+}
+
+func TestTerminatedContainerReplacement(t *testing.T) {
+	defer viper.Set(config.CONTAINER_HEALTH_REPLACE, nil)
+	viper.Set(config.CONTAINER_HEALTH_REPLACE, true)
+	factory := resetNode(1024, 1.0)
+	f := testFunction("f", 128)
+	f.Runtime = container.CUSTOM_RUNTIME
+	f.CustomImage = "image"
+	addWarmContainers(t, f, 1, time.Now().Add(time.Hour))
+
+	handleContainerTermination("f-0", 1)
+	if factory.creationCount() != 1 {
+		t.Fatalf("terminated container not replaced")
+	}
+	// the fake factory cannot create containers
+	expectAvailable(t, 1024, 1.0)
+}
+
+func TestWatchContainerEvents(t *testing.T) {
+	resetNode(1024, 1.0)
+	events := make(chan container.ContainerEvent, 1)
+	errs := make(chan error, 1)
+	events <- container.ContainerEvent{ID: "c", Action: container.EVENT_KILL}
+
+	failure := errors.New("connection lost")
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		errs <- failure
+	}()
+	if err := watchContainerEvents(events, errs); err != failure {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(events) != 0 {
+		t.Fatalf("event not consumed")
+	}
+}
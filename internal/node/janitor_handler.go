@@ -1,6 +1,7 @@
 package node
 
 import (
+	"github.com/grussorusso/serverledge/internal/clock"
 	"github.com/grussorusso/serverledge/internal/config"
 	"sync"
 	"time"
@@ -31,7 +32,7 @@ func GetJanitorInstance() *janitor {
 }
 
 func (j *janitor) run() {
-	ticker := time.NewTicker(j.Interval)
+	ticker := clock.NewTicker(j.Interval)
 	for {
 		select {
 		case <-ticker.C:
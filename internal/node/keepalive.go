@@ -0,0 +1,209 @@
+package node
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/grussorusso/serverledge/internal/clock"
+	"github.com/grussorusso/serverledge/internal/config"
+	"github.com/grussorusso/serverledge/internal/function"
+)
+
+// Percentiles of the inter-arrival distribution used to derive the windows,
+// and safety margin applied to them, as in the hybrid histogram policy
+// proposed in "Serverless in the Wild" (Shahrad et al., ATC '20).
+const (
+	keepAliveHeadPercentile = 0.05
+	keepAliveTailPercentile = 0.99
+	keepAliveMargin         = 0.10
+)
+
+// interArrivalHistogram records the inter-arrival times of a function.
+type interArrivalHistogram struct {
+	lastArrival time.Time
+	bins        []int64
+	outOfRange  int64 // inter-arrival times exceeding the histogram range
+	samples     int64
+	pending     int // containers to be reloaded at the end of a pre-warm window
+}
+
+// KeepAliveStatus describes the inter-arrival histogram of a function and
+// the windows derived from it.
+type KeepAliveStatus struct {
+	Samples         int64
+	OutOfRange      int64
+	BinSeconds      float64
+	Histogram       []int64 // counts per bin (trailing empty bins are omitted)
+	Representative  bool    // whether the windows are derived from the histogram
+	PrewarmWindow   float64 // seconds after an execution before reloading the container
+	KeepAliveWindow float64 // seconds the container is kept warm (after the pre-warm window)
+	PendingReloads  int     // containers waiting for the end of their pre-warm window
+}
+
+type keepAliveTracker struct {
+	sync.Mutex
+	enabled    bool
+	binWidth   time.Duration
+	numBins    int
+	minSamples int64
+	functions  map[string]*interArrivalHistogram
+}
+
+var keepAlive *keepAliveTracker
+var keepAliveOnce sync.Once
+
+func getKeepAliveTracker() *keepAliveTracker {
+	keepAliveOnce.Do(func() {
+		binWidth := config.GetInt(config.CONTAINER_KEEPALIVE_BIN, 60)
+		if binWidth < 1 {
+			binWidth = 60
+		}
+		numBins := config.GetInt(config.CONTAINER_KEEPALIVE_BINS, 240)
+		if numBins < 1 {
+			numBins = 240
+		}
+		keepAlive = &keepAliveTracker{
+			enabled:    config.GetBool(config.CONTAINER_ADAPTIVE_KEEPALIVE, false),
+			binWidth:   time.Duration(binWidth) * time.Second,
+			numBins:    numBins,
+			minSamples: int64(config.GetInt(config.CONTAINER_KEEPALIVE_MIN_SAMPLES, 10)),
+			functions:  make(map[string]*interArrivalHistogram),
+		}
+	})
+	return keepAlive
+}
+
+// recordArrival updates the inter-arrival histogram of a function.
+func (t *keepAliveTracker) recordArrival(f *function.Function) {
+	if !t.enabled {
+		return
+	}
+
+	t.Lock()
+	defer t.Unlock()
+
+	now := clock.Now()
+	h, ok := t.functions[f.Name]
+	if !ok {
+		t.functions[f.Name] = &interArrivalHistogram{lastArrival: now, bins: make([]int64, t.numBins)}
+		return
+	}
+
+	bin := int(now.Sub(h.lastArrival) / t.binWidth)
+	if bin < t.numBins {
+		h.bins[bin]++
+	} else {
+		h.outOfRange++
+	}
+	h.samples++
+	h.lastArrival = now
+}
+
+// windows returns the pre-warm and keep-alive windows derived from the
+// histogram, if it is representative of the function arrival pattern.
+// The tracker must be locked by the caller.
+func (t *keepAliveTracker) windows(h *interArrivalHistogram) (prewarm, keepAlive time.Duration, ok bool) {
+	if h == nil || h.samples < t.minSamples || h.outOfRange*2 > h.samples {
+		// too few samples, or most inter-arrival times fall outside of
+		// the histogram range
+		return 0, 0, false
+	}
+
+	inRange := h.samples - h.outOfRange
+	head := int64(math.Ceil(keepAliveHeadPercentile * float64(inRange)))
+	tail := int64(math.Ceil(keepAliveTailPercentile * float64(inRange)))
+	headBin, tailBin := -1, t.numBins-1
+	var count int64 = 0
+	for i, c := range h.bins {
+		count += c
+		if headBin < 0 && count >= head {
+			headBin = i
+		}
+		if count >= tail {
+			tailBin = i
+			break
+		}
+	}
+
+	// the pre-warm window ends at the lower bound of the head bin, while the
+	// container is kept alive until the upper bound of the tail bin
+	prewarmEnd := float64(headBin) * t.binWidth.Seconds() * (1.0 - keepAliveMargin)
+	keepAliveEnd := float64(tailBin+1) * t.binWidth.Seconds() * (1.0 + keepAliveMargin)
+	prewarm = time.Duration(prewarmEnd * float64(time.Second))
+	keepAlive = time.Duration((keepAliveEnd - prewarmEnd) * float64(time.Second))
+	return prewarm, keepAlive, true
+}
+
+// keepAliveWindows returns the pre-warm and keep-alive windows for containers
+// of f that become idle. Without a representative histogram (or if the
+// function configures its own KeepAlive), containers are kept warm for the
+// configured expiration time.
+func keepAliveWindows(f *function.Function) (prewarm, keepAlive time.Duration) {
+	defaultKeepAlive := f.KeepAlive
+	if defaultKeepAlive <= 0 {
+		defaultKeepAlive = int64(config.GetInt(config.CONTAINER_EXPIRATION_TIME, 600))
+	}
+
+	t := getKeepAliveTracker()
+	if t.enabled && f.KeepAlive <= 0 {
+		t.Lock()
+		defer t.Unlock()
+		if prewarm, keepAlive, ok := t.windows(t.functions[f.Name]); ok {
+			return prewarm, keepAlive
+		}
+	}
+	return 0, time.Duration(defaultKeepAlive) * time.Second
+}
+
+// schedulePrewarm reloads a warm container for f at the end of the pre-warm
+// window.
+func schedulePrewarm(f *function.Function, prewarm time.Duration) {
+	t := getKeepAliveTracker()
+	t.Lock()
+	if h, ok := t.functions[f.Name]; ok {
+		h.pending++
+	}
+	t.Unlock()
+
+	clock.AfterFunc(prewarm, func() {
+		t.Lock()
+		if h, ok := t.functions[f.Name]; ok {
+			h.pending--
+		}
+		t.Unlock()
+
+		// prewarming must not evict other containers
+		_, _ = NewWarmContainer(f, false)
+	})
+}
+
+// KeepAliveStatusAll returns the inter-arrival histogram and the derived
+// windows for each function.
+func KeepAliveStatusAll() map[string]KeepAliveStatus {
+	t := getKeepAliveTracker()
+	t.Lock()
+	defer t.Unlock()
+
+	status := make(map[string]KeepAliveStatus)
+	for name, h := range t.functions {
+		last := len(h.bins)
+		for last > 0 && h.bins[last-1] == 0 {
+			last--
+		}
+		s := KeepAliveStatus{
+			Samples:        h.samples,
+			OutOfRange:     h.outOfRange,
+			BinSeconds:     t.binWidth.Seconds(),
+			Histogram:      append([]int64{}, h.bins[:last]...),
+			PendingReloads: h.pending,
+		}
+		if prewarm, keepAlive, ok := t.windows(h); ok {
+			s.Representative = true
+			s.PrewarmWindow = prewarm.Seconds()
+			s.KeepAliveWindow = keepAlive.Seconds()
+		}
+		status[name] = s
+	}
+	return status
+}
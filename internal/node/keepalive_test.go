@@ -0,0 +1,117 @@
+package node
+
+import (
+	"testing"
+	"time"
+
+	"github.com/grussorusso/serverledge/internal/function"
+)
+
+// newTestKeepAliveTracker returns an enabled tracker with 10 bins of 60 s,
+// installing it as the tracker of the node until the end of the test.
+func newTestKeepAliveTracker(test *testing.T) *keepAliveTracker {
+	t := &keepAliveTracker{
+		enabled:    true,
+		binWidth:   time.Minute,
+		numBins:    10,
+		minSamples: 10,
+		functions:  make(map[string]*interArrivalHistogram),
+	}
+	previous := getKeepAliveTracker()
+	keepAlive = t
+	test.Cleanup(func() { keepAlive = previous })
+	return t
+}
+
+// histogram returns a histogram with the given bin counts.
+func histogram(outOfRange int64, bins ...int64) *interArrivalHistogram {
+	h := &interArrivalHistogram{bins: make([]int64, 10), outOfRange: outOfRange, samples: outOfRange}
+	for i, c := range bins {
+		h.bins[i] = c
+		h.samples += c
+	}
+	return h
+}
+
+func TestKeepAliveRecordArrival(t *testing.T) {
+	tracker := newTestKeepAliveTracker(t)
+	f := testFunction("f", 128)
+
+	// the first arrival only starts the histogram
+	tracker.recordArrival(f)
+	h := tracker.functions[f.Name]
+	if h == nil || h.samples != 0 {
+		t.Fatalf("unexpected histogram after the first arrival: %+v", h)
+	}
+
+	h.lastArrival = h.lastArrival.Add(-150 * time.Second)
+	tracker.recordArrival(f)
+	if h.bins[2] != 1 || h.samples != 1 {
+		t.Fatalf("inter-arrival time not recorded in the third bin: %v", h.bins)
+	}
+
+	h.lastArrival = h.lastArrival.Add(-time.Hour)
+	tracker.recordArrival(f)
+	if h.outOfRange != 1 || h.samples != 2 {
+		t.Fatalf("inter-arrival time not recorded as out of range: %+v", h)
+	}
+
+	tracker.enabled = false
+	tracker.recordArrival(f)
+	if h.samples != 2 {
+		t.Fatalf("arrival recorded by a disabled tracker")
+	}
+}
+
+func TestKeepAliveWindows(t *testing.T) {
+	tracker := newTestKeepAliveTracker(t)
+
+	// head in the third bin, tail in the fifth one
+	prewarm, keepAlive, ok := tracker.windows(histogram(0, 0, 0, 5, 10, 5))
+	if !ok {
+		t.Fatalf("representative histogram ignored")
+	}
+	if prewarm != 108*time.Second || keepAlive != 222*time.Second {
+		t.Fatalf("unexpected windows: pre-warm %v, keep-alive %v", prewarm, keepAlive)
+	}
+
+	// arrivals in the first bin: no pre-warm
+	prewarm, keepAlive, _ = tracker.windows(histogram(0, 20))
+	if prewarm != 0 || keepAlive != 66*time.Second {
+		t.Fatalf("unexpected windows: pre-warm %v, keep-alive %v", prewarm, keepAlive)
+	}
+
+	cases := map[string]*interArrivalHistogram{
+		"no samples":        nil,
+		"too few samples":   histogram(0, 0, 9),
+		"mostly too long":   histogram(6, 0, 5),
+		"only out of range": histogram(10),
+	}
+	for name, h := range cases {
+		if _, _, ok := tracker.windows(h); ok {
+			t.Errorf("%s: windows derived from an unrepresentative histogram", name)
+		}
+	}
+}
+
+func TestKeepAliveWindowsFallback(t *testing.T) {
+	tracker := newTestKeepAliveTracker(t)
+
+	f := testFunction("f", 128)
+	tracker.functions[f.Name] = histogram(0, 0, 0, 5, 10, 5)
+	if prewarm, keepAlive := keepAliveWindows(f); prewarm != 108*time.Second || keepAlive != 222*time.Second {
+		t.Fatalf("histogram windows not used: %v, %v", prewarm, keepAlive)
+	}
+
+	// functions configuring their own KeepAlive
+	custom := &function.Function{Name: f.Name, KeepAlive: 30}
+	if prewarm, keepAlive := keepAliveWindows(custom); prewarm != 0 || keepAlive != 30*time.Second {
+		t.Fatalf("function keep-alive not used: %v, %v", prewarm, keepAlive)
+	}
+
+	// functions without a representative histogram
+	tracker.functions[f.Name] = histogram(0, 0, 9)
+	if prewarm, keepAlive := keepAliveWindows(f); prewarm != 0 || keepAlive != 600*time.Second {
+		t.Fatalf("default expiration time not used: %v, %v", prewarm, keepAlive)
+	}
+}
@@ -10,16 +10,31 @@ var OutOfResourcesErr = errors.New("not enough resources for function execution"
 
 var NodeIdentifier string
 
+// NodeResources tracks the containers and the free resources of the node.
+// The embedded lock only protects the ContainerPools map, whereas each pool
+// is protected by its own lock. Available resources are protected by a
+// separate ledger lock, and are read through Available once the node is
+// running.
 type NodeResources struct {
 	sync.RWMutex
 	AvailableMemMB int64
 	AvailableCPUs  float64
 	DropCount      int64
 	ContainerPools map[string]*ContainerPool
+
+	ledger sync.Mutex
+}
+
+// Available returns the memory (MB) and CPUs currently available.
+func (n *NodeResources) Available() (int64, float64) {
+	n.ledger.Lock()
+	defer n.ledger.Unlock()
+	return n.AvailableMemMB, n.AvailableCPUs
 }
 
 func (n *NodeResources) String() string {
-	return fmt.Sprintf("[CPUs: %f - Mem: %d]", n.AvailableCPUs, n.AvailableMemMB)
+	memMB, cpus := n.Available()
+	return fmt.Sprintf("[CPUs: %f - Mem: %d]", cpus, memMB)
 }
 
 var Resources NodeResources
@@ -0,0 +1,95 @@
+package node
+
+import (
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/grussorusso/serverledge/internal/clock"
+	"github.com/grussorusso/serverledge/internal/config"
+	"github.com/grussorusso/serverledge/internal/container"
+)
+
+// pauseState tracks whether a warm container is paused. Pause and unpause
+// requests are serialized by the mutex, which also guards paused, while
+// wanted records the last state requested for the container: a pause
+// request sent after the container has been taken from the warm pool is
+// not performed.
+type pauseState struct {
+	sync.Mutex
+	paused bool
+	wanted atomic.Bool
+}
+
+// pause states of the containers, indexed by container ID
+var pauseStates sync.Map
+
+// pauseIfEnabled pauses a container that has been moved to the warm pool, if
+// configured. The container is paused asynchronously, so that the caller may
+// hold the lock of its pool.
+func pauseIfEnabled(contID container.ContainerID) {
+	if !config.GetBool(config.CONTAINER_PAUSE_IDLE, false) {
+		return
+	}
+
+	v, _ := pauseStates.LoadOrStore(contID, &pauseState{})
+	s := v.(*pauseState)
+	s.wanted.Store(true)
+	go func() {
+		s.Lock()
+		defer s.Unlock()
+		if !s.wanted.Load() || s.paused {
+			return
+		}
+		err := container.Pause(contID)
+		if err == nil {
+			s.paused = true
+			return
+		}
+		log.Printf("Could not pause container %s: %v\n", contID, err)
+		s.paused = isPaused(contID)
+	}()
+}
+
+// isPaused returns whether a container is paused after a failed pause or
+// unpause request. If its state cannot be retrieved, the container is
+// assumed to be paused, so that it is unpaused before being used.
+func isPaused(contID container.ContainerID) bool {
+	paused, err := container.IsPaused(contID)
+	if err != nil {
+		log.Printf("Could not retrieve the state of container %s: %v\n", contID, err)
+		return true
+	}
+	return paused
+}
+
+// forgetPaused discards the pause state of a container being destroyed.
+func forgetPaused(contID container.ContainerID) {
+	pauseStates.Delete(contID)
+}
+
+// UnpauseContainer resumes a container taken from the warm pool, if it was
+// paused, and returns the time spent. It must be called before sending
+// requests to the container.
+func UnpauseContainer(contID container.ContainerID) (time.Duration, error) {
+	v, ok := pauseStates.Load(contID)
+	if !ok {
+		return 0, nil
+	}
+	s := v.(*pauseState)
+	s.wanted.Store(false)
+
+	t0 := clock.Now()
+	s.Lock() // the container may still be pausing
+	defer s.Unlock()
+	if !s.paused {
+		return clock.Since(t0), nil
+	}
+	err := container.Unpause(contID)
+	if err != nil && !isPaused(contID) {
+		err = nil
+	}
+	s.paused = err != nil
+	return clock.Since(t0), err
+}
@@ -0,0 +1,122 @@
+package node
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/grussorusso/serverledge/internal/config"
+	"github.com/grussorusso/serverledge/internal/container"
+	"github.com/spf13/viper"
+)
+
+// pausingFactory keeps the pause state of containers, failing to pause
+// containers already paused as Docker does.
+type pausingFactory struct {
+	fakeFactory
+	paused map[container.ContainerID]bool
+}
+
+func (f *pausingFactory) Pause(contID container.ContainerID) error {
+	f.Lock()
+	defer f.Unlock()
+	if f.paused[contID] {
+		return fmt.Errorf("container %s is already paused", contID)
+	}
+	f.paused[contID] = true
+	return nil
+}
+
+func (f *pausingFactory) Unpause(contID container.ContainerID) error {
+	f.Lock()
+	defer f.Unlock()
+	if !f.paused[contID] {
+		return fmt.Errorf("container %s is not paused", contID)
+	}
+	f.paused[contID] = false
+	return nil
+}
+
+func (f *pausingFactory) Inspect(contID container.ContainerID) (*container.ContainerInfo, error) {
+	f.Lock()
+	defer f.Unlock()
+	info := &container.ContainerInfo{ID: contID, State: container.STATE_RUNNING}
+	if f.paused[contID] {
+		info.State = container.STATE_PAUSED
+	}
+	return info, nil
+}
+
+func (f *pausingFactory) isPaused(contID container.ContainerID) bool {
+	f.Lock()
+	defer f.Unlock()
+	return f.paused[contID]
+}
+
+func newPausingFactory(t *testing.T) *pausingFactory {
+	viper.Set(config.CONTAINER_PAUSE_IDLE, true)
+	t.Cleanup(func() { viper.Set(config.CONTAINER_PAUSE_IDLE, nil) })
+	factory := &pausingFactory{paused: make(map[container.ContainerID]bool)}
+	container.SetFactory(factory)
+	return factory
+}
+
+// waitPaused waits for the asynchronous pausing of a container.
+func waitPaused(t *testing.T, factory *pausingFactory, contID container.ContainerID) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !factory.isPaused(contID) {
+		if time.Now().After(deadline) {
+			t.Fatalf("container %s not paused", contID)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestUnpauseRewarmedContainer(t *testing.T) {
+	factory := newPausingFactory(t)
+	contID := container.ContainerID("c")
+	defer forgetPaused(contID)
+
+	pauseIfEnabled(contID)
+	waitPaused(t, factory, contID)
+	// the container is put back in the warm pool before being used
+	pauseIfEnabled(contID)
+
+	// all the executions sharing the container wait for it to be unpaused
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := UnpauseContainer(contID); err != nil {
+				t.Errorf("could not unpause the container: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if factory.isPaused(contID) {
+		t.Fatalf("the container is still paused")
+	}
+
+	// the container can be paused again once idle
+	pauseIfEnabled(contID)
+	waitPaused(t, factory, contID)
+}
+
+func TestUnpauseBeforePausing(t *testing.T) {
+	factory := newPausingFactory(t)
+	contID := container.ContainerID("c")
+	defer forgetPaused(contID)
+
+	// the container is acquired while (or before) being paused
+	pauseIfEnabled(contID)
+	if _, err := UnpauseContainer(contID); err != nil {
+		t.Fatalf("could not unpause the container: %v", err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if factory.isPaused(contID) {
+		t.Fatalf("the container has been paused while in use")
+	}
+}
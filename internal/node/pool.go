@@ -5,26 +5,80 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"sync"
 	"time"
 
-	"github.com/grussorusso/serverledge/internal/config"
+	"github.com/grussorusso/serverledge/internal/clock"
 	"github.com/grussorusso/serverledge/internal/container"
 	"github.com/grussorusso/serverledge/internal/function"
 )
 
+// ContainerPool holds the containers of a function. Each pool has its own
+// lock, which is never held while interacting with the container runtime.
+// Locks are acquired in this order: Resources (only to look up pools), pool,
+// resource ledger.
 type ContainerPool struct {
-	running *list.List // list of ContainerRunning
-	warm    *list.List // list of warmContainer
+	sync.Mutex
+	running      *list.List         // list of ContainerRunning
+	warm         *list.List         // list of warmContainer
+	maxInstances int64              // configured upper limit of instances per container
+	fun          *function.Function // latest descriptor of the function
+	concurrency  *concurrencyModel
+
+	invocations   int64   // function instances served by the pool
+	coldStarts    int64   // cold starts observed for the function
+	coldStartTime float64 // average cold start time (s)
+	executions    int64   // executions observed for the function
+	avgDuration   float64 // average execution time (s)
+	provisioning  int64   // warm containers being created to reach MinWarm
+}
+
+// reservation records the resources committed for a container when it was
+// created. They are released in the same amounts, even if the function is
+// updated in the meantime.
+type reservation struct {
+	memoryMB         int64   // memory of the container, kept while warm
+	baseCPU          float64 // CPU of the container, only while running
+	instanceCPU      float64 // CPU of each instance
+	instanceMemoryMB int64   // memory of each instance
+}
+
+func reservationFor(f *function.Function) reservation {
+	return reservation{
+		memoryMB:         f.MemoryMB,
+		baseCPU:          f.BaseCPUDemand,
+		instanceCPU:      f.CPUDemand,
+		instanceMemoryMB: f.MemoryPerInstanceMB,
+	}
+}
+
+// cpu returns the CPU committed for a container serving the given number of
+// instances.
+func (r reservation) cpu(instances int64) float64 {
+	return r.baseCPU + float64(instances)*r.instanceCPU
+}
+
+// memory returns the memory committed for a container serving the given
+// number of instances.
+func (r reservation) memory(instances int64) int64 {
+	return r.memoryMB + instances*r.instanceMemoryMB
 }
 
 type warmContainer struct {
 	Expiration int64
 	contID     container.ContainerID
+	info       *container.ContainerInfo // recorded at creation
+	res        reservation
+	lastUsed   time.Time
+	priority   float64 // retention priority assigned by the eviction policy
+	autoscaled bool    // true if prewarmed by the autoscaler and never used
 }
 
 type containerRunning struct {
 	FuncCounter int64
 	contID      container.ContainerID
+	info        *container.ContainerInfo // recorded at creation
+	res         reservation
 }
 
 var NoWarmFoundErr = errors.New("no warm container is available")
@@ -32,95 +86,148 @@ var NoRunningContErr = errors.New("no running container is available")
 
 // getFunctionPool retrieves (or creates) the container pool for a function.
 func getFunctionPool(f *function.Function) *ContainerPool {
+	if fp, ok := lookupFunctionPool(f.Name); ok {
+		return fp
+	}
 
+	Resources.Lock()
+	defer Resources.Unlock()
 	if fp, ok := Resources.ContainerPools[f.Name]; ok {
 		return fp
 	}
-
 	fp := newFunctionPool(f)
 	Resources.ContainerPools[f.Name] = fp
+	if f.MinWarm > 0 {
+		go ProvisionMinWarm(f)
+	}
 	return fp
 }
 
-func (fp *ContainerPool) getRunningContainer(maxIstances int64) (container.ContainerID, bool) {
+// lookupFunctionPool retrieves the container pool for a function, if any.
+func lookupFunctionPool(name string) (*ContainerPool, bool) {
+	Resources.RLock()
+	defer Resources.RUnlock()
+	fp, ok := Resources.ContainerPools[name]
+	return fp, ok
+}
+
+// lockFunctionPool retrieves (or creates) the container pool for a function
+// and locks it. The caller must unlock the pool.
+func lockFunctionPool(f *function.Function) *ContainerPool {
+	fp := getFunctionPool(f)
+	fp.Lock()
+	fp.maxInstances = f.MaxFunctionInstances
+	fp.fun = f
+	return fp
+}
 
-	elem := fp.running.Front()
-	if elem == nil {
-		return "", false
+// functionPools returns the current container pools.
+func functionPools() []*ContainerPool {
+	Resources.RLock()
+	defer Resources.RUnlock()
+	pools := make([]*ContainerPool, 0, len(Resources.ContainerPools))
+	for _, fp := range Resources.ContainerPools {
+		pools = append(pools, fp)
 	}
+	return pools
+}
 
-	for elem != nil {
-		containerElem := elem.Value.(*containerRunning)
-		countIstances := containerElem.FuncCounter + 1
-		if countIstances <= maxIstances {
-			containerElem.FuncCounter = countIstances
-			log.Printf("Container %s has been used, function instances: %d.\n", containerElem.contID, containerElem.FuncCounter)
-			return containerElem.contID, true
-		} else {
-			log.Printf("Container %s, function instances limit exceeded.\n", containerElem.contID)
-		}
-		elem = elem.Next()
-	}
+// useRunningContainer adds an instance to the running container in elem,
+// returning its ID and the number of instances it serves.
+func (fp *ContainerPool) useRunningContainer(elem *list.Element) (container.ContainerID, int64) {
+	containerElem := elem.Value.(*containerRunning)
+	containerElem.FuncCounter++
+	fp.invocations++
+	log.Printf("Container %s has been used, function instances: %d.\n", containerElem.contID, containerElem.FuncCounter)
+	return containerElem.contID, containerElem.FuncCounter
+}
 
-	return "", false
+// pickRunningContainer selects a running container with a free slot, using
+// the strategy of the latest descriptor of the function.
+func (fp *ContainerPool) pickRunningContainer(maxIstances int64) *list.Element {
+	return selectorFor(fp.fun).Select(fp.running, maxIstances)
 }
 
-func (fp *ContainerPool) putRunningContainer(contID container.ContainerID) {
+func (fp *ContainerPool) putRunningContainer(info *container.ContainerInfo, res reservation) {
+	fp.invocations++
 	fp.running.PushFront(&containerRunning{
-		contID:      contID,
+		contID:      info.ID,
+		info:        info,
+		res:         res,
 		FuncCounter: 1,
 	})
 }
 
-func (fp *ContainerPool) putwarmContainer(contID container.ContainerID, expiration int64) {
-	fp.warm.PushBack(&warmContainer{
-		contID:     contID,
+func (fp *ContainerPool) putwarmContainer(info *container.ContainerInfo, res reservation, expiration int64) {
+	wc := &warmContainer{
+		contID:     info.ID,
+		info:       info,
+		res:        res,
 		Expiration: expiration,
-	})
+		lastUsed:   clock.Now(),
+	}
+	wc.priority = getEvictionPolicy().Priority(fp.evictionCandidate(wc))
+	fp.warm.PushBack(wc)
+	pauseIfEnabled(info.ID)
 }
 
-func newFunctionPool(_ *function.Function) *ContainerPool {
+func newFunctionPool(f *function.Function) *ContainerPool {
 	fp := &ContainerPool{}
 	fp.running = list.New()
 	fp.warm = list.New()
+	fp.maxInstances = f.MaxFunctionInstances
+	fp.fun = f
+	fp.concurrency = newConcurrencyModel()
 
 	return fp
 }
 
-// AcquireResources reserves the specified amount of cpu and memory if possible.
-func AcquireResources(cpuDemand float64, memDemand int64, destroyContainersIfNeeded bool) bool {
-	Resources.Lock()
-	defer Resources.Unlock()
-	return acquireResources(cpuDemand, memDemand, destroyContainersIfNeeded)
+// AcquireResourcesForNewContainer reserves the resources needed to start a
+// new container for the function and serve its first instance.
+func AcquireResourcesForNewContainer(f *function.Function, destroyContainersIfNeeded bool) bool {
+	return AcquireResources(f.ContainerCPUDemand(1), f.ContainerMemoryMB(1), destroyContainersIfNeeded)
 }
 
-// acquireResources reserves the specified amount of cpu and memory if possible.
-// The function is NOT thread-safe.
-func acquireResources(cpuDemand float64, memDemand int64, destroyContainersIfNeeded bool) bool {
-
-	if Resources.AvailableCPUs < cpuDemand {
+// AcquireResources reserves the specified amount of cpu and memory if possible.
+// If memory is lacking, warm containers may be evicted to free it.
+// No pool must be locked by the caller.
+func AcquireResources(cpuDemand float64, memDemand int64, destroyContainersIfNeeded bool) bool {
+	if acquireResources(cpuDemand, memDemand) {
+		return true
+	}
+	if !destroyContainersIfNeeded {
 		return false
 	}
-	if Resources.AvailableMemMB < memDemand {
-		if !destroyContainersIfNeeded {
-			return false
-		}
 
-		enoughMem, _ := dismissContainer(memDemand)
-		if !enoughMem {
-			return false
-		}
+	Resources.ledger.Lock()
+	enoughCPU := Resources.AvailableCPUs >= cpuDemand
+	missingMemMB := memDemand - Resources.AvailableMemMB
+	Resources.ledger.Unlock()
+	if !enoughCPU || !dismissContainer(missingMemMB) {
+		return false
 	}
+	// the freed memory may have been taken by others in the meantime
+	return acquireResources(cpuDemand, memDemand)
+}
 
+// acquireResources reserves the specified amount of cpu and memory if
+// available.
+func acquireResources(cpuDemand float64, memDemand int64) bool {
+	Resources.ledger.Lock()
+	defer Resources.ledger.Unlock()
+
+	if Resources.AvailableCPUs < cpuDemand || Resources.AvailableMemMB < memDemand {
+		return false
+	}
 	Resources.AvailableCPUs -= cpuDemand
 	Resources.AvailableMemMB -= memDemand
-
 	return true
 }
 
 // releaseResources releases the specified amount of cpu and memory.
-// The function is NOT thread-safe.
 func releaseResources(cpuDemand float64, memDemand int64) {
+	Resources.ledger.Lock()
+	defer Resources.ledger.Unlock()
 	Resources.AvailableCPUs += cpuDemand
 	Resources.AvailableMemMB += memDemand
 }
@@ -129,34 +236,56 @@ func releaseResources(cpuDemand float64, memDemand int64) {
 // The function returns an error if either:
 // (i) the container does not exist
 // (ii) there are not enough resources to use the container busy with some function
-func AcquireRunningContainer(f *function.Function) (container.ContainerID, error) {
-	Resources.Lock()
-	defer Resources.Unlock()
+// Otherwise, it also returns the number of instances sharing the container,
+// including the new one.
+func AcquireRunningContainer(f *function.Function) (container.ContainerID, int64, error) {
+	fp := lockFunctionPool(f)
+	defer fp.Unlock()
+	maxInstances := fp.concurrency.admissionLimit(f.MaxFunctionInstances)
 
-	fp := getFunctionPool(f)
-
-	contID, found := fp.getRunningContainer(f.MaxFunctionInstances)
 	//check running container, if any
-	if !found {
+	elem := fp.pickRunningContainer(maxInstances)
+	if elem == nil {
 		log.Printf("no running container is available for %s", f)
-		return "", NoRunningContErr
+		return "", 0, NoRunningContErr
+	}
+
+	// every additional instance commits its own resources
+	res := elem.Value.(*containerRunning).res
+	if !acquireResources(res.instanceCPU, res.instanceMemoryMB) {
+		log.Printf("Not enough resources for a new instance of %s", f)
+		return "", 0, OutOfResourcesErr
 	}
 
+	contID, instances := fp.useRunningContainer(elem)
+
 	//log.Printf("Using %s for %s. Now: %v", contID, f, Resources)
-	return contID, nil
+	return contID, instances, nil
+}
+
+// HasInitializedContainer returns true if a running container with a free
+// slot or a warm container is available for the function. No resource is
+// reserved, hence the result is only a hint for scheduling decisions.
+func HasInitializedContainer(f *function.Function) bool {
+	fp, ok := lookupFunctionPool(f.Name)
+	if !ok {
+		return false
+	}
+	fp.Lock()
+	defer fp.Unlock()
+	if fp.warm.Len() > 0 {
+		return true
+	}
+	return fp.pickRunningContainer(fp.concurrency.effectiveLimit(f.MaxFunctionInstances)) != nil
 }
 
 // ReleaseResources puts a container in the warm pool for a function if the counter of istance is zero.
 // ReleaseResources puts a container in the warm pool for a function if the counter of instances is zero.
 func ReleaseResources(containerID container.ContainerID, f *function.Function) {
-	// Imposta l'expiration time come durata da ora
-	d := time.Duration(config.GetInt(config.CONTAINER_EXPIRATION_TIME, 600)) * time.Second
-	expTime := time.Now().Add(d).UnixNano()
+	prewarm, keepAlive := keepAliveWindows(f)
 
-	Resources.Lock()
-	defer Resources.Unlock()
-
-	fp := getFunctionPool(f)
+	fp := lockFunctionPool(f)
+	defer fp.Unlock()
 
 	// Aggiorna la lista runningContainer decrementando il contatore di istanze o rimuovendo l'elemento se il contatore arriva a zero
 	elem := fp.running.Front()
@@ -165,37 +294,69 @@ func ReleaseResources(containerID container.ContainerID, f *function.Function) {
 		nextElem := elem.Next() // Memorizza il prossimo elemento prima di una possibile rimozione
 
 		if container.contID == containerID {
+			res := container.res
 			container.FuncCounter--
+			releaseResources(res.instanceCPU, res.instanceMemoryMB) // resources of the completed instance
 			if container.FuncCounter <= 0 {
 				fp.running.Remove(elem)
-				fp.putwarmContainer(containerID, expTime)
-
-				releaseResources(f.CPUDemand, 0) // Rilascia risorse CPU per il container
-
-				break // Esci dal loop poiché il container è stato rimosso e rilasciato
+				releaseResources(res.baseCPU, 0) // warm containers only keep their memory
+
+				if prewarm > 0 && int64(fp.warm.Len()) >= f.MinWarm {
+					// the next invocation is not expected before the
+					// end of the pre-warm window: unload the container
+					// and reload it later
+					releaseResources(0, res.memoryMB)
+					go destroyContainer(containerID)
+					schedulePrewarm(f, prewarm)
+				} else {
+					// Imposta l'expiration time come durata da ora
+					expTime := clock.Now().Add(prewarm + keepAlive).UnixNano()
+					fp.putwarmContainer(container.info, res, expTime)
+				}
 			}
+			break // Esci dal loop: il container è stato trovato
 		}
 		elem = nextElem
 	}
 
 }
 
+func destroyContainer(contID container.ContainerID) {
+	forgetContainer(contID)
+	if err := container.Destroy(contID); err != nil {
+		log.Printf("Error while destroying container %s: %s\n", contID, err)
+	}
+}
+
 // NewContainer creates and starts a new container for the given function.
 // The container can be directly used to schedule a request.
 func NewContainer(fun *function.Function) (container.ContainerID, error) {
-	Resources.Lock()
-	if !acquireResources(fun.CPUDemand, fun.MemoryMB, true) {
+	if !AcquireResources(fun.ContainerCPUDemand(1), fun.ContainerMemoryMB(1), true) {
 		log.Printf("Not enough resources for the new container.")
-		Resources.Unlock()
 		return "", OutOfResourcesErr
 	}
 
-	//log.Printf("Acquired resources for new container. Now: %v", Resources)
-	Resources.Unlock()
-
 	return NewContainerWithAcquiredResources(fun)
 }
 
+// containerOptions returns the options to create a container for the
+// function. The container is capped to the resources of all of its instances.
+func containerOptions(fun *function.Function) *container.ContainerOptions {
+	opts := &container.ContainerOptions{
+		MemoryMB:    fun.ContainerMemoryMB(fun.MaxFunctionInstances),
+		CPUQuota:    fun.ContainerCPUDemand(fun.MaxFunctionInstances),
+		Concurrency: int(fun.MaxFunctionInstances),
+		Labels: map[string]string{
+			container.LABEL_OWNER:       OwnerID(),
+			container.LABEL_INSTANCE:    NodeIdentifier,
+			container.LABEL_FUNCTION:    fun.Name,
+			container.LABEL_CODE_DIGEST: fun.CodeDigest(),
+		},
+	}
+	container.SetNetworkOptions(opts, fun.Name)
+	return opts
+}
+
 func getImageForFunction(fun *function.Function) (string, error) {
 	var image string
 	if fun.Runtime == container.CUSTOM_RUNTIME {
@@ -219,7 +380,7 @@ func (fp *ContainerPool) getWarmContainer() (container.ContainerID, bool) {
 	}
 
 	wc := fp.warm.Remove(elem).(*warmContainer)
-	fp.putRunningContainer(wc.contID)
+	fp.putRunningContainer(wc.info, wc.res)
 
 	return wc.contID, true
 }
@@ -232,27 +393,29 @@ func (fp *ContainerPool) getWarmContainer() (container.ContainerID, bool) {
 // (i) the warm container does not exist
 // (ii) there are not enough resources to start the container
 func AcquireWarmContainer(f *function.Function) (container.ContainerID, error) {
-	Resources.Lock()
-	defer Resources.Unlock()
-
-	fp := getFunctionPool(f)
-	contID, found := fp.getWarmContainer()
-	if !found {
+	fp := lockFunctionPool(f)
+	defer fp.Unlock()
+	if fp.warm.Len() == 0 {
 		return "", NoWarmFoundErr
 	}
 
-	if !acquireResources(f.CPUDemand, 0, false) {
+	// memory for the container itself has already been committed
+	res := fp.warm.Front().Value.(*warmContainer).res
+	if !acquireResources(res.cpu(1), res.instanceMemoryMB) {
 		log.Printf("Not enough CPU to start a warm container for %s", f)
 		return "", OutOfResourcesErr
 	}
 
+	contID, _ := fp.getWarmContainer()
+
 	//log.Printf("Using warm %s for %s. Now: %v", contID, f, Resources)
 	return contID, nil
 }
 
 /* A warm container is acquired assuming that the resources have already been obtained. */
 func WarmContainerWithAcquiredResources(f *function.Function) (container.ContainerID, error) {
-	fp := getFunctionPool(f)
+	fp := lockFunctionPool(f)
+	defer fp.Unlock()
 
 	contID, found := fp.getWarmContainer()
 	if !found {
@@ -272,127 +435,101 @@ func NewContainerWithAcquiredResources(fun *function.Function) (container.Contai
 		return "", err
 	}
 
-	contID, err := container.NewContainer(image, fun.TarFunctionCode, &container.ContainerOptions{
-		MemoryMB: fun.MemoryMB,
-		CPUQuota: fun.CPUDemand,
-	})
+	info, err := container.NewContainer(image, fun.TarFunctionCode, containerOptions(fun))
 
-	Resources.Lock()
-	defer Resources.Unlock()
 	if err != nil {
 		log.Printf("Failed container creation for [%s]: %v\n", fun.Name, err)
-		releaseResources(fun.CPUDemand, fun.MemoryMB)
+		releaseResources(fun.ContainerCPUDemand(1), fun.ContainerMemoryMB(1))
 		return "", err
 	}
 
-	fp := getFunctionPool(fun)
-	fp.putRunningContainer(contID)
+	fp := lockFunctionPool(fun)
+	defer fp.Unlock()
+	fp.putRunningContainer(info, reservationFor(fun))
 
-	return contID, nil
+	return info.ID, nil
 }
 
-type itemToDismiss struct {
-	contID container.ContainerID
-	pool   *ContainerPool
-	elem   *list.Element
-	memory int64
-}
-
-// dismissContainer ... this function is used to get free memory used for a new container
-// 2-phases: first, we find warm container and collect them as a slice, second (cleanup phase) we delete the container only and only if
-// the sum of their memory is >= requiredMemoryMB is
-func dismissContainer(requiredMemoryMB int64) (bool, error) {
-	var cleanedMB int64 = 0
-	var containerToDismiss []itemToDismiss
-	res := false
-
-	//first phase, research
-	for _, funPool := range Resources.ContainerPools {
-		if funPool.warm.Len() > 0 {
-			// every container into the funPool has the same memory (same function)
-			//so it is not important which one you destroy
-			elem := funPool.warm.Front()
-			contID := elem.Value.(*warmContainer).contID
-			// container in the same pool need same memory
-			memory, _ := container.GetMemoryMB(contID)
-			for ok := true; ok; ok = elem != nil {
-				containerToDismiss = append(containerToDismiss,
-					itemToDismiss{contID: contID, pool: funPool, elem: elem, memory: memory})
-				cleanedMB += memory
-				if cleanedMB >= requiredMemoryMB {
-					goto cleanup
-				}
-				//go on to the next one
-				elem = elem.Next()
-			}
-		}
+// NewWarmContainer spawns a new container for the given function and puts it
+// in the warm pool, without serving any request.
+func NewWarmContainer(fun *function.Function, destroyContainersIfNeeded bool) (container.ContainerID, error) {
+	return newWarmContainer(fun, destroyContainersIfNeeded, false)
+}
+
+func newWarmContainer(fun *function.Function, destroyContainersIfNeeded bool, autoscaled bool) (container.ContainerID, error) {
+	// warm containers only keep their memory
+	if !AcquireResources(0, fun.MemoryMB, destroyContainersIfNeeded) {
+		return "", OutOfResourcesErr
 	}
 
-cleanup: // second phase, cleanup
-	// memory check
-	if cleanedMB >= requiredMemoryMB {
-		for _, item := range containerToDismiss {
-			item.pool.warm.Remove(item.elem)      // remove the container from the funPool
-			err := container.Destroy(item.contID) // destroy the container
-			if err != nil {
-				res = false
-				return res, nil
-			}
-			Resources.AvailableMemMB += item.memory
+	image, err := getImageForFunction(fun)
+	if err == nil {
+		var info *container.ContainerInfo
+		info, err = container.NewContainer(image, fun.TarFunctionCode, containerOptions(fun))
+		if err == nil {
+			_, keepAlive := keepAliveWindows(fun)
+			expTime := clock.Now().Add(keepAlive).UnixNano()
+
+			fp := lockFunctionPool(fun)
+			defer fp.Unlock()
+			fp.putwarmContainer(info, reservationFor(fun), expTime)
+			fp.warm.Back().Value.(*warmContainer).autoscaled = autoscaled
+			return info.ID, nil
 		}
-
-		res = true
 	}
-	return res, nil
+
+	log.Printf("Failed warm container creation for [%s]: %v\n", fun.Name, err)
+	releaseResources(0, fun.MemoryMB)
+	return "", err
 }
 
 // DeleteExpiredContainer is called by the container cleaner
-// Deletes expired warm container
+// Deletes expired warm container, keeping at least MinWarm containers for
+// each function
 func DeleteExpiredContainer() {
-	now := time.Now().UnixNano()
+	now := clock.Now().UnixNano()
+	expired := make([]container.ContainerID, 0)
 
-	Resources.Lock()
-	defer Resources.Unlock()
-
-	for _, pool := range Resources.ContainerPools {
+	for _, pool := range functionPools() {
+		pool.Lock()
 		elem := pool.warm.Front()
-
 		for ok := elem != nil; ok; ok = elem != nil {
 			warmed := elem.Value.(*warmContainer)
+			if int64(pool.warm.Len()) <= pool.fun.MinWarm {
+				break // the pool is at its floor
+			}
 			if now > warmed.Expiration {
 				temp := elem
 				elem = elem.Next()
 				log.Printf("cleaner: Removing container %s\n", warmed.contID)
 				pool.warm.Remove(temp) // remove the expired element
 
-				memory, _ := container.GetMemoryMB(warmed.contID)
-				releaseResources(0, memory)
-				err := container.Destroy(warmed.contID)
-				if err != nil {
-					log.Printf("Error while destroying container %s: %s\n", warmed.contID, err)
-				}
-
+				releaseResources(0, warmed.res.memoryMB)
+				expired = append(expired, warmed.contID)
 			} else {
 				elem = elem.Next()
 			}
 		}
+		pool.Unlock()
 	}
 
+	// containers are destroyed without holding any lock
+	for _, contID := range expired {
+		destroyContainer(contID)
+	}
 }
 
 // ShutdownWarmContainersFor destroys warm containers of a given function
 // Actual termination happens asynchronously.
 func ShutdownWarmContainersFor(f *function.Function) {
-	Resources.Lock()
-	defer Resources.Unlock()
-
-	fp, ok := Resources.ContainerPools[f.Name]
+	fp, ok := lookupFunctionPool(f.Name)
 	if !ok {
 		return
 	}
 
 	containersToDelete := make([]container.ContainerID, 0)
 
+	fp.Lock()
 	elem := fp.warm.Front()
 	for ok := elem != nil; ok; ok = elem != nil {
 		warmed := elem.Value.(*warmContainer)
@@ -401,14 +538,15 @@ func ShutdownWarmContainersFor(f *function.Function) {
 		log.Printf("Removing container with ID %s\n", warmed.contID)
 		fp.warm.Remove(temp)
 
-		memory, _ := container.GetMemoryMB(warmed.contID)
-		Resources.AvailableMemMB += memory
+		releaseResources(0, warmed.res.memoryMB)
 		containersToDelete = append(containersToDelete, warmed.contID)
 	}
+	fp.Unlock()
 
 	go func(contIDs []container.ContainerID) {
 		for _, contID := range contIDs {
 			// No need to update available resources here
+			forgetContainer(contID)
 			if err := container.Destroy(contID); err != nil {
 				log.Printf("An error occurred while deleting %s: %v\n", contID, err)
 			} else {
@@ -420,10 +558,10 @@ func ShutdownWarmContainersFor(f *function.Function) {
 
 // ShutdownAllContainers destroys all container (usually on termination)
 func ShutdownAllContainers() {
-	Resources.Lock()
-	defer Resources.Unlock()
+	containersToDelete := make([]container.ContainerID, 0)
 
-	for fun, pool := range Resources.ContainerPools {
+	for _, pool := range functionPools() {
+		pool.Lock()
 		elem := pool.warm.Front()
 		for ok := elem != nil; ok; ok = elem != nil {
 			warmed := elem.Value.(*warmContainer)
@@ -432,16 +570,10 @@ func ShutdownAllContainers() {
 			log.Printf("Removing container with ID %s\n", warmed.contID)
 			pool.warm.Remove(temp)
 
-			memory, _ := container.GetMemoryMB(warmed.contID)
-			err := container.Destroy(warmed.contID)
-			if err != nil {
-				log.Printf("Error while destroying container %s: %s", warmed.contID, err)
-			}
-			Resources.AvailableMemMB += memory
+			containersToDelete = append(containersToDelete, warmed.contID)
+			releaseResources(0, warmed.res.memoryMB)
 		}
 
-		functionDescriptor, _ := function.GetFunction(fun)
-
 		elem = pool.running.Front()
 		for ok := elem != nil; ok; ok = elem != nil {
 			runningCont := elem.Value.(*containerRunning)
@@ -449,32 +581,64 @@ func ShutdownAllContainers() {
 			temp := elem
 			elem = elem.Next()
 			log.Printf("Removing container with ID %s\n", contID)
-			pool.warm.Remove(temp)
+			pool.running.Remove(temp)
 
-			memory, _ := container.GetMemoryMB(contID)
-			err := container.Destroy(contID)
-			if err != nil {
-				log.Printf("Error while destroying container %s: %s", contID, err)
-			}
-			Resources.AvailableMemMB += memory
-			Resources.AvailableCPUs += functionDescriptor.CPUDemand
+			containersToDelete = append(containersToDelete, contID)
+			releaseResources(runningCont.res.cpu(runningCont.FuncCounter),
+				runningCont.res.memory(runningCont.FuncCounter))
+		}
+		pool.Unlock()
+	}
+
+	for _, contID := range containersToDelete {
+		forgetContainer(contID)
+		if err := container.Destroy(contID); err != nil {
+			log.Printf("Error while destroying container %s: %s", contID, err)
 		}
 	}
 }
 
 // WarmStatus foreach function returns the corresponding number of warm container available
 func WarmStatus() map[string]int {
-	Resources.RLock()
-	defer Resources.RUnlock()
 	warmPool := make(map[string]int)
-	for funcName, pool := range Resources.ContainerPools {
-		warmPool[funcName] = pool.warm.Len()
+	for _, pool := range functionPools() {
+		pool.Lock()
+		warmPool[pool.fun.Name] = pool.warm.Len()
+		pool.Unlock()
 	}
 
 	return warmPool
 }
 
-func PrewarmInstances(f *function.Function, count int64, forcePull bool) (int64, error) { //TODO: we do to adapt the concurrency logic
+// ProvisionMinWarm creates warm containers for the function until its pool
+// holds at least MinWarm containers (either warm or running). Containers are
+// created asynchronously and never evict other containers.
+func ProvisionMinWarm(f *function.Function) {
+	fp := getFunctionPool(f)
+	fp.Lock()
+	missing := f.MinWarm - int64(fp.warm.Len()+fp.running.Len()) - fp.provisioning
+	if missing <= 0 {
+		fp.Unlock()
+		return
+	}
+	fp.provisioning += missing
+	fp.Unlock()
+
+	log.Printf("Provisioning %d warm container(s) for %s\n", missing, f)
+	for i := int64(0); i < missing; i++ {
+		go func() {
+			if _, err := NewWarmContainer(f, false); err != nil {
+				log.Printf("Could not provision a warm container for %s: %v\n", f, err)
+			}
+			fp.Lock()
+			fp.provisioning--
+			fp.Unlock()
+		}()
+	}
+}
+
+// PrewarmInstances spawns count warm containers for the function.
+func PrewarmInstances(f *function.Function, count int64, forcePull bool) (int64, error) {
 	image, err := getImageForFunction(f)
 	if err != nil {
 		return 0, err
@@ -486,7 +650,7 @@ func PrewarmInstances(f *function.Function, count int64, forcePull bool) (int64,
 
 	var spawned int64 = 0
 	for spawned < count {
-		_, err = NewContainer(f)
+		_, err = NewWarmContainer(f, true)
 		if err != nil {
 			log.Printf("Prespawning failed: %v\n", err)
 			return spawned, err
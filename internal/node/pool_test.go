@@ -0,0 +1,419 @@
+package node
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/grussorusso/serverledge/internal/container"
+	"github.com/grussorusso/serverledge/internal/function"
+)
+
+// fakeFactory records destroyed containers without running any. Listed
+// containers must be set by tests.
+type fakeFactory struct {
+	sync.Mutex
+	destroyed []container.ContainerID
+	listed    []*container.ContainerInfo
+	creations int
+}
+
+func (f *fakeFactory) Create(string, *container.ContainerOptions) (container.ContainerID, error) {
+	f.Lock()
+	defer f.Unlock()
+	f.creations++
+	return "", fmt.Errorf("not supported")
+}
+
+func (f *fakeFactory) CopyToContainer(container.ContainerID, io.Reader, string) error { return nil }
+
+func (f *fakeFactory) Start(container.ContainerID) error { return nil }
+
+func (f *fakeFactory) Destroy(contID container.ContainerID) error {
+	f.Lock()
+	defer f.Unlock()
+	f.destroyed = append(f.destroyed, contID)
+	return nil
+}
+
+func (f *fakeFactory) HasImage(string) bool { return true }
+
+func (f *fakeFactory) PullImage(string) error { return nil }
+
+func (f *fakeFactory) Inspect(contID container.ContainerID) (*container.ContainerInfo, error) {
+	return &container.ContainerInfo{ID: contID}, nil
+}
+
+func (f *fakeFactory) Pause(container.ContainerID) error { return nil }
+
+func (f *fakeFactory) Unpause(container.ContainerID) error { return nil }
+
+func (f *fakeFactory) Events(context.Context) (<-chan container.ContainerEvent, <-chan error) {
+	return make(chan container.ContainerEvent), make(chan error)
+}
+
+func (f *fakeFactory) List(labels map[string]string) ([]*container.ContainerInfo, error) {
+	f.Lock()
+	defer f.Unlock()
+	infos := make([]*container.ContainerInfo, 0)
+	for _, info := range f.listed {
+		matching := true
+		for key, value := range labels {
+			matching = matching && info.Labels[key] == value
+		}
+		if matching {
+			infos = append(infos, info)
+		}
+	}
+	return infos, nil
+}
+
+func (f *fakeFactory) creationCount() int {
+	f.Lock()
+	defer f.Unlock()
+	return f.creations
+}
+
+func (f *fakeFactory) destroyedCount() int {
+	f.Lock()
+	defer f.Unlock()
+	return len(f.destroyed)
+}
+
+// creatingFactory creates containers whose executors are immediately ready,
+// taking latency for each creation.
+type creatingFactory struct {
+	fakeFactory
+	latency time.Duration
+}
+
+func (f *creatingFactory) Create(string, *container.ContainerOptions) (container.ContainerID, error) {
+	time.Sleep(f.latency)
+	f.Lock()
+	defer f.Unlock()
+	f.creations++
+	return fmt.Sprintf("created-%d", f.creations), nil
+}
+
+func (f *creatingFactory) ExecutorTransport(*container.ContainerInfo) http.RoundTripper {
+	return readyTransport{}
+}
+
+// readyTransport answers any request to an executor with 200.
+type readyTransport struct{}
+
+func (readyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader("")), Request: req}, nil
+}
+
+// resetNode empties the pools and sets the resources of the node.
+func resetNode(memMB int64, cpus float64) *fakeFactory {
+	factory := &fakeFactory{}
+	container.SetFactory(factory)
+	Resources.ContainerPools = make(map[string]*ContainerPool)
+	health.Lock()
+	health.containers = make(map[container.ContainerID]*containerHealth)
+	health.Unlock()
+	Resources.AvailableMemMB = memMB
+	Resources.AvailableCPUs = cpus
+	return factory
+}
+
+func testFunction(name string, memMB int64) *function.Function {
+	return &function.Function{
+		Name:                 name,
+		MaxFunctionInstances: 1,
+		MemoryMB:             memMB,
+		CPUDemand:            0.1,
+	}
+}
+
+// addWarmContainers adds n warm containers for f, committing their memory.
+func addWarmContainers(t testing.TB, f *function.Function, n int, expiration time.Time) {
+	for i := 0; i < n; i++ {
+		if !AcquireResources(0, f.MemoryMB, false) {
+			t.Fatalf("not enough memory for the warm containers of %s", f)
+		}
+		fp := lockFunctionPool(f)
+		fp.putwarmContainer(&container.ContainerInfo{ID: fmt.Sprintf("%s-%d", f.Name, i)}, reservationFor(f), expiration.UnixNano())
+		fp.Unlock()
+	}
+}
+
+func expectAvailable(t *testing.T, memMB int64, cpus float64) {
+	t.Helper()
+	availableMemMB, availableCPUs := Resources.Available()
+	if availableMemMB != memMB || availableCPUs < cpus-1e-9 || availableCPUs > cpus+1e-9 {
+		t.Fatalf("available resources: %d MB, %f CPUs (expected %d MB, %f CPUs)",
+			availableMemMB, availableCPUs, memMB, cpus)
+	}
+}
+
+func TestAcquireAndReleaseWarmContainer(t *testing.T) {
+	resetNode(1024, 1.0)
+	f := testFunction("f", 128)
+	addWarmContainers(t, f, 1, time.Now().Add(time.Hour))
+	expectAvailable(t, 896, 1.0)
+
+	contID, err := AcquireWarmContainer(f)
+	if err != nil {
+		t.Fatalf("could not acquire the warm container: %v", err)
+	}
+	expectAvailable(t, 896, 0.9)
+	if _, err := AcquireWarmContainer(f); err != NoWarmFoundErr {
+		t.Fatalf("expected %v, got %v", NoWarmFoundErr, err)
+	}
+
+	ReleaseResources(contID, f)
+	expectAvailable(t, 896, 1.0)
+	if status := WarmStatus(); status[f.Name] != 1 {
+		t.Fatalf("expected 1 warm container, got %d", status[f.Name])
+	}
+}
+
+func TestReleaseAfterFunctionUpdate(t *testing.T) {
+	factory := resetNode(1024, 1.0)
+	f := testFunction("f", 128)
+	f.MaxFunctionInstances = 2
+	addWarmContainers(t, f, 1, time.Now().Add(time.Hour))
+
+	contID, err := AcquireWarmContainer(f)
+	if err != nil {
+		t.Fatalf("could not acquire the warm container: %v", err)
+	}
+
+	// the function is updated while the container is running
+	updated := testFunction("f", 256)
+	updated.MaxFunctionInstances = 2
+	updated.CPUDemand = 0.3
+	if _, _, err := AcquireRunningContainer(updated); err != nil {
+		t.Fatalf("could not acquire the running container: %v", err)
+	}
+	expectAvailable(t, 896, 0.8)
+
+	ReleaseResources(contID, updated)
+	ReleaseResources(contID, updated)
+	expectAvailable(t, 896, 1.0)
+
+	ShutdownWarmContainersFor(updated)
+	expectAvailable(t, 1024, 1.0)
+	// containers are destroyed asynchronously
+	for deadline := time.Now().Add(5 * time.Second); factory.destroyedCount() < 1; {
+		if time.Now().After(deadline) {
+			t.Fatalf("warm containers not destroyed")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestAcquireRunningContainerMaxInstances(t *testing.T) {
+	resetNode(1024, 1.0)
+	f := testFunction("f", 128)
+	f.MaxFunctionInstances = 2
+	addWarmContainers(t, f, 1, time.Now().Add(time.Hour))
+
+	contID, err := AcquireWarmContainer(f)
+	if err != nil {
+		t.Fatalf("could not acquire the warm container: %v", err)
+	}
+	if id, instances, err := AcquireRunningContainer(f); err != nil || id != contID || instances != 2 {
+		t.Fatalf("expected a second instance on %s, got %s/%d (%v)", contID, id, instances, err)
+	}
+	if _, _, err := AcquireRunningContainer(f); err != NoRunningContErr {
+		t.Fatalf("expected %v, got %v", NoRunningContErr, err)
+	}
+	expectAvailable(t, 896, 0.8)
+
+	ReleaseResources(contID, f)
+	ReleaseResources(contID, f)
+	expectAvailable(t, 896, 1.0)
+}
+
+func TestAcquireResourcesEvictsWarmContainers(t *testing.T) {
+	factory := resetNode(512, 1.0)
+	f := testFunction("f", 128)
+	g := testFunction("g", 128)
+	addWarmContainers(t, f, 2, time.Now().Add(time.Hour))
+	addWarmContainers(t, g, 2, time.Now().Add(time.Hour))
+	expectAvailable(t, 0, 1.0)
+
+	if AcquireResources(0, 1024, true) {
+		t.Fatalf("acquired more memory than the node has")
+	}
+	if factory.destroyedCount() != 0 {
+		t.Fatalf("containers evicted although not enough memory could be freed")
+	}
+
+	if !AcquireResources(0, 200, true) {
+		t.Fatalf("could not acquire memory by evicting warm containers")
+	}
+	expectAvailable(t, 56, 1.0)
+	status := WarmStatus()
+	if warm := status[f.Name] + status[g.Name]; warm != 2 {
+		t.Fatalf("expected 2 warm containers left, got %d", warm)
+	}
+	// evicted containers are destroyed before their memory is reused
+	if destroyed := factory.destroyedCount(); destroyed != 2 {
+		t.Fatalf("expected 2 destroyed containers, got %d", destroyed)
+	}
+}
+
+func TestDeleteExpiredContainerKeepsMinWarm(t *testing.T) {
+	factory := resetNode(1024, 1.0)
+	f := testFunction("f", 128)
+	addWarmContainers(t, f, 3, time.Now().Add(-time.Second))
+	f.MinWarm = 1 // set afterwards, not to provision containers
+
+	DeleteExpiredContainer()
+	if status := WarmStatus(); status[f.Name] != 1 {
+		t.Fatalf("expected 1 warm container, got %d", status[f.Name])
+	}
+	if factory.destroyedCount() != 2 {
+		t.Fatalf("expected 2 destroyed containers, got %d", factory.destroyedCount())
+	}
+	expectAvailable(t, 896, 1.0)
+}
+
+func TestProvisionMinWarm(t *testing.T) {
+	factory := resetNode(1024, 1.0)
+	f := testFunction("f", 128)
+	f.Runtime = container.CUSTOM_RUNTIME
+	f.CustomImage = "image"
+	addWarmContainers(t, f, 1, time.Now().Add(time.Hour))
+	f.MinWarm = 3
+
+	ProvisionMinWarm(f)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		fp := lockFunctionPool(f)
+		provisioning := fp.provisioning
+		fp.Unlock()
+		if provisioning == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("containers still being provisioned")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	// the fake factory cannot create containers
+	if n := factory.creationCount(); n != 2 {
+		t.Fatalf("expected 2 containers to be created, got %d", n)
+	}
+	expectAvailable(t, 896, 1.0)
+
+	// pools at MinWarm are left untouched
+	f.MinWarm = 1
+	ProvisionMinWarm(f)
+	if n := factory.creationCount(); n != 2 {
+		t.Fatalf("unexpected container creations: %d", n-2)
+	}
+}
+
+func TestConcurrentAcquireRelease(t *testing.T) {
+	const functions = 8
+	const workers = 4
+	const iterations = 200
+
+	resetNode(4096, float64(functions))
+	funcs := make([]*function.Function, functions)
+	for i := range funcs {
+		funcs[i] = testFunction(fmt.Sprintf("f%d", i), 64)
+		addWarmContainers(t, funcs[i], workers, time.Now().Add(time.Hour))
+	}
+	memMB, cpus := Resources.Available()
+
+	var wg sync.WaitGroup
+	for _, f := range funcs {
+		for w := 0; w < workers; w++ {
+			wg.Add(1)
+			go func(f *function.Function) {
+				defer wg.Done()
+				for i := 0; i < iterations; i++ {
+					contID, err := AcquireWarmContainer(f)
+					if err != nil {
+						t.Errorf("could not acquire a warm container of %s: %v", f, err)
+						return
+					}
+					ObserveExecution(f, 1, 0.01)
+					ReleaseResources(contID, f)
+				}
+			}(f)
+		}
+	}
+	// status queries run concurrently with invocations
+	for i := 0; i < iterations; i++ {
+		WarmStatus()
+		ConcurrencyStatusAll()
+	}
+	wg.Wait()
+
+	expectAvailable(t, memMB, cpus)
+	status := WarmStatus()
+	for _, f := range funcs {
+		if status[f.Name] != workers {
+			t.Fatalf("expected %d warm containers of %s, got %d", workers, f, status[f.Name])
+		}
+	}
+}
+
+// BenchmarkPoolAcquireRelease invokes several functions in parallel, with
+// a cold start taking 1 ms every 16 invocations. With per-pool locks, cold
+// starts run without holding any lock; the baseline holds a global lock
+// across each operation, container creation included, as the node-wide
+// lock did before per-pool locks.
+func BenchmarkPoolAcquireRelease(b *testing.B) {
+	const functions = 16
+	const coldStartEvery = 16
+
+	run := func(b *testing.B, global *sync.Mutex) {
+		locked := func(op func()) {
+			if global != nil {
+				global.Lock()
+				defer global.Unlock()
+			}
+			op()
+		}
+
+		resetNode(1<<40, float64(functions))
+		container.SetFactory(&creatingFactory{latency: time.Millisecond})
+		funcs := make([]*function.Function, functions)
+		for i := range funcs {
+			funcs[i] = testFunction(fmt.Sprintf("f%d", i), 64)
+			funcs[i].Runtime = "python310"
+			addWarmContainers(b, funcs[i], 8, time.Now().Add(time.Hour))
+		}
+
+		var next int64
+		b.SetParallelism(functions)
+		b.ResetTimer()
+		b.RunParallel(func(pb *testing.PB) {
+			// each goroutine invokes a different function
+			f := funcs[atomic.AddInt64(&next, 1)%functions]
+			for i := 1; pb.Next(); i++ {
+				var err error
+				if i%coldStartEvery == 0 {
+					locked(func() { _, err = newWarmContainer(f, false, false) })
+				}
+				var contID container.ContainerID
+				if err == nil {
+					locked(func() { contID, err = AcquireWarmContainer(f) })
+				}
+				if err != nil {
+					b.Error(err)
+					return
+				}
+				locked(func() { ReleaseResources(contID, f) })
+			}
+		})
+	}
+
+	b.Run("per-pool", func(b *testing.B) { run(b, nil) })
+	b.Run("global-lock", func(b *testing.B) { run(b, &sync.Mutex{}) })
+}
@@ -0,0 +1,174 @@
+package node
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/grussorusso/serverledge/internal/clock"
+	"github.com/grussorusso/serverledge/internal/config"
+	"github.com/grussorusso/serverledge/internal/container"
+	"github.com/grussorusso/serverledge/internal/function"
+)
+
+// Policies for the containers left by a previous run of the node.
+const (
+	RECONCILE_ADOPT   = "adopt"
+	RECONCILE_DESTROY = "destroy"
+	RECONCILE_NONE    = "none"
+)
+
+// ContainerStatus compares a container of the node with what the container
+// runtime reports.
+type ContainerStatus struct {
+	ID       container.ContainerID
+	Function string
+	Pool     string `json:",omitempty"` // "warm" or "running"; empty if not in the pools
+	State    string `json:",omitempty"` // reported by the runtime; empty if not found
+	Instance string `json:",omitempty"` // run of the node that created the container
+}
+
+// OwnerID returns the identifier of the node in the labels of its containers.
+// Unlike NodeIdentifier, it does not change when the node restarts.
+func OwnerID() string {
+	if owner := config.GetString(config.CONTAINER_OWNER, ""); owner != "" {
+		return owner
+	}
+	hostname, _ := os.Hostname()
+	return fmt.Sprintf("%s-%d", hostname, config.GetInt(config.API_PORT, 1323))
+}
+
+// ReconcileContainers looks for the containers left by a previous run of the
+// node (e.g., after a crash). Depending on the configuration, healthy
+// containers are adopted into the warm pool of their function, whereas the
+// others are destroyed. Containers are adopted in parallel, and the ones whose
+// executor is not ready within container.adoption.timeout are destroyed.
+// It must be called before serving requests.
+func ReconcileContainers() {
+	policy := config.GetString(config.CONTAINER_RECONCILE, RECONCILE_ADOPT)
+	if policy == RECONCILE_NONE {
+		return
+	}
+
+	infos, err := container.List(map[string]string{container.LABEL_OWNER: OwnerID()})
+	if err != nil {
+		log.Printf("Could not list the containers of the node: %v\n", err)
+		return
+	}
+
+	timeout := time.Duration(config.GetInt(config.CONTAINER_ADOPTION_TIMEOUT, 30)) * time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var adopted, destroyed int64
+	var wg sync.WaitGroup
+	for _, info := range infos {
+		if info.Labels[container.LABEL_INSTANCE] == NodeIdentifier {
+			continue // created by this run
+		}
+		wg.Add(1)
+		go func(info *container.ContainerInfo) {
+			defer wg.Done()
+			if policy == RECONCILE_ADOPT {
+				err := adoptContainer(ctx, info)
+				if err == nil {
+					atomic.AddInt64(&adopted, 1)
+					return
+				}
+				log.Printf("Container %s cannot be adopted: %v\n", info.ID, err)
+			}
+			destroyContainer(info.ID)
+			atomic.AddInt64(&destroyed, 1)
+		}(info)
+	}
+	wg.Wait()
+	if adopted+destroyed > 0 {
+		log.Printf("Containers left by a previous run: %d adopted, %d destroyed\n", adopted, destroyed)
+	}
+}
+
+// adoptContainer puts a container left by a previous run in the warm pool of
+// its function, if the container can still serve the function and its
+// executor is ready before ctx is done.
+func adoptContainer(ctx context.Context, info *container.ContainerInfo) error {
+	if info.State != container.STATE_RUNNING && info.State != container.STATE_PAUSED {
+		return fmt.Errorf("the container is %s", info.State)
+	}
+	fun, ok := function.GetFunction(info.Labels[container.LABEL_FUNCTION])
+	if !ok {
+		return fmt.Errorf("function %s no longer exists", info.Labels[container.LABEL_FUNCTION])
+	}
+	if info.Labels[container.LABEL_CODE_DIGEST] != fun.CodeDigest() {
+		return fmt.Errorf("function %s has been updated", fun)
+	}
+	if info.MemoryMB != fun.ContainerMemoryMB(fun.MaxFunctionInstances) {
+		return fmt.Errorf("the memory limit of %s has changed", fun)
+	}
+
+	// warm containers only keep their memory
+	if !AcquireResources(0, fun.MemoryMB, false) {
+		return OutOfResourcesErr
+	}
+	if err := container.Adopt(ctx, info, int(fun.MaxFunctionInstances)); err != nil {
+		releaseResources(0, fun.MemoryMB)
+		return err
+	}
+
+	_, keepAlive := keepAliveWindows(fun)
+	fp := lockFunctionPool(fun)
+	defer fp.Unlock()
+	fp.putwarmContainer(info, reservationFor(fun), clock.Now().Add(keepAlive).UnixNano())
+	log.Printf("Adopted container %s of %s\n", info.ID, fun)
+	return nil
+}
+
+// ListContainers returns the containers in the pools of the node, along with
+// the containers labeled as owned by the node according to the container
+// runtime.
+func ListContainers() ([]ContainerStatus, error) {
+	containers := make(map[container.ContainerID]*ContainerStatus)
+	for _, fp := range functionPools() {
+		fp.Lock()
+		for elem := fp.warm.Front(); elem != nil; elem = elem.Next() {
+			wc := elem.Value.(*warmContainer)
+			containers[wc.contID] = &ContainerStatus{ID: wc.contID, Function: fp.fun.Name, Pool: "warm"}
+		}
+		for elem := fp.running.Front(); elem != nil; elem = elem.Next() {
+			rc := elem.Value.(*containerRunning)
+			containers[rc.contID] = &ContainerStatus{ID: rc.contID, Function: fp.fun.Name, Pool: "running"}
+		}
+		fp.Unlock()
+	}
+
+	// the runtime is queried without holding any lock
+	infos, err := container.List(map[string]string{container.LABEL_OWNER: OwnerID()})
+	if err != nil {
+		return nil, err
+	}
+	for _, info := range infos {
+		c, ok := containers[info.ID]
+		if !ok {
+			c = &ContainerStatus{ID: info.ID, Function: info.Labels[container.LABEL_FUNCTION]}
+			containers[info.ID] = c
+		}
+		c.State = info.State
+		c.Instance = info.Labels[container.LABEL_INSTANCE]
+	}
+
+	list := make([]ContainerStatus, 0, len(containers))
+	for _, c := range containers {
+		list = append(list, *c)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Function != list[j].Function {
+			return list[i].Function < list[j].Function
+		}
+		return list[i].ID < list[j].ID
+	})
+	return list, nil
+}
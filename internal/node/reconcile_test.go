@@ -0,0 +1,132 @@
+package node
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/grussorusso/serverledge/internal/cache"
+	"github.com/grussorusso/serverledge/internal/config"
+	"github.com/grussorusso/serverledge/internal/container"
+	"github.com/grussorusso/serverledge/internal/function"
+	"github.com/spf13/viper"
+)
+
+// startReadyExecutor serves the readiness endpoint on the executor socket in
+// a new directory, which is returned.
+func startReadyExecutor(t *testing.T) string {
+	dir := t.TempDir()
+	listener, err := net.Listen("unix", filepath.Join(dir, container.EXECUTOR_SOCKET_NAME))
+	if err != nil {
+		t.Fatalf("could not listen on the executor socket: %v", err)
+	}
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})}
+	go func() { _ = server.Serve(listener) }()
+	t.Cleanup(func() { _ = server.Close() })
+	return dir
+}
+
+// orphanContainer describes a container created by a previous run of the node.
+func orphanContainer(id string, f *function.Function, state string) *container.ContainerInfo {
+	return &container.ContainerInfo{
+		ID:       id,
+		MemoryMB: f.ContainerMemoryMB(f.MaxFunctionInstances),
+		State:    state,
+		Labels: map[string]string{
+			container.LABEL_OWNER:       OwnerID(),
+			container.LABEL_INSTANCE:    "previous",
+			container.LABEL_FUNCTION:    f.Name,
+			container.LABEL_CODE_DIGEST: f.CodeDigest(),
+		},
+	}
+}
+
+func TestReconcileContainers(t *testing.T) {
+	factory := resetNode(1024, 1.0)
+	NodeIdentifier = "current"
+
+	f := testFunction("f", 128)
+	f.Runtime = "python310"
+	cache.Size = 10
+	cache.GetCacheInstance().Set(f.Name, f, cache.NoExpiration)
+
+	healthy := orphanContainer("healthy", f, container.STATE_RUNNING)
+	healthy.Labels[container.LABEL_SOCKET_DIR] = startReadyExecutor(t)
+	outdated := orphanContainer("outdated", f, container.STATE_RUNNING)
+	outdated.Labels[container.LABEL_CODE_DIGEST] = "old"
+	exited := orphanContainer("exited", f, "exited")
+	current := orphanContainer("current", f, container.STATE_RUNNING)
+	current.Labels[container.LABEL_INSTANCE] = NodeIdentifier
+	foreign := orphanContainer("foreign", f, container.STATE_RUNNING)
+	foreign.Labels[container.LABEL_OWNER] = "another node"
+	factory.listed = []*container.ContainerInfo{healthy, outdated, exited, current, foreign}
+
+	ReconcileContainers()
+
+	if status := WarmStatus(); status[f.Name] != 1 {
+		t.Fatalf("expected 1 adopted container, got %d", status[f.Name])
+	}
+	expectAvailable(t, 896, 1.0)
+	destroyed := map[container.ContainerID]bool{}
+	for _, contID := range factory.destroyed {
+		destroyed[contID] = true
+	}
+	if len(destroyed) != 2 || !destroyed["outdated"] || !destroyed["exited"] {
+		t.Fatalf("expected outdated and exited containers to be destroyed, got %v", factory.destroyed)
+	}
+
+	containers, err := ListContainers()
+	if err != nil {
+		t.Fatalf("could not list containers: %v", err)
+	}
+	pools := map[container.ContainerID]string{}
+	for _, c := range containers {
+		pools[c.ID] = c.Pool
+	}
+	// the fake runtime still reports the destroyed containers
+	if len(containers) != 4 || pools["healthy"] != "warm" || pools["current"] != "" {
+		t.Fatalf("unexpected containers: %+v", containers)
+	}
+}
+
+func TestReconcileContainersTimeout(t *testing.T) {
+	factory := resetNode(1024, 1.0)
+	NodeIdentifier = "current"
+	viper.Set(config.CONTAINER_ADOPTION_TIMEOUT, 1)
+	defer viper.Set(config.CONTAINER_ADOPTION_TIMEOUT, nil)
+
+	f := testFunction("f", 128)
+	f.Runtime = "python310"
+	cache.Size = 10
+	cache.GetCacheInstance().Set(f.Name, f, cache.NoExpiration)
+
+	healthy := orphanContainer("healthy", f, container.STATE_RUNNING)
+	healthy.Labels[container.LABEL_SOCKET_DIR] = startReadyExecutor(t)
+	factory.listed = []*container.ContainerInfo{healthy}
+	for i := 0; i < 3; i++ {
+		// executors never listening on their sockets
+		stuck := orphanContainer(fmt.Sprintf("stuck-%d", i), f, container.STATE_RUNNING)
+		stuck.Labels[container.LABEL_SOCKET_DIR] = t.TempDir()
+		factory.listed = append(factory.listed, stuck)
+	}
+
+	start := time.Now()
+	ReconcileContainers()
+	// containers are adopted in parallel within the deadline
+	if elapsed := time.Since(start); elapsed > 2500*time.Millisecond {
+		t.Fatalf("reconciliation took %v", elapsed)
+	}
+
+	if status := WarmStatus(); status[f.Name] != 1 {
+		t.Fatalf("expected 1 adopted container, got %d", status[f.Name])
+	}
+	expectAvailable(t, 896, 1.0)
+	if destroyed := factory.destroyedCount(); destroyed != 3 {
+		t.Fatalf("expected 3 destroyed containers, got %d", destroyed)
+	}
+}
@@ -0,0 +1,109 @@
+package node
+
+import (
+	"container/list"
+	"log"
+	"sync"
+
+	"github.com/grussorusso/serverledge/internal/config"
+	"github.com/grussorusso/serverledge/internal/function"
+)
+
+// Strategies for picking a running container to serve a new function instance.
+const (
+	FIRST_FIT    = "firstfit"
+	LEAST_LOADED = "leastloaded"
+	BIN_PACKING  = "binpacking"
+)
+
+// ContainerSelector chooses which running container of a pool serves a new
+// function instance.
+type ContainerSelector interface {
+	// Select returns the element of the running list to use, or nil if no
+	// container can host another instance.
+	Select(running *list.List, maxInstances int64) *list.Element
+}
+
+// FirstFitSelector picks the first container with a free slot.
+type FirstFitSelector struct{}
+
+// LeastLoadedSelector picks the container serving the fewest instances, thus
+// spreading the load across containers.
+type LeastLoadedSelector struct{}
+
+// BinPackingSelector picks the most loaded container that still has a free
+// slot, thus packing the load into as few containers as possible.
+type BinPackingSelector struct{}
+
+func (s *FirstFitSelector) Select(running *list.List, maxInstances int64) *list.Element {
+	for elem := running.Front(); elem != nil; elem = elem.Next() {
+		if elem.Value.(*containerRunning).FuncCounter+1 <= maxInstances {
+			return elem
+		}
+	}
+	return nil
+}
+
+func (s *LeastLoadedSelector) Select(running *list.List, maxInstances int64) *list.Element {
+	var best *list.Element
+	for elem := running.Front(); elem != nil; elem = elem.Next() {
+		counter := elem.Value.(*containerRunning).FuncCounter
+		if counter+1 > maxInstances {
+			continue
+		}
+		if best == nil || counter < best.Value.(*containerRunning).FuncCounter {
+			best = elem
+		}
+	}
+	return best
+}
+
+func (s *BinPackingSelector) Select(running *list.List, maxInstances int64) *list.Element {
+	var best *list.Element
+	for elem := running.Front(); elem != nil; elem = elem.Next() {
+		counter := elem.Value.(*containerRunning).FuncCounter
+		if counter+1 > maxInstances {
+			continue
+		}
+		if best == nil || counter > best.Value.(*containerRunning).FuncCounter {
+			best = elem
+		}
+	}
+	return best
+}
+
+// IsValidSelectionStrategy returns true if the name identifies a known
+// strategy (or is empty, i.e., the node default is used).
+func IsValidSelectionStrategy(name string) bool {
+	return name == "" || name == FIRST_FIT || name == LEAST_LOADED || name == BIN_PACKING
+}
+
+// unknown strategies already reported
+var unknownStrategies sync.Map
+
+func newContainerSelector(name string) ContainerSelector {
+	switch name {
+	case LEAST_LOADED:
+		return &LeastLoadedSelector{}
+	case BIN_PACKING:
+		return &BinPackingSelector{}
+	case FIRST_FIT:
+		return &FirstFitSelector{}
+	default:
+		if _, reported := unknownStrategies.LoadOrStore(name, true); !reported {
+			log.Printf("Unknown container selection strategy '%s': using %s\n", name, FIRST_FIT)
+		}
+		return &FirstFitSelector{}
+	}
+}
+
+// selectorFor returns the selection strategy for a function, which
+// possibly overrides the one configured for the node. It is resolved upon
+// each selection, so that updates of the function apply immediately.
+func selectorFor(f *function.Function) ContainerSelector {
+	name := f.SelectionStrategy
+	if name == "" {
+		name = config.GetString(config.CONTAINER_SELECTION_STRATEGY, FIRST_FIT)
+	}
+	return newContainerSelector(name)
+}
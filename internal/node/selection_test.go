@@ -0,0 +1,98 @@
+package node
+
+import (
+	"container/list"
+	"testing"
+
+	"github.com/grussorusso/serverledge/internal/config"
+	"github.com/grussorusso/serverledge/internal/container"
+	"github.com/grussorusso/serverledge/internal/function"
+	"github.com/spf13/viper"
+)
+
+// runningList returns a list of running containers serving the given number
+// of instances, named c0, c1, ...
+func runningList(counters ...int64) *list.List {
+	running := list.New()
+	for i, counter := range counters {
+		running.PushBack(&containerRunning{
+			contID:      container.ContainerID("c" + string(rune('0'+i))),
+			FuncCounter: counter,
+		})
+	}
+	return running
+}
+
+func selected(elem *list.Element) container.ContainerID {
+	if elem == nil {
+		return ""
+	}
+	return elem.Value.(*containerRunning).contID
+}
+
+func TestContainerSelectors(t *testing.T) {
+	cases := []struct {
+		counters []int64
+		max      int64
+		expected map[string]container.ContainerID
+	}{
+		{[]int64{2, 1, 3}, 4, map[string]container.ContainerID{FIRST_FIT: "c0", LEAST_LOADED: "c1", BIN_PACKING: "c2"}},
+		{[]int64{4, 1, 3}, 4, map[string]container.ContainerID{FIRST_FIT: "c1", LEAST_LOADED: "c1", BIN_PACKING: "c2"}},
+		// ties are broken in list order
+		{[]int64{2, 2, 2}, 4, map[string]container.ContainerID{FIRST_FIT: "c0", LEAST_LOADED: "c0", BIN_PACKING: "c0"}},
+		// full containers are never selected
+		{[]int64{2, 2}, 2, map[string]container.ContainerID{FIRST_FIT: "", LEAST_LOADED: "", BIN_PACKING: ""}},
+		{nil, 2, map[string]container.ContainerID{FIRST_FIT: "", LEAST_LOADED: "", BIN_PACKING: ""}},
+	}
+	for _, c := range cases {
+		for name, expected := range c.expected {
+			got := selected(newContainerSelector(name).Select(runningList(c.counters...), c.max))
+			if got != expected {
+				t.Errorf("%s on %v (max %d): expected %q, got %q", name, c.counters, c.max, expected, got)
+			}
+		}
+	}
+}
+
+func TestSelectorFor(t *testing.T) {
+	defer viper.Set(config.CONTAINER_SELECTION_STRATEGY, nil)
+	viper.Set(config.CONTAINER_SELECTION_STRATEGY, BIN_PACKING)
+
+	if _, ok := selectorFor(&function.Function{}).(*BinPackingSelector); !ok {
+		t.Errorf("the node strategy is not used by default")
+	}
+	if _, ok := selectorFor(&function.Function{SelectionStrategy: LEAST_LOADED}).(*LeastLoadedSelector); !ok {
+		t.Errorf("the function strategy does not override the node one")
+	}
+	if _, ok := newContainerSelector("random").(*FirstFitSelector); !ok {
+		t.Errorf("unknown strategies do not fall back to %s", FIRST_FIT)
+	}
+	if IsValidSelectionStrategy("random") || !IsValidSelectionStrategy("") {
+		t.Errorf("unexpected validation of strategy names")
+	}
+}
+
+func TestSelectionStrategyUpdate(t *testing.T) {
+	resetNode(1024, 1.0)
+	f := testFunction("f", 128)
+	f.MaxFunctionInstances = 3
+
+	// running containers, from the front: busy (2 instances), idle (1)
+	fp := lockFunctionPool(f)
+	fp.putRunningContainer(&container.ContainerInfo{ID: "idle"}, reservationFor(f))
+	fp.putRunningContainer(&container.ContainerInfo{ID: "busy"}, reservationFor(f))
+	fp.running.Front().Value.(*containerRunning).FuncCounter = 2
+	fp.Unlock()
+
+	if contID, _, err := AcquireRunningContainer(f); err != nil || contID != "busy" {
+		t.Fatalf("first fit: got %s (%v)", contID, err)
+	}
+
+	// the strategy of the updated function is used by the existing pool
+	updated := testFunction("f", 128)
+	updated.MaxFunctionInstances = 3
+	updated.SelectionStrategy = LEAST_LOADED
+	if contID, instances, err := AcquireRunningContainer(updated); err != nil || contID != "idle" || instances != 2 {
+		t.Fatalf("least loaded: got %s with %d instances (%v)", contID, instances, err)
+	}
+}
@@ -69,11 +69,12 @@ func handleUDPConnection(conn *net.UDPConn) {
 func getCurrentStatusInformation() (status []byte, err error) {
 	portNumber := config.GetInt("api.port", 1323)
 	url := fmt.Sprintf("http://%s:%d", utils.GetIpAddress().String(), portNumber)
+	availableMemMB, availableCPUs := node.Resources.Available()
 	response := StatusInformation{
 		Url:                     url,
 		AvailableWarmContainers: node.WarmStatus(),
-		AvailableMemMB:          node.Resources.AvailableMemMB,
-		AvailableCPUs:           node.Resources.AvailableCPUs,
+		AvailableMemMB:          availableMemMB,
+		AvailableCPUs:           availableCPUs,
 		DropCount:               node.Resources.DropCount,
 		Coordinates:             *Reg.Client.GetCoordinate(),
 	}
@@ -3,7 +3,9 @@ package registration
 import (
 	"fmt"
 	"log"
+	"net/url"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/grussorusso/serverledge/internal/config"
@@ -165,3 +167,46 @@ func (r *Registry) Deregister() (e error) {
 	log.Println("Deregister : " + r.Key)
 	return nil
 }
+
+// registered nodes are cached for peersCacheTTL; unknown hosts trigger a
+// refresh at most every peersMinRefresh
+const peersCacheTTL = 10 * time.Second
+const peersMinRefresh = 1 * time.Second
+
+var peers = struct {
+	sync.Mutex
+	hosts   map[string]bool
+	updated time.Time
+}{hosts: make(map[string]bool)}
+
+// IsRegisteredPeer returns true if host (an IP address or host name) belongs
+// to a node registered in any Area or in the Cloud.
+func IsRegisteredPeer(host string) (bool, error) {
+	peers.Lock()
+	defer peers.Unlock()
+
+	age := time.Since(peers.updated)
+	if age < peersCacheTTL && (peers.hosts[host] || age < peersMinRefresh) {
+		return peers.hosts[host], nil
+	}
+
+	etcdClient, err := utils.GetEtcdClient()
+	if err != nil {
+		return false, UnavailableClientErr
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	resp, err := etcdClient.Get(ctx, BASEDIR+"/", clientv3.WithPrefix())
+	if err != nil {
+		return false, fmt.Errorf("Could not read from etcd: %v", err)
+	}
+
+	peers.hosts = make(map[string]bool)
+	for _, kv := range resp.Kvs {
+		if u, err := url.Parse(string(kv.Value)); err == nil && u.Hostname() != "" {
+			peers.hosts[u.Hostname()] = true
+		}
+	}
+	peers.updated = time.Now()
+	return peers.hosts[host], nil
+}
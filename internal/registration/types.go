@@ -4,6 +4,7 @@ import (
 	"errors"
 
 	"github.com/LK4D4/trylock"
+	"github.com/grussorusso/serverledge/internal/node"
 	"github.com/hexablock/vivaldi"
 )
 
@@ -28,4 +29,25 @@ type StatusInformation struct {
 	AvailableCPUs           float64
 	DropCount               int64
 	Coordinates             vivaldi.Coordinate
+	// learned per-container concurrency (only reported by the status API)
+	Concurrency map[string]node.ConcurrencyStatus `json:",omitempty"`
+	// queued requests per service class (only reported by the status API)
+	QueueLengths map[string]int `json:",omitempty"`
+	// queued requests per function (only reported by the status API)
+	FunctionQueueLengths map[string]int `json:",omitempty"`
+	// admission control of the scheduler (only reported by the status API)
+	Intake *IntakeStatus `json:",omitempty"`
+}
+
+// IntakeStatus describes the requests and completions waiting for the
+// scheduler.
+type IntakeStatus struct {
+	QueuedRequests       int
+	Capacity             int
+	Admitted             int64 // requests admitted since startup
+	Rejected             int64 // requests rejected since startup because the intake was full
+	QueuedCompletions    int
+	CompletionsCapacity  int
+	CompletionsOverflows int64 // completions that did not fit in the buffer
+	CompletionsBlocked   int64 // completions that waited because the backlog was full
 }
@@ -0,0 +1,151 @@
+package scheduling
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+
+	"github.com/grussorusso/serverledge/internal/config"
+	"github.com/grussorusso/serverledge/internal/function"
+	"github.com/grussorusso/serverledge/internal/metrics"
+	"github.com/grussorusso/serverledge/internal/registration"
+)
+
+var OverloadedErr = errors.New("the scheduler intake is full")
+
+const defaultIntakeCapacity = 500
+
+// admission counters, reported by the status API
+var admittedCount, rejectedCount int64
+
+// Completion notifications that do not fit in the completions channel are
+// kept in a backlog, so that execution goroutines do not block waiting for
+// the scheduler. The backlog is drained by the scheduler loop; when it is
+// full, notifying goroutines wait for the scheduler to drain it (they must
+// never be the scheduler loop).
+var completionBacklog struct {
+	sync.Mutex
+	notifications []*completionNotification
+	capacity      int
+	drained       *sync.Cond    // signalled when the backlog is taken
+	ready         chan struct{} // signalled when the backlog becomes non-empty
+	overflows     int64
+	blocked       int64
+}
+
+// initIntake creates the request and completion channels.
+func initIntake() {
+	intakeCapacity := config.GetInt(config.SCHEDULER_INTAKE_CAPACITY, defaultIntakeCapacity)
+	if intakeCapacity < 1 {
+		intakeCapacity = defaultIntakeCapacity
+	}
+	completionsCapacity := config.GetInt(config.SCHEDULER_COMPLETIONS_CAPACITY, defaultIntakeCapacity)
+	if completionsCapacity < 1 {
+		completionsCapacity = defaultIntakeCapacity
+	}
+
+	backlogCapacity := config.GetInt(config.SCHEDULER_COMPLETIONS_BACKLOG, 10*completionsCapacity)
+	if backlogCapacity < 1 {
+		backlogCapacity = 10 * completionsCapacity
+	}
+
+	requests = make(chan *scheduledRequest, intakeCapacity)
+	completions = make(chan *completionNotification, completionsCapacity)
+	completionBacklog.capacity = backlogCapacity
+	completionBacklog.drained = sync.NewCond(&completionBacklog)
+	completionBacklog.ready = make(chan struct{}, 1)
+}
+
+// admit hands r over to the scheduler without blocking. It returns
+// OverloadedErr if the intake is full.
+func admit(r *scheduledRequest) error {
+	select {
+	case requests <- r:
+		atomic.AddInt64(&admittedCount, 1)
+		if metrics.Enabled {
+			metrics.AddAdmittedRequest(r.Fun.Name)
+		}
+		return nil
+	default:
+		atomic.AddInt64(&rejectedCount, 1)
+		if metrics.Enabled {
+			metrics.AddRejectedRequest(r.Fun.Name)
+		}
+		return OverloadedErr
+	}
+}
+
+// IsOverloaded returns true if new requests would currently be rejected.
+func IsOverloaded() bool {
+	return len(requests) >= cap(requests)
+}
+
+// RejectRequest accounts for a request for f rejected before reaching the
+// scheduler because of overload.
+func RejectRequest(f *function.Function) {
+	atomic.AddInt64(&rejectedCount, 1)
+	if metrics.Enabled {
+		metrics.AddRejectedRequest(f.Name)
+	}
+}
+
+// notifyCompletion notifies the scheduler about a completion, blocking only
+// if both the completions channel and the backlog are full.
+func notifyCompletion(c *completionNotification) {
+	select {
+	case completions <- c:
+		return
+	default:
+	}
+
+	completionBacklog.Lock()
+	if len(completionBacklog.notifications) >= completionBacklog.capacity {
+		completionBacklog.blocked++
+		for len(completionBacklog.notifications) >= completionBacklog.capacity {
+			completionBacklog.drained.Wait()
+		}
+	}
+	completionBacklog.notifications = append(completionBacklog.notifications, c)
+	completionBacklog.overflows++
+	completionBacklog.Unlock()
+
+	select {
+	case completionBacklog.ready <- struct{}{}:
+	default:
+		// already signalled
+	}
+}
+
+// takeCompletionBacklog returns and clears the pending completion backlog.
+func takeCompletionBacklog() []*completionNotification {
+	completionBacklog.Lock()
+	defer completionBacklog.Unlock()
+	backlog := completionBacklog.notifications
+	completionBacklog.notifications = nil
+	completionBacklog.drained.Broadcast()
+	return backlog
+}
+
+// GetIntakeStatus returns the occupancy of the scheduler intake and the
+// admission counters.
+func GetIntakeStatus() *registration.IntakeStatus {
+	if requests == nil {
+		return nil
+	}
+	completionBacklog.Lock()
+	backlog := len(completionBacklog.notifications)
+	overflows := completionBacklog.overflows
+	blocked := completionBacklog.blocked
+	completionBacklog.Unlock()
+
+	return &registration.IntakeStatus{
+		QueuedRequests:       len(requests),
+		Capacity:             cap(requests),
+		Admitted:             atomic.LoadInt64(&admittedCount),
+		Rejected:             atomic.LoadInt64(&rejectedCount),
+		QueuedCompletions:    len(completions) + backlog,
+		CompletionsCapacity:  cap(completions),
+		CompletionsOverflows: overflows,
+		CompletionsBlocked:   blocked,
+	}
+}
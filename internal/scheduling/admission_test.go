@@ -0,0 +1,97 @@
+package scheduling
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/grussorusso/serverledge/internal/config"
+	"github.com/grussorusso/serverledge/internal/function"
+	"github.com/spf13/viper"
+)
+
+// initTestIntake creates an intake with the given capacities.
+func initTestIntake(t *testing.T, requests, completions, backlog int) {
+	viper.Set(config.SCHEDULER_INTAKE_CAPACITY, requests)
+	viper.Set(config.SCHEDULER_COMPLETIONS_CAPACITY, completions)
+	viper.Set(config.SCHEDULER_COMPLETIONS_BACKLOG, backlog)
+	t.Cleanup(func() {
+		viper.Set(config.SCHEDULER_INTAKE_CAPACITY, nil)
+		viper.Set(config.SCHEDULER_COMPLETIONS_CAPACITY, nil)
+		viper.Set(config.SCHEDULER_COMPLETIONS_BACKLOG, nil)
+	})
+	initIntake()
+}
+
+func TestAdmit(t *testing.T) {
+	initTestIntake(t, 2, 1, 1)
+	f := &function.Function{Name: "f"}
+	admitted, rejected := GetIntakeStatus().Admitted, GetIntakeStatus().Rejected
+
+	for i := 0; i < 2; i++ {
+		if err := admit(newPendingRequest(f, function.LOW, 0.0)); err != nil {
+			t.Fatalf("request %d not admitted: %v", i, err)
+		}
+	}
+	if !IsOverloaded() {
+		t.Fatalf("full intake not reported as overloaded")
+	}
+	if err := admit(newPendingRequest(f, function.LOW, 0.0)); !errors.Is(err, OverloadedErr) {
+		t.Fatalf("request admitted to a full intake: %v", err)
+	}
+	RejectRequest(f)
+
+	status := GetIntakeStatus()
+	if status.QueuedRequests != 2 || status.Capacity != 2 ||
+		status.Admitted-admitted != 2 || status.Rejected-rejected != 2 {
+		t.Fatalf("unexpected intake status: %+v", status)
+	}
+
+	<-requests
+	if IsOverloaded() {
+		t.Fatalf("intake still overloaded")
+	}
+}
+
+func TestNotifyCompletionBacklog(t *testing.T) {
+	initTestIntake(t, 1, 1, 2)
+	f := &function.Function{Name: "f"}
+	overflows, blocked := GetIntakeStatus().CompletionsOverflows, GetIntakeStatus().CompletionsBlocked
+
+	// one completion in the channel, two in the backlog
+	for i := 0; i < 3; i++ {
+		notifyCompletion(&completionNotification{fun: f})
+	}
+	status := GetIntakeStatus()
+	if status.QueuedCompletions != 3 || status.CompletionsOverflows-overflows != 2 || status.CompletionsBlocked != blocked {
+		t.Fatalf("unexpected intake status: %+v", status)
+	}
+
+	// the backlog is full: the next notification waits for the scheduler
+	notified := make(chan struct{})
+	go func() {
+		notifyCompletion(&completionNotification{fun: f})
+		close(notified)
+	}()
+	select {
+	case <-notified:
+		t.Fatalf("completion added to a full backlog")
+	case <-time.After(50 * time.Millisecond):
+	}
+	if GetIntakeStatus().CompletionsBlocked-blocked != 1 {
+		t.Fatalf("blocked completion not accounted for")
+	}
+
+	<-completionBacklog.ready
+	if backlog := takeCompletionBacklog(); len(backlog) != 2 {
+		t.Fatalf("unexpected backlog: %d completions", len(backlog))
+	}
+	select {
+	case <-notified:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("completion still waiting after the backlog was drained")
+	}
+	if backlog := takeCompletionBacklog(); len(backlog) != 1 {
+		t.Fatalf("unexpected backlog: %d completions", len(backlog))
+	}
+}
@@ -0,0 +1,283 @@
+package scheduling
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grussorusso/serverledge/internal/config"
+	"github.com/grussorusso/serverledge/internal/function"
+	"github.com/grussorusso/serverledge/internal/node"
+	"github.com/grussorusso/serverledge/utils"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+var ThrottledErr = errors.New("the function concurrency limit has been reached")
+
+// Each node publishes the number of concurrency slots it holds for each
+// function under concurrencyEtcdPrefix/<function>/<node>, attached to a lease
+// so that slots held by failed nodes are eventually released.
+const concurrencyEtcdPrefix = "/concurrency/"
+const concurrencyLeaseTTL = 10
+const concurrencyMaxAttempts = 10
+
+type clusterConcurrency struct {
+	sync.Mutex                        // guards held and functions
+	held       map[string]int64       // slots held by this node for each function
+	functions  map[string]*sync.Mutex // serialize the updates of the key of each function
+	leaseMu    sync.Mutex             // guards lease
+	lease      clientv3.LeaseID
+}
+
+var concurrency = &clusterConcurrency{held: make(map[string]int64), functions: make(map[string]*sync.Mutex)}
+
+// needsConcurrencySlot returns true if invocations of f are subject to
+// cluster-wide concurrency limits.
+func needsConcurrencySlot(f *function.Function) bool {
+	return f.MaxConcurrency > 0 || config.GetInt(config.CLUSTER_CONCURRENCY_LIMIT, 0) > 0
+}
+
+// functionConcurrencyPrefix returns the prefix of the keys of all the nodes
+// for f.
+func functionConcurrencyPrefix(f *function.Function) string {
+	return concurrencyEtcdPrefix + f.Name + "/"
+}
+
+func concurrencyKey(f *function.Function) string {
+	return functionConcurrencyPrefix(f) + node.NodeIdentifier
+}
+
+// functionLock returns the lock serializing the updates of the key of this
+// node for a function. No etcd operation is performed while holding the
+// lock of clusterConcurrency.
+func (cc *clusterConcurrency) functionLock(name string) *sync.Mutex {
+	cc.Lock()
+	defer cc.Unlock()
+	l, ok := cc.functions[name]
+	if !ok {
+		l = &sync.Mutex{}
+		cc.functions[name] = l
+	}
+	return l
+}
+
+func (cc *clusterConcurrency) heldSlots(name string) int64 {
+	cc.Lock()
+	defer cc.Unlock()
+	return cc.held[name]
+}
+
+func (cc *clusterConcurrency) setHeldSlots(name string, held int64) {
+	cc.Lock()
+	defer cc.Unlock()
+	if held <= 0 {
+		delete(cc.held, name)
+	} else {
+		cc.held[name] = held
+	}
+}
+
+// getLease returns the lease attached to the keys of this node, creating it
+// if needed.
+func (cc *clusterConcurrency) getLease(cli *clientv3.Client) (clientv3.LeaseID, error) {
+	cc.leaseMu.Lock()
+	defer cc.leaseMu.Unlock()
+	if cc.lease != clientv3.NoLease {
+		return cc.lease, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	resp, err := cli.Grant(ctx, concurrencyLeaseTTL)
+	if err != nil {
+		return clientv3.NoLease, err
+	}
+	keepAliveCh, err := cli.KeepAlive(context.Background(), resp.ID)
+	if err != nil {
+		return clientv3.NoLease, err
+	}
+	go func() {
+		for range keepAliveCh {
+			// consume keep-alive responses
+		}
+		// the lease has expired: a new one will be created (the slots
+		// held so far are lost)
+		cc.leaseMu.Lock()
+		cc.lease = clientv3.NoLease
+		cc.leaseMu.Unlock()
+	}()
+
+	cc.lease = resp.ID
+	return cc.lease, nil
+}
+
+// concurrencyUnavailable returns the outcome of acquireConcurrencySlot when
+// the limits cannot be checked: the invocation is admitted without holding a
+// slot or, if the node is configured to fail closed, throttled.
+func concurrencyUnavailable(err error) (bool, error) {
+	if config.GetBool(config.CLUSTER_CONCURRENCY_FAIL_OPEN, true) {
+		log.Printf("Concurrency limits not enforced: %v\n", err)
+		return false, nil
+	}
+	log.Printf("Throttling invocation, concurrency limits cannot be checked: %v\n", err)
+	return false, fmt.Errorf("%w: %v", ThrottledErr, err)
+}
+
+// admits checks whether a new invocation of f is allowed, given the current
+// usage of the cluster.
+func admits(f *function.Function, usage map[string]int64, reservations map[string]int64) bool {
+	if f.MaxConcurrency > 0 && usage[f.Name] >= f.MaxConcurrency {
+		return false
+	}
+
+	limit := int64(config.GetInt(config.CLUSTER_CONCURRENCY_LIMIT, 0))
+	if limit <= 0 || usage[f.Name] < reservations[f.Name] {
+		// within the reserved concurrency
+		return true
+	}
+
+	// the invocation consumes a slot of the unreserved capacity
+	unreserved := limit
+	for _, r := range reservations {
+		unreserved -= r
+	}
+	var shared int64 = 0
+	for name, u := range usage {
+		if u > reservations[name] {
+			shared += u - reservations[name]
+		}
+	}
+	return shared < unreserved
+}
+
+// acquireConcurrencySlot reserves a cluster-wide concurrency slot for an
+// invocation of f. It returns true if a slot has been acquired (and must be
+// released), and ThrottledErr if the limits have been reached. If the
+// registry is not available, the outcome depends on CLUSTER_CONCURRENCY_FAIL_OPEN.
+//
+// The slot is taken only if the keys the decision depends on did not change
+// in the meantime: the ones of f and, if the cluster-wide limit is
+// configured, the reservations and, for slots of the shared capacity, the
+// keys of all the functions.
+func acquireConcurrencySlot(f *function.Function) (bool, error) {
+	cli, err := utils.GetEtcdClient()
+	if err != nil {
+		return concurrencyUnavailable(err)
+	}
+
+	fl := concurrency.functionLock(f.Name)
+	fl.Lock()
+	defer fl.Unlock()
+
+	lease, err := concurrency.getLease(cli)
+	if err != nil {
+		return concurrencyUnavailable(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	limit := int64(config.GetInt(config.CLUSTER_CONCURRENCY_LIMIT, 0))
+	usagePrefix := functionConcurrencyPrefix(f)
+	if limit > 0 {
+		usagePrefix = concurrencyEtcdPrefix
+	}
+
+	for attempt := 0; attempt < concurrencyMaxAttempts; attempt++ {
+		resp, err := cli.Get(ctx, usagePrefix, clientv3.WithPrefix())
+		if err != nil {
+			return concurrencyUnavailable(err)
+		}
+		usage := make(map[string]int64)
+		for _, kv := range resp.Kvs {
+			funcName := strings.SplitN(strings.TrimPrefix(string(kv.Key), concurrencyEtcdPrefix), "/", 2)[0]
+			count, _ := strconv.ParseInt(string(kv.Value), 10, 64)
+			usage[funcName] += count
+		}
+		rev := resp.Header.Revision + 1
+
+		cmps := []clientv3.Cmp{
+			clientv3.Compare(clientv3.ModRevision(functionConcurrencyPrefix(f)), "<", rev).WithPrefix(),
+		}
+		reservations := make(map[string]int64)
+		if limit > 0 {
+			reservations, err = getReservations(ctx, cli)
+			if err != nil {
+				return concurrencyUnavailable(err)
+			}
+			cmps = append(cmps, clientv3.Compare(clientv3.ModRevision(function.ReservationEtcdPrefix), "<", rev).WithPrefix())
+			if usage[f.Name] >= reservations[f.Name] {
+				// the slot is taken from the shared capacity
+				cmps = append(cmps, clientv3.Compare(clientv3.ModRevision(concurrencyEtcdPrefix), "<", rev).WithPrefix())
+			}
+		}
+
+		if !admits(f, usage, reservations) {
+			return false, ThrottledErr
+		}
+
+		held := concurrency.heldSlots(f.Name) + 1
+		txn, err := cli.Txn(ctx).
+			If(cmps...).
+			Then(clientv3.OpPut(concurrencyKey(f), strconv.FormatInt(held, 10), clientv3.WithLease(lease))).
+			Commit()
+		if err != nil {
+			return concurrencyUnavailable(err)
+		}
+		if txn.Succeeded {
+			concurrency.setHeldSlots(f.Name, held)
+			return true, nil
+		}
+	}
+
+	// too much contention
+	return false, ThrottledErr
+}
+
+// getReservations returns the reserved concurrency of each function.
+func getReservations(ctx context.Context, cli *clientv3.Client) (map[string]int64, error) {
+	resp, err := cli.Get(ctx, function.ReservationEtcdPrefix, clientv3.WithPrefix())
+	if err != nil {
+		return nil, err
+	}
+	reservations := make(map[string]int64)
+	for _, kv := range resp.Kvs {
+		r, _ := strconv.ParseInt(string(kv.Value), 10, 64)
+		reservations[strings.TrimPrefix(string(kv.Key), function.ReservationEtcdPrefix)] = r
+	}
+	return reservations, nil
+}
+
+// releaseConcurrencySlot releases a slot acquired for an invocation of f.
+func releaseConcurrencySlot(f *function.Function) {
+	cli, err := utils.GetEtcdClient()
+	if err != nil {
+		return
+	}
+
+	fl := concurrency.functionLock(f.Name)
+	fl.Lock()
+	defer fl.Unlock()
+
+	held := concurrency.heldSlots(f.Name) - 1
+	concurrency.setHeldSlots(f.Name, held)
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	if held <= 0 {
+		_, err = cli.Delete(ctx, concurrencyKey(f))
+	} else {
+		var lease clientv3.LeaseID
+		lease, err = concurrency.getLease(cli)
+		if err == nil {
+			_, err = cli.Put(ctx, concurrencyKey(f), strconv.FormatInt(held, 10), clientv3.WithLease(lease))
+		}
+	}
+	if err != nil {
+		log.Printf("Could not release concurrency slot for %s: %v\n", f, err)
+	}
+}
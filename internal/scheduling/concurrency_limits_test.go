@@ -0,0 +1,53 @@
+package scheduling
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/grussorusso/serverledge/internal/config"
+	"github.com/grussorusso/serverledge/internal/function"
+	"github.com/spf13/viper"
+)
+
+func TestAdmits(t *testing.T) {
+	defer viper.Set(config.CLUSTER_CONCURRENCY_LIMIT, nil)
+	viper.Set(config.CLUSTER_CONCURRENCY_LIMIT, 10)
+
+	f := &function.Function{Name: "f", MaxConcurrency: 5}
+	g := &function.Function{Name: "g"}
+	reservations := map[string]int64{"f": 3, "h": 4}
+
+	cases := []struct {
+		f        *function.Function
+		usage    map[string]int64
+		admitted bool
+	}{
+		{f, map[string]int64{"f": 4}, true},
+		{f, map[string]int64{"f": 5}, false}, // MaxConcurrency
+		// reserved slots are available even if the shared ones are not
+		{f, map[string]int64{"f": 2, "g": 3}, true},
+		{f, map[string]int64{"f": 3, "g": 3}, false},
+		{g, map[string]int64{"g": 2}, true},
+		{g, map[string]int64{"g": 3}, false},
+		// unused reservations are not shared
+		{g, map[string]int64{"g": 2, "f": 1}, true},
+	}
+	for i, c := range cases {
+		if admits(c.f, c.usage, reservations) != c.admitted {
+			t.Errorf("case %d: expected admitted = %v", i, c.admitted)
+		}
+	}
+}
+
+func TestConcurrencyUnavailable(t *testing.T) {
+	defer viper.Set(config.CLUSTER_CONCURRENCY_FAIL_OPEN, nil)
+	unavailable := errors.New("etcd unavailable")
+
+	if acquired, err := concurrencyUnavailable(unavailable); acquired || err != nil {
+		t.Fatalf("invocation not admitted by default: %v", err)
+	}
+	viper.Set(config.CLUSTER_CONCURRENCY_FAIL_OPEN, false)
+	if acquired, err := concurrencyUnavailable(unavailable); acquired || !errors.Is(err, ThrottledErr) {
+		t.Fatalf("invocation not throttled when failing closed: %v", err)
+	}
+}
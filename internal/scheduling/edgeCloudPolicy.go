@@ -16,9 +16,9 @@ func (p *CloudEdgePolicy) OnCompletion(_ *function.Function, _ *function.Executi
 }
 
 func (p *CloudEdgePolicy) OnArrival(r *scheduledRequest) {
-	containerID, err := node.AcquireRunningContainer(r.Fun)
+	containerID, instances, err := node.AcquireRunningContainer(r.Fun)
 	if err == nil {
-		execLocally(r, containerID, false)
+		execLocally(r, containerID, false, instances)
 	} else if handleUnavailableRunningContainer(r) {
 		return
 	} else if r.CanDoOffloading {
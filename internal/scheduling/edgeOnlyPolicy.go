@@ -24,9 +24,9 @@ func (p *EdgePolicy) OnArrival(r *scheduledRequest) {
 			return
 		}
 	} else {
-		containerID, err := node.AcquireRunningContainer(r.Fun)
+		containerID, instances, err := node.AcquireRunningContainer(r.Fun)
 		if err == nil {
-			execLocally(r, containerID, true)
+			execLocally(r, containerID, true, instances)
 		} else if handleUnavailableRunningContainer(r) {
 			return
 		}
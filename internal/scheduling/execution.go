@@ -1,10 +1,15 @@
 package scheduling
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"math"
 	"time"
 
+	"github.com/grussorusso/serverledge/internal/clock"
 	"github.com/grussorusso/serverledge/internal/function"
+	"github.com/grussorusso/serverledge/internal/node"
 
 	"github.com/grussorusso/serverledge/internal/container"
 	"github.com/grussorusso/serverledge/internal/executor"
@@ -12,8 +17,9 @@ import (
 
 const HANDLER_DIR = "/app"
 
-// Execute serves a request on the specified container.
-func Execute(contID container.ContainerID, r *scheduledRequest, isWarm bool) (function.ExecutionReport, error) {
+// Execute serves a request on the specified container, shared by the given
+// number of instances when it was acquired.
+func Execute(contID container.ContainerID, r *scheduledRequest, isWarm bool, instances int64) (function.ExecutionReport, error) {
 	//log.Printf("[%s] Executing on container: %v", r.Fun, contID)
 
 	var req executor.InvocationRequest
@@ -21,6 +27,7 @@ func Execute(contID container.ContainerID, r *scheduledRequest, isWarm bool) (fu
 		req = executor.InvocationRequest{
 			Params:       r.Params,
 			ReturnOutput: r.ReturnOutput,
+			Timeout:      remainingTimeout(r.Ctx),
 		}
 	} else {
 		cmd := container.RuntimeToInfo[r.Fun.Runtime].InvocationCmd
@@ -30,37 +37,84 @@ func Execute(contID container.ContainerID, r *scheduledRequest, isWarm bool) (fu
 			Handler:      r.Fun.Handler,
 			HandlerDir:   HANDLER_DIR,
 			ReturnOutput: r.ReturnOutput,
+			Timeout:      remainingTimeout(r.Ctx),
 		}
 	}
 
-	t0 := time.Now()
+	// warm containers may have been paused while idle
+	unpauseTime, err := node.UnpauseContainer(contID)
+	if err != nil {
+		notifyCompletion(&completionNotification{fun: r.Fun, contID: contID, executionReport: nil})
+		return function.ExecutionReport{}, fmt.Errorf("[%s] Could not unpause container: %v", r, err)
+	}
+
+	t0 := clock.Now()
 	initTime := t0.Sub(r.Arrival).Seconds()
 
-	response, invocationWait, err := container.Execute(contID, &req)
+	// the execution is aborted if the container terminates
+	ctx, cancel := context.WithCancel(r.Ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-node.ContainerDied(contID):
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	response, err := container.Execute(ctx, contID, &req)
 	if err != nil {
 		// notify scheduler
-		completions <- &completionNotification{fun: r.Fun, contID: contID, executionReport: nil}
+		notifyCompletion(&completionNotification{fun: r.Fun, contID: contID, executionReport: nil})
+		if reason := node.FailureReason(contID); reason != "" {
+			return function.ExecutionReport{
+				IsWarmStart:   isWarm,
+				ResponseTime:  clock.Now().Sub(r.Arrival).Seconds(),
+				FailureReason: reason,
+			}, fmt.Errorf("[%s] %w: %s", r, node.ContainerFailedErr, reason)
+		} else if errors.Is(err, context.DeadlineExceeded) {
+			return function.ExecutionReport{
+				TimedOut:     true,
+				IsWarmStart:  isWarm,
+				ResponseTime: clock.Now().Sub(r.Arrival).Seconds(),
+			}, TimeoutErr
+		} else if errors.Is(err, context.Canceled) {
+			return function.ExecutionReport{}, err
+		}
 		return function.ExecutionReport{}, fmt.Errorf("[%s] Execution failed: %v", r, err)
 	}
 
 	if !response.Success {
 		// notify scheduler
-		completions <- &completionNotification{fun: r.Fun, contID: contID, executionReport: nil}
+		notifyCompletion(&completionNotification{fun: r.Fun, contID: contID, executionReport: nil})
 		return function.ExecutionReport{}, fmt.Errorf("Function execution failed")
 	}
 
 	report := function.ExecutionReport{Result: response.Result,
 		Output:       response.Output,
 		IsWarmStart:  isWarm,
-		Duration:     time.Now().Sub(t0).Seconds() - invocationWait.Seconds(),
-		ResponseTime: time.Now().Sub(r.Arrival).Seconds()}
-
-	// initializing containers may require invocation retries, adding
-	// latency
-	report.InitTime = initTime + invocationWait.Seconds()
+		Duration:     clock.Now().Sub(t0).Seconds(),
+		ResponseTime: clock.Now().Sub(r.Arrival).Seconds()}
+	report.DeadlineMissed = r.MissesDeadline(report.ResponseTime)
+	report.UnpauseTime = unpauseTime.Seconds()
+	report.InitTime = initTime
+	if !isWarm {
+		report.ReadinessTime = container.TakeReadinessTime(contID).Seconds()
+	}
 
 	// notify scheduler
-	completions <- &completionNotification{fun: r.Fun, contID: contID, executionReport: &report}
+	notifyCompletion(&completionNotification{fun: r.Fun, contID: contID, instances: instances, executionReport: &report})
 
 	return report, nil
 }
+
+// remainingTimeout returns the time (in seconds) left before ctx expires,
+// or 0 if ctx has no deadline.
+func remainingTimeout(ctx context.Context) float64 {
+	d, ok := ctx.Deadline()
+	if !ok {
+		return 0.0
+	}
+	// a non-positive value would disable the timeout in the executor
+	return math.Max(time.Until(d).Seconds(), 0.001)
+}
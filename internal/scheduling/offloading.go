@@ -2,83 +2,179 @@ package scheduling
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/grussorusso/serverledge/internal/client"
+	"github.com/grussorusso/serverledge/internal/clock"
 	"github.com/grussorusso/serverledge/internal/function"
 	"github.com/grussorusso/serverledge/internal/node"
 	"github.com/grussorusso/serverledge/internal/registration"
 )
 
+// RateLimitedErr is returned if the node a request is offloaded to rejects
+// it because of the rate limits of the function or of the caller.
+var RateLimitedErr = errors.New("the rate limit has been exceeded")
+
+// rateLimitedError wraps RateLimitedErr with the time to wait before
+// retrying, as reported by the remote node.
+type rateLimitedError struct {
+	retryAfter time.Duration
+}
+
+func (e *rateLimitedError) Error() string {
+	return fmt.Sprintf("%v (retry after %v)", RateLimitedErr, e.retryAfter)
+}
+
+func (e *rateLimitedError) Unwrap() error {
+	return RateLimitedErr
+}
+
+// RetryAfter returns the time to wait before retrying a request rejected
+// with RateLimitedErr (0 if unknown).
+func RetryAfter(err error) time.Duration {
+	var e *rateLimitedError
+	if errors.As(err, &e) {
+		return e.retryAfter
+	}
+	return 0
+}
+
+// tooManyRequestsErr returns the error corresponding to a 429 response to an
+// offloaded request, which is sent for rate-limited, throttled and
+// out-of-resources requests.
+func tooManyRequestsErr(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	reason := string(body)
+	if strings.HasPrefix(reason, "Rate limit exceeded") {
+		seconds, _ := strconv.Atoi(resp.Header.Get("Retry-After"))
+		return &rateLimitedError{retryAfter: time.Duration(seconds) * time.Second}
+	} else if strings.HasPrefix(reason, "Throttled") {
+		return ThrottledErr
+	}
+	return node.OutOfResourcesErr
+}
+
 const SCHED_ACTION_OFFLOAD = "O"
+const SCHED_ACTION_CLOUD_OFFLOAD = "OC"
+
+// isOffloaded returns true if the report refers to an offloaded execution
+func isOffloaded(report *function.ExecutionReport) bool {
+	return report.SchedAction == SCHED_ACTION_OFFLOAD || report.SchedAction == SCHED_ACTION_CLOUD_OFFLOAD
+}
 
 func pickEdgeNodeForOffloading(r *scheduledRequest) (url string) {
+	if registration.Reg == nil {
+		// Edge monitoring is not active (e.g., Cloud nodes)
+		return ""
+	}
 	nearbyServersMap := registration.Reg.NearbyServersMap
 	if nearbyServersMap == nil {
 		return ""
 	}
 	//first, search for warm container
 	for _, v := range nearbyServersMap {
-		if v.AvailableWarmContainers[r.Fun.Name] != 0 && v.AvailableCPUs >= r.Request.Fun.CPUDemand {
+		if v.AvailableWarmContainers[r.Fun.Name] != 0 && v.AvailableCPUs >= r.Request.Fun.ContainerCPUDemand(1) {
 			return v.Url
 		}
 	}
 	//second, (nobody has warm container) search for available memory
 	for _, v := range nearbyServersMap {
-		if v.AvailableMemMB >= r.Request.Fun.MemoryMB && v.AvailableCPUs >= r.Request.Fun.CPUDemand {
+		if v.AvailableMemMB >= r.Request.Fun.ContainerMemoryMB(1) && v.AvailableCPUs >= r.Request.Fun.ContainerCPUDemand(1) {
 			return v.Url
 		}
 	}
 	return ""
 }
 
+// remainingRespTime returns the response time still available to a request
+// that is going to be offloaded.
+func remainingRespTime(r *function.Request) float64 {
+	if r.MaxRespT <= 0.0 {
+		return r.MaxRespT
+	}
+	// a non-positive value would disable the deadline on the remote node
+	return math.Max(r.MaxRespT-clock.Now().Sub(r.Arrival).Seconds(), 0.001)
+}
+
 func Offload(r *function.Request, serverUrl string) (function.ExecutionReport, error) {
 	// Prepare request
-	request := client.InvocationRequest{Params: r.Params, QoSClass: int64(r.Class), QoSMaxRespT: r.MaxRespT}
+	request := client.InvocationRequest{Params: r.Params,
+		QoSClass:    int64(r.Class),
+		QoSMaxRespT: remainingRespTime(r),
+		Timeout:     remainingTimeout(r.Ctx)}
 	invocationBody, err := json.Marshal(request)
 	if err != nil {
 		log.Print(err)
 		return function.ExecutionReport{}, err
 	}
-	sendingTime := time.Now() // used to compute latency later on
-	resp, err := offloadingClient.Post(serverUrl+"/invoke/"+r.Fun.Name, "application/json",
+	// the concurrency slot of the request is held by this node until the
+	// response is received
+	httpReq, err := http.NewRequestWithContext(r.Ctx, http.MethodPost, serverUrl+"/offload/"+r.Fun.Name,
 		bytes.NewBuffer(invocationBody))
-
 	if err != nil {
-		log.Print(err)
 		return function.ExecutionReport{}, err
 	}
-	if resp.StatusCode != http.StatusOK {
-		if resp.StatusCode == http.StatusTooManyRequests {
-			return function.ExecutionReport{}, node.OutOfResourcesErr
-		}
-		return function.ExecutionReport{}, fmt.Errorf("Remote returned: %v", resp.StatusCode)
+	httpReq.Header.Set("Content-Type", "application/json")
+	// the remote node enforces the rate limits of the original caller
+	if r.Caller != "" {
+		httpReq.Header.Set(client.CallerHeader, r.Caller)
 	}
+	sendingTime := clock.Now() // used to compute latency later on
+	resp, err := offloadingClient.Do(httpReq)
 
-	var response function.Response
+	if errors.Is(err, context.DeadlineExceeded) {
+		return function.ExecutionReport{TimedOut: true, SchedAction: SCHED_ACTION_OFFLOAD}, TimeoutErr
+	} else if err != nil {
+		log.Print(err)
+		return function.ExecutionReport{}, err
+	}
 	defer func(Body io.ReadCloser) {
 		err := Body.Close()
 		if err != nil {
 			fmt.Printf("Error while closing offload response body: %s\n", err)
 		}
 	}(resp.Body)
-	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		if resp.StatusCode == http.StatusTooManyRequests {
+			return function.ExecutionReport{}, tooManyRequestsErr(resp)
+		} else if resp.StatusCode == http.StatusServiceUnavailable {
+			return function.ExecutionReport{}, OverloadedErr
+		} else if resp.StatusCode == http.StatusUnprocessableEntity {
+			return function.ExecutionReport{DeadlineMissed: true, SchedAction: SCHED_ACTION_OFFLOAD}, DeadlineMissedErr
+		} else if resp.StatusCode == http.StatusGatewayTimeout {
+			return function.ExecutionReport{TimedOut: true, SchedAction: SCHED_ACTION_OFFLOAD}, TimeoutErr
+		}
+		return function.ExecutionReport{}, fmt.Errorf("Remote returned: %v", resp.StatusCode)
+	}
+
+	var response function.Response
+	body, err := io.ReadAll(resp.Body)
+	if errors.Is(err, context.DeadlineExceeded) {
+		return function.ExecutionReport{TimedOut: true, SchedAction: SCHED_ACTION_OFFLOAD}, TimeoutErr
+	}
 	if err = json.Unmarshal(body, &response); err != nil {
 		return function.ExecutionReport{}, err
 	}
-	now := time.Now()
+	now := clock.Now()
 
 	execReport := &response.ExecutionReport
 
-	// TODO: check how this is used in the QoSAware policy
+	// The QoSAware policy learns the response time of offloaded requests
+	// as OffloadLatency + InitTime + Duration.
 	// It was originially computed as "report.Arrival - sendingTime"
 	execReport.OffloadLatency = now.Sub(sendingTime).Seconds() - execReport.Duration - execReport.InitTime
 	execReport.SchedAction = SCHED_ACTION_OFFLOAD
+	execReport.DeadlineMissed = r.MissesDeadline(now.Sub(r.Arrival).Seconds())
 
 	return response.ExecutionReport, nil
 }
@@ -87,20 +183,31 @@ func OffloadAsync(r *function.Request, serverUrl string) error {
 	// Prepare request
 	request := client.InvocationRequest{Params: r.Params,
 		QoSClass:    int64(r.Class),
-		QoSMaxRespT: r.MaxRespT,
+		QoSMaxRespT: remainingRespTime(r),
+		Timeout:     remainingTimeout(r.Ctx),
 		Async:       true}
 	invocationBody, err := json.Marshal(request)
 	if err != nil {
 		log.Print(err)
 		return err
 	}
-	resp, err := offloadingClient.Post(serverUrl+"/invoke/"+r.Fun.Name, "application/json",
-		bytes.NewBuffer(invocationBody))
+	// the concurrency slot is released as soon as the request is accepted,
+	// so the remote node acquires a new one
+	httpReq, err := http.NewRequest(http.MethodPost, serverUrl+"/invoke/"+r.Fun.Name, bytes.NewBuffer(invocationBody))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if r.Caller != "" {
+		httpReq.Header.Set(client.CallerHeader, r.Caller)
+	}
+	resp, err := offloadingClient.Do(httpReq)
 
 	if err != nil {
 		log.Print(err)
 		return err
 	}
+	_ = resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
 		return fmt.Errorf("Remote returned: %v", resp.StatusCode)
 	}
@@ -0,0 +1,54 @@
+package scheduling
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/grussorusso/serverledge/internal/client"
+	"github.com/grussorusso/serverledge/internal/function"
+	"github.com/grussorusso/serverledge/internal/node"
+)
+
+func TestOffloadTooManyRequests(t *testing.T) {
+	var reply string
+	var callers []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/offload/f" {
+			t.Errorf("unexpected path: %s", req.URL.Path)
+		}
+		callers = append(callers, req.Header.Get(client.CallerHeader))
+		w.Header().Set("Retry-After", "3")
+		w.WriteHeader(http.StatusTooManyRequests)
+		_, _ = w.Write([]byte(reply))
+	}))
+	defer server.Close()
+	if offloadingClient == nil {
+		offloadingClient = http.DefaultClient
+	}
+
+	r := newPendingRequest(&function.Function{Name: "f"}, function.LOW, 0.0).Request
+	r.Caller = "alice"
+
+	reply = "Rate limit exceeded"
+	_, err := Offload(r, server.URL)
+	if !errors.Is(err, RateLimitedErr) || RetryAfter(err) != 3*time.Second {
+		t.Fatalf("unexpected error for a rate-limited request: %v", err)
+	}
+	reply = "Throttled: function concurrency limit reached"
+	if _, err = Offload(r, server.URL); !errors.Is(err, ThrottledErr) {
+		t.Fatalf("unexpected error for a throttled request: %v", err)
+	}
+	reply = ""
+	if _, err = Offload(r, server.URL); !errors.Is(err, node.OutOfResourcesErr) {
+		t.Fatalf("unexpected error for a request lacking resources: %v", err)
+	}
+
+	for _, caller := range callers {
+		if caller != "alice" {
+			t.Fatalf("the original caller is not forwarded: %q", caller)
+		}
+	}
+}
@@ -1,9 +1,46 @@
 package scheduling
 
-import "github.com/grussorusso/serverledge/internal/function"
+import (
+	"log"
+
+	"github.com/grussorusso/serverledge/internal/config"
+	"github.com/grussorusso/serverledge/internal/function"
+)
 
 type Policy interface {
 	Init()
 	OnCompletion(fun *function.Function, executionReport *function.ExecutionReport)
 	OnArrival(request *scheduledRequest)
 }
+
+// QueueReporter is implemented by policies that may queue requests.
+type QueueReporter interface {
+	// QueueLengths returns the number of queued requests for each service class.
+	QueueLengths() map[string]int
+}
+
+// FunctionQueueReporter is implemented by policies keeping per-function queues.
+type FunctionQueueReporter interface {
+	// FunctionQueueLengths returns the number of queued requests for each function.
+	FunctionQueueLengths() map[string]int
+}
+
+// NewConfiguredPolicy returns the scheduling policy selected in the
+// configuration.
+func NewConfiguredPolicy() Policy {
+	policyConf := config.GetString(config.SCHEDULING_POLICY, "default")
+	log.Printf("Configured policy: %s\n", policyConf)
+	if policyConf == "cloudonly" {
+		return &CloudOnlyPolicy{}
+	} else if policyConf == "edgecloud" {
+		return &CloudEdgePolicy{}
+	} else if policyConf == "edgeonly" {
+		return &EdgePolicy{}
+	} else if policyConf == "edf" {
+		return &EDFPolicy{}
+	} else if policyConf == "qosaware" {
+		return &QoSAwarePolicy{}
+	} else {
+		return &DefaultLocalPolicy{}
+	}
+}
@@ -3,15 +3,23 @@ package scheduling
 import (
 	"errors"
 	"log"
+	"sync"
 
 	"github.com/grussorusso/serverledge/internal/function"
+	"github.com/grussorusso/serverledge/internal/metrics"
 
 	"github.com/grussorusso/serverledge/internal/config"
 	"github.com/grussorusso/serverledge/internal/node"
 )
 
+// DefaultLocalPolicy serves requests locally, queueing them when resources
+// are not available. Each function has its own queue, so that requests for a
+// function lacking capacity do not block requests for other functions:
+// queued requests are served by service class first (with the "priority"
+// queue type) and then in round-robin order among the functions.
 type DefaultLocalPolicy struct {
-	queue queue
+	sync.Mutex
+	queue *FunctionQueues
 }
 
 func (p *DefaultLocalPolicy) Init() {
@@ -19,71 +27,145 @@ func (p *DefaultLocalPolicy) Init() {
 	log.Printf("queue capacity: %d", queueCapacity)
 	if queueCapacity > 0 {
 		log.Printf("Configured queue with capacity %d\n", queueCapacity)
-		p.queue = NewFIFOQueue(queueCapacity)
+		queueType := config.GetString(config.SCHEDULER_QUEUE_TYPE, "fifo")
+		if queueType != "fifo" && queueType != "priority" {
+			log.Printf("Unknown queue type '%s': using FIFO\n", queueType)
+		}
+		lowShare := config.GetFloat(config.SCHEDULER_QUEUE_LOW_SHARE, 0.1)
+		p.queue = NewFunctionQueues(queueCapacity, queueType == "priority", lowShare)
 	} else {
 		p.queue = nil
 	}
 }
 
-func (p *DefaultLocalPolicy) OnCompletion(_ *function.Function, _ *function.ExecutionReport) {
+// QueueLengths returns the number of queued requests for each service class.
+func (p *DefaultLocalPolicy) QueueLengths() map[string]int {
 	if p.queue == nil {
-		return
+		return nil
 	}
 
-	p.queue.Lock()
-	defer p.queue.Unlock()
-	if p.queue.Len() == 0 {
-		return
+	p.Lock()
+	defer p.Unlock()
+	lengths := make(map[string]int)
+	for _, c := range classPriority {
+		lengths[c.String()] = 0
+	}
+	for c, l := range p.queue.LenByClass() {
+		lengths[c.String()] += l
+	}
+	return lengths
+}
+
+// FunctionQueueLengths returns the number of queued requests for each function.
+func (p *DefaultLocalPolicy) FunctionQueueLengths() map[string]int {
+	if p.queue == nil {
+		return nil
+	}
+
+	p.Lock()
+	defer p.Unlock()
+	return p.queue.LenByFunction()
+}
+
+// enqueue adds the request to the queue of its function. The policy must be
+// locked by the caller.
+func (p *DefaultLocalPolicy) enqueue(r *scheduledRequest) bool {
+	if !p.queue.Enqueue(r) {
+		return false
+	}
+	if metrics.Enabled {
+		metrics.SetQueueLength(r.Fun.Name, p.queue.FunctionLen(r.Fun.Name))
+	}
+	return true
+}
+
+// dequeue removes a request returned by p.queue.Next from the queue. The
+// policy must be locked by the caller.
+func (p *DefaultLocalPolicy) dequeue(r *scheduledRequest) {
+	p.queue.Remove(r)
+	if metrics.Enabled {
+		metrics.SetQueueLength(r.Fun.Name, p.queue.FunctionLen(r.Fun.Name))
 	}
+}
 
-	req := p.queue.Front()
+// dispatch tries to serve a queued request, and returns true if the request
+// left the queue. The policy must be locked by the caller.
+func (p *DefaultLocalPolicy) dispatch(req *scheduledRequest) bool {
+	// requests whose client is not waiting anymore are discarded
+	if isCancelled(req) {
+		p.dequeue(req)
+		dropRequest(req)
+		return true
+	}
 
-	containerID, err := node.AcquireRunningContainer(req.Fun)
+	containerID, instances, err := node.AcquireRunningContainer(req.Fun)
 	if err == nil { // if there is a running container
-		p.queue.Dequeue()
-		execLocally(req, containerID, true)
-		return
+		p.dequeue(req)
+		execLocally(req, containerID, true, instances)
+		return true
 	}
 
 	containerWarmID, err := node.AcquireWarmContainer(req.Fun)
 	if err == nil {
-		p.queue.Dequeue()
+		p.dequeue(req)
 		log.Printf("[%s] Warm start from the queue (length=%d)\n", req, p.queue.Len())
-		execLocally(req, containerWarmID, true)
-		return
+		execLocally(req, containerWarmID, true, 1)
+		return true
 	}
 
 	if errors.Is(err, node.NoWarmFoundErr) {
-		if node.AcquireResources(req.Fun.CPUDemand, req.Fun.MemoryMB, true) {
+		if node.AcquireResourcesForNewContainer(req.Fun, true) {
 			log.Printf("[%s] Cold start from the queue\n", req)
-			p.queue.Dequeue()
+			p.dequeue(req)
 
 			// This avoids blocking the thread during the cold
 			// start, but also allows us to check for resource
 			// availability before dequeueing
-			go func(*function.Function) {
+			go func(req *scheduledRequest) {
 				newContainer, err := node.NewContainerWithAcquiredResources(req.Fun)
 				if err != nil {
 					dropRequest(req)
 				} else {
-					execLocally(req, newContainer, false)
+					execLocally(req, newContainer, false, 1)
 				}
-			}(req.Fun)
-			return
+			}(req)
+			return true
 		}
 	} else if errors.Is(err, node.OutOfResourcesErr) {
 	} else {
 		// other error
-		p.queue.Dequeue()
+		p.dequeue(req)
 		dropRequest(req)
+		return true
+	}
+
+	return false
+}
+
+func (p *DefaultLocalPolicy) OnCompletion(_ *function.Function, _ *function.ExecutionReport) {
+	if p.queue == nil {
+		return
+	}
+
+	p.Lock()
+	defer p.Unlock()
+
+	// Serve the queued requests until none can be served. Functions whose
+	// next request cannot be served are skipped, so that the others are
+	// not blocked.
+	blocked := make(map[string]bool)
+	for req := p.queue.Next(blocked); req != nil; req = p.queue.Next(blocked) {
+		if !p.dispatch(req) {
+			blocked[req.Fun.Name] = true
+		}
 	}
 }
 
 func (p *DefaultLocalPolicy) OnArrival(r *scheduledRequest) {
 
-	containerID, err := node.AcquireRunningContainer(r.Fun)
+	containerID, instances, err := node.AcquireRunningContainer(r.Fun)
 	if err == nil { // if there is a running container
-		execLocally(r, containerID, true)
+		execLocally(r, containerID, true, instances)
 		return
 	}
 
@@ -95,9 +177,9 @@ func (p *DefaultLocalPolicy) OnArrival(r *scheduledRequest) {
 
 	// enqueue if possible
 	if p.queue != nil {
-		p.queue.Lock()
-		defer p.queue.Unlock()
-		if p.queue.Enqueue(r) {
+		p.Lock()
+		defer p.Unlock()
+		if p.enqueue(r) {
 			log.Printf("[%s] Added to queue (length=%d)\n", r, p.queue.Len())
 			return
 		}
@@ -0,0 +1,207 @@
+package scheduling
+
+import (
+	"errors"
+	"log"
+
+	"github.com/grussorusso/serverledge/internal/clock"
+	"github.com/grussorusso/serverledge/internal/config"
+	"github.com/grussorusso/serverledge/internal/function"
+	"github.com/grussorusso/serverledge/internal/node"
+)
+
+// EDFPolicy queues requests in Earliest-Deadline-First order, where the
+// deadline of a request is Arrival+MaxRespT. Requests whose deadline cannot
+// be met given the estimated cold start and execution times are offloaded
+// (if possible) or dropped.
+type EDFPolicy struct {
+	queue *EDFQueue
+	stats *statsCollector
+}
+
+func (p *EDFPolicy) Init() {
+	p.stats = newStatsCollector()
+
+	queueCapacity := config.GetInt(config.SCHEDULER_QUEUE_CAPACITY, 100)
+	if queueCapacity > 0 {
+		log.Printf("Configured EDF queue with capacity %d\n", queueCapacity)
+		p.queue = NewEDFQueue(queueCapacity)
+	}
+}
+
+// QueueLengths returns the number of queued requests for each service class.
+func (p *EDFPolicy) QueueLengths() map[string]int {
+	if p.queue == nil {
+		return nil
+	}
+
+	p.queue.Lock()
+	defer p.queue.Unlock()
+	return queueLengthsByClass(p.queue)
+}
+
+// estimatedRespTime returns the expected response time of a request, if
+// served locally right now.
+func (p *EDFPolicy) estimatedRespTime(r *scheduledRequest, coldStart bool) float64 {
+	respTime := clock.Now().Sub(r.Arrival).Seconds()
+	s, ok := p.stats.get(r.Fun)
+	if !ok {
+		// nothing known about the function yet
+		return respTime
+	}
+
+	respTime += s.Duration
+	if coldStart {
+		respTime += s.InitTime
+	}
+	return respTime
+}
+
+func (p *EDFPolicy) canMeetDeadline(r *scheduledRequest, coldStart bool) bool {
+	return r.MaxRespT <= 0.0 || p.estimatedRespTime(r, coldStart) <= r.MaxRespT
+}
+
+// offloadOrDrop offloads a request that cannot be served locally, if
+// possible, or drops it.
+func (p *EDFPolicy) offloadOrDrop(r *scheduledRequest, deadlineMissed bool) {
+	if r.CanDoOffloading {
+		if url := pickEdgeNodeForOffloading(r); url != "" {
+			handleOffload(r, url)
+			return
+		}
+		if config.GetString(config.CLOUD_URL, "") != "" {
+			handleCloudOffload(r)
+			return
+		}
+	}
+
+	if deadlineMissed {
+		dropRequestMissingDeadline(r)
+	} else {
+		dropRequest(r)
+	}
+}
+
+func (p *EDFPolicy) OnCompletion(fun *function.Function, report *function.ExecutionReport) {
+	p.stats.update(fun, report)
+
+	if p.queue == nil {
+		return
+	}
+
+	p.queue.Lock()
+	defer p.queue.Unlock()
+
+	// requests whose client is not waiting anymore are discarded
+	for _, req := range p.queue.RemoveIf(isCancelled) {
+		dropRequest(req)
+	}
+
+	// requests that can no longer meet their deadline are not kept waiting
+	expired := p.queue.RemoveIf(func(r *scheduledRequest) bool {
+		return !p.canMeetDeadline(r, false)
+	})
+	for _, req := range expired {
+		log.Printf("[%s] Deadline cannot be met anymore\n", req)
+		p.offloadOrDrop(req, true)
+	}
+
+	// requests are served until the head has to wait for resources
+	for p.queue.Len() > 0 {
+		if !p.dispatch(p.queue.Front()) {
+			break
+		}
+	}
+}
+
+// dispatch tries to serve the request at the head of the queue, and returns
+// true if the request left the queue. The queue must be locked by the caller.
+func (p *EDFPolicy) dispatch(req *scheduledRequest) bool {
+	containerID, instances, err := node.AcquireRunningContainer(req.Fun)
+	if err == nil {
+		p.queue.Dequeue()
+		execLocally(req, containerID, true, instances)
+		return true
+	}
+
+	containerID, err = node.AcquireWarmContainer(req.Fun)
+	if err == nil {
+		p.queue.Dequeue()
+		log.Printf("[%s] Warm start from the EDF queue (length=%d)\n", req, p.queue.Len())
+		execLocally(req, containerID, true, 1)
+		return true
+	}
+
+	if errors.Is(err, node.NoWarmFoundErr) {
+		if !p.canMeetDeadline(req, true) {
+			// no initialized container is available and a cold start
+			// would miss the deadline: the request must not keep
+			// the others waiting
+			log.Printf("[%s] Deadline cannot be met with a cold start\n", req)
+			p.queue.Dequeue()
+			p.offloadOrDrop(req, true)
+			return true
+		}
+		if !node.AcquireResourcesForNewContainer(req.Fun, true) {
+			return false
+		}
+		log.Printf("[%s] Cold start from the EDF queue\n", req)
+		p.queue.Dequeue()
+
+		go func(req *scheduledRequest) {
+			newContainer, err := node.NewContainerWithAcquiredResources(req.Fun)
+			if err != nil {
+				dropRequest(req)
+			} else {
+				execLocally(req, newContainer, false, 1)
+			}
+		}(req)
+		return true
+	} else if errors.Is(err, node.OutOfResourcesErr) {
+		return false
+	}
+
+	// other error
+	p.queue.Dequeue()
+	dropRequest(req)
+	return true
+}
+
+func (p *EDFPolicy) OnArrival(r *scheduledRequest) {
+	if !p.canMeetDeadline(r, false) {
+		// the deadline would be missed even on an idle node
+		log.Printf("[%s] Deadline cannot be met locally\n", r)
+		p.offloadOrDrop(r, true)
+		return
+	}
+
+	containerID, instances, err := node.AcquireRunningContainer(r.Fun)
+	if err == nil {
+		execLocally(r, containerID, true, instances)
+		return
+	}
+
+	containerID, err = node.AcquireWarmContainer(r.Fun)
+	if err == nil {
+		execLocally(r, containerID, true, 1)
+		return
+	}
+
+	if errors.Is(err, node.NoWarmFoundErr) && p.canMeetDeadline(r, true) {
+		if handleColdStart(r) {
+			return
+		}
+	}
+
+	// enqueue if possible, waiting for an initialized container
+	if p.queue != nil {
+		p.queue.Lock()
+		defer p.queue.Unlock()
+		if p.queue.Enqueue(r) {
+			log.Printf("[%s] Added to EDF queue (length=%d)\n", r, p.queue.Len())
+			return
+		}
+	}
+
+	p.offloadOrDrop(r, !p.canMeetDeadline(r, true))
+}
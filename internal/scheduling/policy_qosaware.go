@@ -0,0 +1,148 @@
+package scheduling
+
+import (
+	"log"
+	"math"
+	"sort"
+
+	"github.com/grussorusso/serverledge/internal/clock"
+	"github.com/grussorusso/serverledge/internal/config"
+	"github.com/grussorusso/serverledge/internal/function"
+	"github.com/grussorusso/serverledge/internal/node"
+)
+
+// QoSAwarePolicy chooses, for each request, among local execution, Edge
+// offloading and Cloud offloading, based on the expected response times
+// learnt for each function, the request service class and its MaxRespT:
+//   - HIGH_PERFORMANCE requests go where the expected response time is lowest;
+//   - HIGH_AVAILABILITY requests prefer local execution, then Edge and Cloud
+//     offloading, and are served even if their deadline is likely missed;
+//   - LOW requests are only executed locally or offloaded to Edge nodes.
+//
+// Until a destination has served the function, its response time is
+// estimated from the local executions (weighting the cold start time by the
+// observed cold start probability) plus the learnt offloading latency.
+type QoSAwarePolicy struct {
+	stats *statsCollector
+}
+
+type qosOption int
+
+const (
+	qosLocal qosOption = iota
+	qosEdge
+	qosCloud
+)
+
+// qosCandidate is a possible action for a request, with its expected
+// response time (+Inf if unknown)
+type qosCandidate struct {
+	option   qosOption
+	respTime float64
+	url      string
+}
+
+func (p *QoSAwarePolicy) Init() {
+	p.stats = newStatsCollector()
+}
+
+func (p *QoSAwarePolicy) OnCompletion(fun *function.Function, report *function.ExecutionReport) {
+	p.stats.update(fun, report)
+}
+
+// remoteRespTime returns the expected response time of a request offloaded
+// to a node never used before for the function: the remote execution is
+// assumed to behave as the local ones, plus the offloading latency.
+func remoteRespTime(s functionStats) float64 {
+	if s.Completions == 0 || s.EdgeOffloads+s.CloudOffloads == 0 {
+		return math.Inf(1)
+	}
+	return s.OffloadLatency + s.Duration + s.ColdProb*s.InitTime
+}
+
+// candidates returns the actions available for a request, ordered by
+// preference according to its service class.
+func (p *QoSAwarePolicy) candidates(r *scheduledRequest) []qosCandidate {
+	s, known := p.stats.get(r.Fun)
+	unknown := math.Inf(1)
+
+	local := qosCandidate{option: qosLocal, respTime: unknown}
+	if known && s.Completions > 0 {
+		local.respTime = s.Duration
+		if !node.HasInitializedContainer(r.Fun) {
+			local.respTime += s.InitTime
+		}
+	}
+	candidates := []qosCandidate{local}
+
+	if r.CanDoOffloading {
+		if url := pickEdgeNodeForOffloading(r); url != "" {
+			edge := qosCandidate{option: qosEdge, respTime: remoteRespTime(s), url: url}
+			if known && s.EdgeOffloads > 0 {
+				edge.respTime = s.EdgeRespTime
+			}
+			candidates = append(candidates, edge)
+		}
+
+		cloudUrl := config.GetString(config.CLOUD_URL, "")
+		if cloudUrl != "" && r.Class != function.LOW {
+			cloud := qosCandidate{option: qosCloud, respTime: remoteRespTime(s), url: cloudUrl}
+			if known && s.CloudOffloads > 0 {
+				cloud.respTime = s.CloudRespTime
+			}
+			candidates = append(candidates, cloud)
+		}
+	}
+
+	if r.Class == function.HIGH_PERFORMANCE {
+		// stable sort: local execution is preferred in case of ties
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return candidates[i].respTime < candidates[j].respTime
+		})
+	}
+
+	return candidates
+}
+
+func (p *QoSAwarePolicy) OnArrival(r *scheduledRequest) {
+	elapsed := clock.Now().Sub(r.Arrival).Seconds()
+
+	// actions likely to violate MaxRespT are only considered for
+	// HIGH_AVAILABILITY requests, after the other ones
+	candidates := p.candidates(r)
+	feasible := make([]qosCandidate, 0, len(candidates))
+	infeasible := make([]qosCandidate, 0)
+	for _, c := range candidates {
+		// unknown response times are optimistically assumed to be feasible
+		if r.MaxRespT <= 0.0 || math.IsInf(c.respTime, 1) || elapsed+c.respTime <= r.MaxRespT {
+			feasible = append(feasible, c)
+		} else {
+			infeasible = append(infeasible, c)
+		}
+	}
+	if r.Class == function.HIGH_AVAILABILITY {
+		feasible = append(feasible, infeasible...)
+	}
+
+	for _, c := range feasible {
+		switch c.option {
+		case qosLocal:
+			if tryLocalExecution(r) {
+				return
+			}
+		case qosEdge:
+			handleOffload(r, c.url)
+			return
+		case qosCloud:
+			handleCloudOffload(r)
+			return
+		}
+	}
+
+	if len(infeasible) > 0 {
+		log.Printf("[%s] Dropping: max response time cannot be met\n", r)
+		dropRequestMissingDeadline(r)
+	} else {
+		dropRequest(r)
+	}
+}
@@ -0,0 +1,134 @@
+package scheduling
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/grussorusso/serverledge/internal/clock"
+	"github.com/grussorusso/serverledge/internal/config"
+	"github.com/grussorusso/serverledge/internal/function"
+	"github.com/grussorusso/serverledge/internal/node"
+	"github.com/spf13/viper"
+)
+
+// resetResources empties the node, leaving the given resources available.
+func resetResources(memMB int64, cpus float64) {
+	node.Resources.Lock()
+	defer node.Resources.Unlock()
+	node.Resources.AvailableMemMB = memMB
+	node.Resources.AvailableCPUs = cpus
+	node.Resources.ContainerPools = make(map[string]*node.ContainerPool)
+}
+
+// newPendingRequest returns a request for f, arrived now, whose client is
+// waiting for a decision.
+func newPendingRequest(f *function.Function, class function.ServiceClass, maxRespT float64) *scheduledRequest {
+	rq := &function.Request{
+		Ctx:        context.Background(),
+		Fun:        f,
+		Arrival:    clock.Now(),
+		RequestQoS: function.RequestQoS{Class: class, MaxRespT: maxRespT},
+	}
+	return &scheduledRequest{Request: rq, decisionChannel: make(chan schedDecision, 1)}
+}
+
+func expectDecision(t *testing.T, r *scheduledRequest, expected action) schedDecision {
+	t.Helper()
+	select {
+	case d := <-r.decisionChannel:
+		if d.action != expected {
+			t.Fatalf("unexpected decision: %+v", d)
+		}
+		return d
+	default:
+		t.Fatalf("no decision taken")
+	}
+	return schedDecision{}
+}
+
+func expectNoDecision(t *testing.T, r *scheduledRequest) {
+	t.Helper()
+	select {
+	case d := <-r.decisionChannel:
+		t.Fatalf("unexpected decision: %+v", d)
+	default:
+	}
+}
+
+func TestEDFSkipsInfeasibleHead(t *testing.T) {
+	resetResources(0, 0.0)
+	f := &function.Function{Name: "f", MemoryMB: 128, MaxFunctionInstances: 1}
+	p := &EDFPolicy{queue: NewEDFQueue(10), stats: newStatsCollector()}
+	p.stats.update(f, &function.ExecutionReport{Duration: 1.0, InitTime: 2.0})
+
+	// a warm start would meet the deadline, a cold start would not
+	infeasible := newPendingRequest(f, function.LOW, 2.5)
+	feasible := newPendingRequest(f, function.LOW, 10.0)
+	p.queue.Enqueue(infeasible)
+	p.queue.Enqueue(feasible)
+
+	p.OnCompletion(f, nil)
+
+	if d := expectDecision(t, infeasible, DROP); !d.deadlineMissed {
+		t.Fatalf("the infeasible request was not dropped for its deadline")
+	}
+	// no resources for a cold start: the next request keeps waiting
+	expectNoDecision(t, feasible)
+	if p.queue.Len() != 1 || p.queue.Front() != feasible {
+		t.Fatalf("unexpected queue content")
+	}
+}
+
+func TestQoSAwareEstimates(t *testing.T) {
+	resetResources(0, 0.0)
+	viper.Set(config.CLOUD_URL, "http://cloud:1323")
+	defer viper.Set(config.CLOUD_URL, nil)
+
+	f := &function.Function{Name: "f", MemoryMB: 128, MaxFunctionInstances: 1}
+	p := &QoSAwarePolicy{}
+	p.Init()
+	r := newPendingRequest(f, function.HIGH_PERFORMANCE, 0.0)
+	r.CanDoOffloading = true
+
+	c := p.candidates(r)
+	if len(c) != 2 || c[0].option != qosLocal || !math.IsInf(c[0].respTime, 1) || !math.IsInf(c[1].respTime, 1) {
+		t.Fatalf("unexpected candidates for an unknown function: %+v", c)
+	}
+
+	// a cold and a warm start
+	p.OnCompletion(f, &function.ExecutionReport{Duration: 1.0, InitTime: 2.0})
+	p.OnCompletion(f, &function.ExecutionReport{Duration: 1.0, IsWarmStart: true})
+	c = p.candidates(r)
+	if c[0].option != qosLocal || math.Abs(c[0].respTime-3.0) > 1e-9 || !math.IsInf(c[1].respTime, 1) {
+		t.Fatalf("unexpected candidates without initialized containers: %+v", c)
+	}
+	if _, ok := node.Resources.ContainerPools[f.Name]; ok {
+		t.Fatalf("a container pool has been created to estimate the response time")
+	}
+
+	p.OnCompletion(f, &function.ExecutionReport{Duration: 1.0, OffloadLatency: 0.5, SchedAction: SCHED_ACTION_CLOUD_OFFLOAD})
+	c = p.candidates(r)
+	if c[0].option != qosCloud || math.Abs(c[0].respTime-1.5) > 1e-9 {
+		t.Fatalf("the fastest option is not preferred: %+v", c)
+	}
+
+	// nodes never used for the function are expected to behave as this one,
+	// plus the offloading latency
+	s, _ := p.stats.get(f)
+	if rt := remoteRespTime(s); math.Abs(rt-(0.5+1.0+0.9*2.0)) > 1e-9 {
+		t.Fatalf("unexpected remote response time: %f", rt)
+	}
+
+	p.OnArrival(r)
+	if d := expectDecision(t, r, EXEC_REMOTE); !d.toCloud {
+		t.Fatalf("the request was not offloaded to the Cloud: %+v", d)
+	}
+
+	// LOW requests are never offloaded to the Cloud
+	low := newPendingRequest(f, function.LOW, 0.0)
+	low.CanDoOffloading = true
+	if c = p.candidates(low); len(c) != 1 || c[0].option != qosLocal {
+		t.Fatalf("unexpected candidates for a LOW request: %+v", c)
+	}
+}
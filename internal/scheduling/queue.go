@@ -1,16 +1,38 @@
 package scheduling
 
-import "sync"
+import (
+	"sync"
+
+	"github.com/grussorusso/serverledge/internal/function"
+)
 
 type queue interface {
 	Enqueue(r *scheduledRequest) bool
 	Dequeue() *scheduledRequest
 	Front() *scheduledRequest
 	Len() int
+	LenByClass() map[function.ServiceClass]int
 	Lock()
 	Unlock()
 }
 
+// queueLengthsByClass returns the length of a queue for each service class,
+// identified by name. The queue must be locked by the caller.
+func queueLengthsByClass(q queue) map[string]int {
+	lengths := make(map[string]int)
+	for _, c := range classPriority {
+		lengths[c.String()] = 0
+	}
+	for c, l := range q.LenByClass() {
+		lengths[c.String()] += l
+	}
+	return lengths
+}
+
+// initial number of slots of a FIFOQueue, which grows as needed up to its
+// capacity
+const initialFIFOSlots = 16
+
 // FIFOQueue defines a circular queue
 type FIFOQueue struct {
 	sync.Mutex
@@ -26,8 +48,12 @@ func NewFIFOQueue(n int) *FIFOQueue {
 	if n < 1 {
 		return nil
 	}
+	slots := n
+	if slots > initialFIFOSlots {
+		slots = initialFIFOSlots
+	}
 	return &FIFOQueue{
-		data:     make([]*scheduledRequest, n),
+		data:     make([]*scheduledRequest, slots),
 		capacity: n,
 		head:     0,
 		tail:     0,
@@ -50,20 +76,39 @@ func (q *FIFOQueue) Enqueue(v *scheduledRequest) bool {
 	if q.IsFull() {
 		return false
 	}
+	if q.size == len(q.data) {
+		q.grow()
+	}
 
 	q.data[q.tail] = v
-	q.tail = (q.tail + 1) % q.capacity
+	q.tail = (q.tail + 1) % len(q.data)
 	q.size = q.size + 1
 	return true
 }
 
+// grow doubles the slots of the queue, up to its capacity
+func (q *FIFOQueue) grow() {
+	slots := 2 * len(q.data)
+	if slots > q.capacity {
+		slots = q.capacity
+	}
+	data := make([]*scheduledRequest, slots)
+	for i := 0; i < q.size; i++ {
+		data[i] = q.data[(q.head+i)%len(q.data)]
+	}
+	q.data = data
+	q.head = 0
+	q.tail = q.size % slots
+}
+
 // Dequeue fetches a element from queue
 func (q *FIFOQueue) Dequeue() *scheduledRequest {
 	if q.IsEmpty() {
 		return nil
 	}
 	v := q.data[q.head]
-	q.head = (q.head + 1) % q.capacity
+	q.data[q.head] = nil
+	q.head = (q.head + 1) % len(q.data)
 	q.size = q.size - 1
 	return v
 }
@@ -80,3 +125,13 @@ func (q *FIFOQueue) Front() *scheduledRequest {
 func (q *FIFOQueue) Len() int {
 	return q.size
 }
+
+// LenByClass returns the current length of the queue for each service class
+func (q *FIFOQueue) LenByClass() map[function.ServiceClass]int {
+	lengths := make(map[function.ServiceClass]int)
+	for i := 0; i < q.size; i++ {
+		r := q.data[(q.head+i)%len(q.data)]
+		lengths[r.Class]++
+	}
+	return lengths
+}
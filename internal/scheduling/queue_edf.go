@@ -0,0 +1,123 @@
+package scheduling
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+
+	"github.com/grussorusso/serverledge/internal/function"
+)
+
+// deadline returns the absolute deadline of a request, i.e., Arrival+MaxRespT.
+// Requests without a max response time have no deadline (ok is false).
+func deadline(r *scheduledRequest) (d time.Time, ok bool) {
+	if r.MaxRespT <= 0.0 {
+		return time.Time{}, false
+	}
+	return r.Arrival.Add(time.Duration(r.MaxRespT * float64(time.Second))), true
+}
+
+// edfHeap implements heap.Interface ordering requests by deadline; requests
+// without a deadline follow, in arrival order.
+type edfHeap []*scheduledRequest
+
+func (h edfHeap) Len() int { return len(h) }
+
+func (h edfHeap) Less(i, j int) bool {
+	di, iok := deadline(h[i])
+	dj, jok := deadline(h[j])
+	if iok && jok {
+		return di.Before(dj)
+	} else if iok != jok {
+		return iok
+	}
+	return h[i].Arrival.Before(h[j].Arrival)
+}
+
+func (h edfHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *edfHeap) Push(x any) { *h = append(*h, x.(*scheduledRequest)) }
+
+func (h *edfHeap) Pop() any {
+	old := *h
+	n := len(old)
+	r := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return r
+}
+
+// EDFQueue is a bounded queue serving requests in Earliest-Deadline-First order
+type EDFQueue struct {
+	sync.Mutex
+	data     edfHeap
+	capacity int
+}
+
+// NewEDFQueue creates a queue
+func NewEDFQueue(n int) *EDFQueue {
+	if n < 1 {
+		return nil
+	}
+	return &EDFQueue{
+		data:     make(edfHeap, 0, n),
+		capacity: n,
+	}
+}
+
+// Enqueue inserts an element according to its deadline
+func (q *EDFQueue) Enqueue(r *scheduledRequest) bool {
+	if len(q.data) >= q.capacity {
+		return false
+	}
+	heap.Push(&q.data, r)
+	return true
+}
+
+// Dequeue fetches the element with the earliest deadline
+func (q *EDFQueue) Dequeue() *scheduledRequest {
+	if len(q.data) == 0 {
+		return nil
+	}
+	return heap.Pop(&q.data).(*scheduledRequest)
+}
+
+func (q *EDFQueue) Front() *scheduledRequest {
+	if len(q.data) == 0 {
+		return nil
+	}
+	return q.data[0]
+}
+
+// Len returns the current length of the queue
+func (q *EDFQueue) Len() int {
+	return len(q.data)
+}
+
+// LenByClass returns the current length of the queue for each service class
+func (q *EDFQueue) LenByClass() map[function.ServiceClass]int {
+	lengths := make(map[function.ServiceClass]int)
+	for _, r := range q.data {
+		lengths[r.Class]++
+	}
+	return lengths
+}
+
+// RemoveIf removes and returns all the queued requests satisfying the condition
+func (q *EDFQueue) RemoveIf(cond func(r *scheduledRequest) bool) []*scheduledRequest {
+	removed := make([]*scheduledRequest, 0)
+	kept := q.data[:0]
+	for _, r := range q.data {
+		if cond(r) {
+			removed = append(removed, r)
+		} else {
+			kept = append(kept, r)
+		}
+	}
+	for i := len(kept); i < len(q.data); i++ {
+		q.data[i] = nil
+	}
+	q.data = kept
+	heap.Init(&q.data)
+	return removed
+}
@@ -0,0 +1,194 @@
+package scheduling
+
+import (
+	"math"
+
+	"github.com/grussorusso/serverledge/internal/function"
+)
+
+// FunctionQueues keeps a queue for each function, so that requests for a
+// function lacking capacity do not block requests for other functions.
+// If prioritized, requests are served by service class first, across all
+// the functions, guaranteeing as PriorityQueue that at least a fraction
+// lowShare of the served requests belongs to the LOW class whenever LOW
+// requests are waiting. Requests of the same class are served in
+// round-robin order among the functions.
+type FunctionQueues struct {
+	capacity    int // total number of requests that can be queued
+	size        int
+	prioritized bool
+	queues      map[string][]*FIFOQueue // per-function queues, indexed by rank
+	lengths     []int                   // number of queued requests of each rank
+	order       []string                // functions with queued requests, in round-robin order
+	next        int                     // position in order of the next function to serve
+	lowWeight   float64                 // credit earned by LOW for each request of other classes
+	lowCredit   float64
+}
+
+// NewFunctionQueues creates per-function queues with the given total
+// capacity.
+func NewFunctionQueues(n int, prioritized bool, lowShare float64) *FunctionQueues {
+	if n < 1 {
+		return nil
+	}
+	ranks := 1
+	if prioritized {
+		ranks = len(classPriority)
+	}
+	return &FunctionQueues{
+		capacity:    n,
+		prioritized: prioritized,
+		queues:      make(map[string][]*FIFOQueue),
+		lengths:     make([]int, ranks),
+		lowWeight:   lowShareWeight(lowShare),
+	}
+}
+
+// rank returns the position of the class of a request in classPriority, or
+// 0 for all requests if they are not prioritized.
+func (q *FunctionQueues) rank(r *scheduledRequest) int {
+	if !q.prioritized {
+		return 0
+	}
+	for i, c := range classPriority {
+		if r.Class == c {
+			return i
+		}
+	}
+	// unknown classes are treated as LOW
+	return len(classPriority) - 1
+}
+
+// Enqueue pushes a request to the back of the queue of its function
+func (q *FunctionQueues) Enqueue(r *scheduledRequest) bool {
+	if q.size >= q.capacity {
+		return false
+	}
+	ranks, ok := q.queues[r.Fun.Name]
+	if !ok {
+		ranks = make([]*FIFOQueue, len(q.lengths))
+		q.queues[r.Fun.Name] = ranks
+		q.order = append(q.order, r.Fun.Name)
+	}
+	rank := q.rank(r)
+	if ranks[rank] == nil {
+		// slots are allocated as requests arrive
+		ranks[rank] = NewFIFOQueue(q.capacity)
+	}
+	ranks[rank].Enqueue(r)
+	q.lengths[rank]++
+	q.size++
+	return true
+}
+
+// Next returns the next request to serve, without removing it. Functions in
+// blocked are skipped. It returns nil if no request can be served.
+func (q *FunctionQueues) Next(blocked map[string]bool) *scheduledRequest {
+	low := len(q.lengths) - 1
+	if q.prioritized && q.lengths[low] > 0 && q.lowCredit >= 1.0 {
+		if r := q.nextOfRank(low, blocked); r != nil {
+			return r
+		}
+	}
+	for rank, l := range q.lengths {
+		if l == 0 {
+			continue
+		}
+		if r := q.nextOfRank(rank, blocked); r != nil {
+			return r
+		}
+	}
+	return nil
+}
+
+// nextOfRank returns the first request of the given rank, visiting the
+// functions in round-robin order.
+func (q *FunctionQueues) nextOfRank(rank int, blocked map[string]bool) *scheduledRequest {
+	for i := range q.order {
+		name := q.order[(q.next+i)%len(q.order)]
+		if blocked[name] {
+			continue
+		}
+		if fq := q.queues[name][rank]; fq != nil && fq.Len() > 0 {
+			return fq.Front()
+		}
+	}
+	return nil
+}
+
+// Remove removes a request returned by Next. The next turn goes to the
+// function following the one of the request.
+func (q *FunctionQueues) Remove(r *scheduledRequest) {
+	name := r.Fun.Name
+	ranks := q.queues[name]
+	rank := q.rank(r)
+	ranks[rank].Dequeue()
+	q.lengths[rank]--
+	q.size--
+
+	if q.prioritized {
+		low := len(q.lengths) - 1
+		if rank == low {
+			q.lowCredit = math.Max(q.lowCredit-1.0, 0.0)
+		} else if q.lengths[low] > 0 {
+			// LOW requests are waiting: they earn a share of the service
+			q.lowCredit += q.lowWeight
+		}
+	}
+
+	pos := 0
+	for q.order[pos] != name {
+		pos++
+	}
+	q.next = pos + 1
+	if q.FunctionLen(name) == 0 {
+		// queues becoming empty are discarded
+		delete(q.queues, name)
+		q.order = append(q.order[:pos], q.order[pos+1:]...)
+		q.next = pos
+	}
+	if q.next >= len(q.order) {
+		q.next = 0
+	}
+}
+
+// Len returns the number of queued requests
+func (q *FunctionQueues) Len() int {
+	return q.size
+}
+
+// FunctionLen returns the number of queued requests for a function
+func (q *FunctionQueues) FunctionLen(name string) int {
+	l := 0
+	for _, fq := range q.queues[name] {
+		if fq != nil {
+			l += fq.Len()
+		}
+	}
+	return l
+}
+
+// LenByFunction returns the number of queued requests for each function
+func (q *FunctionQueues) LenByFunction() map[string]int {
+	lengths := make(map[string]int)
+	for name := range q.queues {
+		lengths[name] = q.FunctionLen(name)
+	}
+	return lengths
+}
+
+// LenByClass returns the number of queued requests for each service class
+func (q *FunctionQueues) LenByClass() map[function.ServiceClass]int {
+	lengths := make(map[function.ServiceClass]int)
+	for _, ranks := range q.queues {
+		for _, fq := range ranks {
+			if fq == nil {
+				continue
+			}
+			for c, l := range fq.LenByClass() {
+				lengths[c] += l
+			}
+		}
+	}
+	return lengths
+}
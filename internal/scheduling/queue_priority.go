@@ -0,0 +1,129 @@
+package scheduling
+
+import (
+	"math"
+	"sync"
+
+	"github.com/grussorusso/serverledge/internal/function"
+)
+
+// classPriority lists service classes from the highest to the lowest priority
+var classPriority = []function.ServiceClass{function.HIGH_PERFORMANCE, function.HIGH_AVAILABILITY, function.LOW}
+
+// PriorityQueue serves requests of higher service classes first, while
+// guaranteeing that at least a fraction lowShare of the dequeued requests
+// belongs to the LOW class whenever LOW requests are waiting.
+type PriorityQueue struct {
+	sync.Mutex
+	classes   map[function.ServiceClass]*FIFOQueue
+	capacity  int
+	size      int
+	lowWeight float64 // credit earned by LOW for each request of other classes
+	lowCredit float64
+}
+
+// lowShareWeight returns the credit earned by LOW requests for each request
+// of other classes served, so that LOW requests get a fraction lowShare of
+// the service.
+func lowShareWeight(lowShare float64) float64 {
+	if lowShare <= 0.0 {
+		return 0.0
+	} else if lowShare >= 1.0 {
+		return math.Inf(1)
+	}
+	return lowShare / (1.0 - lowShare)
+}
+
+// NewPriorityQueue creates a queue with the given total capacity
+func NewPriorityQueue(n int, lowShare float64) *PriorityQueue {
+	if n < 1 {
+		return nil
+	}
+	q := &PriorityQueue{
+		classes:   make(map[function.ServiceClass]*FIFOQueue),
+		capacity:  n,
+		lowWeight: lowShareWeight(lowShare),
+	}
+	for _, c := range classPriority {
+		q.classes[c] = NewFIFOQueue(n)
+	}
+	return q
+}
+
+func (q *PriorityQueue) classQueue(c function.ServiceClass) *FIFOQueue {
+	if cq, ok := q.classes[c]; ok {
+		return cq
+	}
+	// unknown classes are treated as LOW
+	return q.classes[function.LOW]
+}
+
+// nextClass returns the sub-queue to be served next, if any
+func (q *PriorityQueue) nextClass() *FIFOQueue {
+	low := q.classes[function.LOW]
+	if low.Len() > 0 && q.lowCredit >= 1.0 {
+		return low
+	}
+	for _, c := range classPriority {
+		if q.classes[c].Len() > 0 {
+			return q.classes[c]
+		}
+	}
+	return nil
+}
+
+// Enqueue pushes an element to the back of the sub-queue of its class
+func (q *PriorityQueue) Enqueue(r *scheduledRequest) bool {
+	if q.size >= q.capacity {
+		return false
+	}
+	if !q.classQueue(r.Class).Enqueue(r) {
+		return false
+	}
+	q.size++
+	return true
+}
+
+// Dequeue fetches the next element to serve
+func (q *PriorityQueue) Dequeue() *scheduledRequest {
+	next := q.nextClass()
+	if next == nil {
+		return nil
+	}
+
+	low := q.classes[function.LOW]
+	if next == low {
+		q.lowCredit -= 1.0
+		if q.lowCredit < 0.0 {
+			q.lowCredit = 0.0
+		}
+	} else if low.Len() > 0 {
+		// LOW requests are waiting: they earn a share of the service
+		q.lowCredit += q.lowWeight
+	}
+
+	q.size--
+	return next.Dequeue()
+}
+
+func (q *PriorityQueue) Front() *scheduledRequest {
+	next := q.nextClass()
+	if next == nil {
+		return nil
+	}
+	return next.Front()
+}
+
+// Len returns the current length of the queue
+func (q *PriorityQueue) Len() int {
+	return q.size
+}
+
+// LenByClass returns the current length of the queue for each service class
+func (q *PriorityQueue) LenByClass() map[function.ServiceClass]int {
+	lengths := make(map[function.ServiceClass]int)
+	for c, cq := range q.classes {
+		lengths[c] = cq.Len()
+	}
+	return lengths
+}
@@ -3,6 +3,7 @@ package scheduling
 import (
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/grussorusso/serverledge/internal/function"
 )
@@ -19,3 +20,232 @@ func TestQueuet(t *testing.T) {
 	q.Enqueue(r1)
 	fmt.Printf("Size = %d\n", q.Len())
 }
+
+func newTestRequest(class function.ServiceClass) *scheduledRequest {
+	f := function.Function{Name: "Function1"}
+	rq := &function.Request{Fun: &f, RequestQoS: function.RequestQoS{Class: class}}
+	return &scheduledRequest{Request: rq}
+}
+
+func TestPriorityQueue(t *testing.T) {
+	q := NewPriorityQueue(4, 0.0)
+	q.Enqueue(newTestRequest(function.LOW))
+	q.Enqueue(newTestRequest(function.HIGH_AVAILABILITY))
+	q.Enqueue(newTestRequest(function.HIGH_PERFORMANCE))
+	q.Enqueue(newTestRequest(function.HIGH_PERFORMANCE))
+	if q.Enqueue(newTestRequest(function.LOW)) {
+		t.Fatalf("enqueued beyond capacity")
+	}
+
+	expected := []function.ServiceClass{function.HIGH_PERFORMANCE, function.HIGH_PERFORMANCE,
+		function.HIGH_AVAILABILITY, function.LOW}
+	for i, c := range expected {
+		if q.Front() == nil || q.Front().Class != c {
+			t.Fatalf("front %d: expected class %v", i, c)
+		}
+		if r := q.Dequeue(); r.Class != c {
+			t.Fatalf("dequeue %d: expected class %v, got %v", i, c, r.Class)
+		}
+	}
+	if q.Len() != 0 {
+		t.Fatalf("expected empty queue, got length %d", q.Len())
+	}
+}
+
+func TestPriorityQueueLowShare(t *testing.T) {
+	q := NewPriorityQueue(1000, 0.25)
+	for i := 0; i < 100; i++ {
+		q.Enqueue(newTestRequest(function.HIGH_PERFORMANCE))
+		q.Enqueue(newTestRequest(function.LOW))
+	}
+
+	lowServed := 0
+	for i := 0; i < 100; i++ {
+		if q.Dequeue().Class == function.LOW {
+			lowServed++
+		}
+	}
+	if lowServed < 24 || lowServed > 26 {
+		t.Fatalf("expected ~25 LOW requests out of 100, got %d", lowServed)
+	}
+	if l := q.LenByClass()[function.LOW]; l != 100-lowServed {
+		t.Fatalf("unexpected LOW queue length: %d", l)
+	}
+}
+
+func TestEDFQueue(t *testing.T) {
+	now := time.Now()
+	newRequest := func(arrival time.Time, maxRespT float64) *scheduledRequest {
+		r := newTestRequest(function.LOW)
+		r.Arrival = arrival
+		r.MaxRespT = maxRespT
+		return r
+	}
+
+	noDeadline := newRequest(now, -1.0)
+	late := newRequest(now, 2.0)
+	early := newRequest(now.Add(time.Second), 0.5)
+
+	q := NewEDFQueue(3)
+	q.Enqueue(noDeadline)
+	q.Enqueue(late)
+	q.Enqueue(early)
+
+	for i, expected := range []*scheduledRequest{early, late, noDeadline} {
+		if r := q.Dequeue(); r != expected {
+			t.Fatalf("dequeue %d: unexpected request (MaxRespT=%f)", i, r.MaxRespT)
+		}
+	}
+
+	q.Enqueue(noDeadline)
+	q.Enqueue(late)
+	removed := q.RemoveIf(func(r *scheduledRequest) bool { return r.MaxRespT > 0.0 })
+	if len(removed) != 1 || removed[0] != late || q.Len() != 1 || q.Front() != noDeadline {
+		t.Fatalf("unexpected queue content after RemoveIf")
+	}
+}
+
+func TestFIFOQueueGrowth(t *testing.T) {
+	q := NewFIFOQueue(100)
+	if len(q.data) != initialFIFOSlots {
+		t.Fatalf("%d slots allocated upfront", len(q.data))
+	}
+
+	requests := make([]*scheduledRequest, 110)
+	for i := range requests {
+		requests[i] = newTestRequest(function.LOW)
+	}
+	// the queue wraps around before growing
+	for i := 0; i < 10; i++ {
+		q.Enqueue(requests[i])
+	}
+	for i := 0; i < 10; i++ {
+		q.Dequeue()
+	}
+	for i := 10; i < 110; i++ {
+		if !q.Enqueue(requests[i]) {
+			t.Fatalf("enqueue %d failed", i)
+		}
+	}
+	if q.Enqueue(newTestRequest(function.LOW)) {
+		t.Fatalf("enqueued beyond capacity")
+	}
+	for i := 10; i < 110; i++ {
+		if q.Dequeue() != requests[i] {
+			t.Fatalf("dequeue %d: unexpected request", i)
+		}
+	}
+	if q.Len() != 0 {
+		t.Fatalf("expected empty queue, got length %d", q.Len())
+	}
+}
+
+func newFunctionRequest(funcName string, class function.ServiceClass) *scheduledRequest {
+	f := function.Function{Name: funcName}
+	rq := &function.Request{Fun: &f, RequestQoS: function.RequestQoS{Class: class}}
+	return &scheduledRequest{Request: rq}
+}
+
+// drain removes the requests from q in the order they are served.
+func drain(q *FunctionQueues, blocked map[string]bool) []*scheduledRequest {
+	served := make([]*scheduledRequest, 0)
+	for r := q.Next(blocked); r != nil; r = q.Next(blocked) {
+		q.Remove(r)
+		served = append(served, r)
+	}
+	return served
+}
+
+func expectServed(t *testing.T, served []*scheduledRequest, expected ...*scheduledRequest) {
+	t.Helper()
+	if len(served) != len(expected) {
+		t.Fatalf("%d requests served, expected %d", len(served), len(expected))
+	}
+	for i := range expected {
+		if served[i] != expected[i] {
+			t.Fatalf("request %d: served %s/%v, expected %s/%v", i,
+				served[i].Fun.Name, served[i].Class, expected[i].Fun.Name, expected[i].Class)
+		}
+	}
+}
+
+func TestFunctionQueuesRoundRobin(t *testing.T) {
+	q := NewFunctionQueues(6, false, 0.0)
+	a1 := newFunctionRequest("a", function.LOW)
+	a2 := newFunctionRequest("a", function.HIGH_PERFORMANCE)
+	a3 := newFunctionRequest("a", function.LOW)
+	b1 := newFunctionRequest("b", function.LOW)
+	b2 := newFunctionRequest("b", function.LOW)
+	c1 := newFunctionRequest("c", function.HIGH_PERFORMANCE)
+	for _, r := range []*scheduledRequest{a1, a2, a3, b1, b2, c1} {
+		q.Enqueue(r)
+	}
+	if q.Enqueue(newFunctionRequest("d", function.LOW)) {
+		t.Fatalf("enqueued beyond capacity")
+	}
+	if l := q.LenByFunction(); l["a"] != 3 || l["b"] != 2 || l["c"] != 1 {
+		t.Fatalf("unexpected lengths: %v", l)
+	}
+
+	// classes are ignored without prioritization
+	expectServed(t, drain(q, nil), a1, b1, c1, a2, b2, a3)
+	if q.Len() != 0 || len(q.LenByFunction()) != 0 {
+		t.Fatalf("queues not empty after draining")
+	}
+}
+
+func TestFunctionQueuesBlocked(t *testing.T) {
+	q := NewFunctionQueues(10, false, 0.0)
+	a1 := newFunctionRequest("a", function.LOW)
+	b1 := newFunctionRequest("b", function.LOW)
+	b2 := newFunctionRequest("b", function.LOW)
+	q.Enqueue(a1)
+	q.Enqueue(b1)
+	q.Enqueue(b2)
+
+	// a function lacking capacity does not block the others
+	expectServed(t, drain(q, map[string]bool{"a": true}), b1, b2)
+	expectServed(t, drain(q, nil), a1)
+}
+
+func TestFunctionQueuesClassFirst(t *testing.T) {
+	q := NewFunctionQueues(10, true, 0.0)
+	a1 := newFunctionRequest("a", function.LOW)
+	a2 := newFunctionRequest("a", function.LOW)
+	b1 := newFunctionRequest("b", function.HIGH_PERFORMANCE)
+	c1 := newFunctionRequest("c", function.HIGH_PERFORMANCE)
+	b2 := newFunctionRequest("b", function.HIGH_PERFORMANCE)
+	c2 := newFunctionRequest("c", function.LOW)
+	d1 := newFunctionRequest("d", function.HIGH_AVAILABILITY)
+	for _, r := range []*scheduledRequest{a1, a2, b1, c1, b2, c2, d1} {
+		q.Enqueue(r)
+	}
+	if l := q.LenByClass(); l[function.LOW] != 3 || l[function.HIGH_PERFORMANCE] != 3 || l[function.HIGH_AVAILABILITY] != 1 {
+		t.Fatalf("unexpected lengths: %v", l)
+	}
+
+	// higher classes first, whatever the function, then round-robin
+	// among the functions within each class
+	expectServed(t, drain(q, nil), b1, c1, b2, d1, a1, c2, a2)
+}
+
+func TestFunctionQueuesLowShare(t *testing.T) {
+	q := NewFunctionQueues(1000, true, 0.25)
+	for i := 0; i < 100; i++ {
+		q.Enqueue(newFunctionRequest("a", function.HIGH_PERFORMANCE))
+		q.Enqueue(newFunctionRequest("b", function.HIGH_PERFORMANCE))
+		q.Enqueue(newFunctionRequest("c", function.LOW))
+	}
+
+	lowServed := 0
+	for i := 0; i < 100; i++ {
+		r := q.Next(nil)
+		q.Remove(r)
+		if r.Class == function.LOW {
+			lowServed++
+		}
+	}
+	if lowServed < 24 || lowServed > 26 {
+		t.Fatalf("expected ~25 LOW requests out of 100, got %d", lowServed)
+	}
+}
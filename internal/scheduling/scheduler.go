@@ -1,6 +1,7 @@
 package scheduling
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log"
@@ -8,6 +9,7 @@ import (
 	"runtime"
 	"time"
 
+	"github.com/grussorusso/serverledge/internal/clock"
 	"github.com/grussorusso/serverledge/internal/metrics"
 
 	"github.com/grussorusso/serverledge/internal/node"
@@ -22,10 +24,18 @@ var requests chan *scheduledRequest
 var completions chan *completionNotification
 var remoteServerUrl string
 var offloadingClient *http.Client
+var policy Policy
+
+var DeadlineMissedErr = errors.New("the request deadline cannot be met")
+var TimeoutErr = errors.New("the invocation timed out")
+
+// closed when the scheduler is ready to accept requests
+var started = make(chan struct{})
 
 func Run(p Policy) {
-	requests = make(chan *scheduledRequest, 500)
-	completions = make(chan *completionNotification, 500)
+	policy = p
+
+	initIntake()
 
 	// initialize Resources
 	availableCores := runtime.NumCPU()
@@ -34,11 +44,20 @@ func Run(p Policy) {
 	node.Resources.ContainerPools = make(map[string]*node.ContainerPool)
 	log.Printf("Current resources: %v\n", &node.Resources)
 
-	container.InitDockerContainerFactory()
+	container.InitContainerFactory()
+
+	// terminated containers are removed from the pools
+	node.StartHealthMonitor()
+
+	// containers left by a previous run are adopted or destroyed
+	node.ReconcileContainers()
 
 	//janitor periodically remove expired warm container
 	node.GetJanitorInstance()
 
+	// autoscaler prewarms containers based on forecast arrivals (if enabled)
+	node.StartAutoscaler()
+
 	tr := &http.Transport{
 		MaxIdleConns:        2500,
 		MaxIdleConnsPerHost: 2500,
@@ -53,75 +72,213 @@ func Run(p Policy) {
 	remoteServerUrl = config.GetString(config.CLOUD_URL, "") //this is unused!
 
 	log.Println("Scheduler started.")
+	close(started)
 
 	var r *scheduledRequest
 	var c *completionNotification
 	for {
 		select {
 		case r = <-requests:
+			if isCancelled(r) {
+				// the client is not waiting anymore
+				dropRequest(r)
+				continue
+			}
+			node.RecordArrival(r.Fun)
 			go p.OnArrival(r)
 		case c = <-completions:
-			node.ReleaseResources(c.contID, c.fun)
-			p.OnCompletion(c.fun, c.executionReport)
-
-			if metrics.Enabled && c.executionReport != nil {
-				metrics.AddCompletedInvocation(c.fun.Name)
-				if c.executionReport.SchedAction != SCHED_ACTION_OFFLOAD {
-					metrics.AddFunctionDurationValue(c.fun.Name, c.executionReport.Duration)
-				}
+			handleCompletion(p, c)
+		case <-completionBacklog.ready:
+			for _, c = range takeCompletionBacklog() {
+				handleCompletion(p, c)
 			}
 		}
 	}
 
 }
 
+// WaitStarted blocks until the scheduler is ready to accept requests.
+func WaitStarted() {
+	<-started
+}
+
+func handleCompletion(p Policy, c *completionNotification) {
+	if c.contID != "" {
+		// local execution
+		if c.executionReport != nil {
+			node.ObserveExecution(c.fun, c.instances, c.executionReport.Duration)
+			if !c.executionReport.IsWarmStart {
+				node.ObserveColdStart(c.fun, c.executionReport.InitTime)
+			}
+		}
+		node.ReleaseResources(c.contID, c.fun)
+	}
+	p.OnCompletion(c.fun, c.executionReport)
+
+	if metrics.Enabled && c.executionReport != nil {
+		metrics.AddCompletedInvocation(c.fun.Name)
+		if !isOffloaded(c.executionReport) {
+			metrics.AddFunctionDurationValue(c.fun.Name, c.executionReport.Duration)
+		}
+	}
+}
+
+// GetQueueLengths returns the number of requests queued by the scheduling
+// policy for each service class, or nil if the policy does not queue requests.
+func GetQueueLengths() map[string]int {
+	if qr, ok := policy.(QueueReporter); ok {
+		return qr.QueueLengths()
+	}
+	return nil
+}
+
+// isCancelled returns true if the request timed out or its client went away
+func isCancelled(r *scheduledRequest) bool {
+	return r.Ctx.Err() != nil
+}
+
+// ctxError maps the error of a done context to the error returned to clients
+func ctxError(ctx context.Context) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return TimeoutErr
+	}
+	return ctx.Err()
+}
+
+// waitForDecision waits for the scheduling decision about r, unless the
+// request context is done before. It returns OverloadedErr without waiting
+// if the scheduler intake is full.
+func waitForDecision(r *scheduledRequest) (schedDecision, error) {
+	if err := admit(r); err != nil {
+		return schedDecision{}, err
+	}
+
+	select {
+	case decision, ok := <-r.decisionChannel:
+		if !ok {
+			return decision, fmt.Errorf("could not schedule the request")
+		}
+		return decision, nil
+	case <-r.Ctx.Done():
+		// the decision will be taken anyway: make sure that the
+		// possibly acquired container is released
+		go discardDecision(r)
+		return schedDecision{}, ctxError(r.Ctx)
+	}
+}
+
+// discardDecision waits for a decision that nobody is going to execute and
+// releases the resources possibly acquired for it.
+func discardDecision(r *scheduledRequest) {
+	decision, ok := <-r.decisionChannel
+	if ok && decision.action == EXEC_LOCAL {
+		notifyCompletion(&completionNotification{fun: r.Fun, contID: decision.contID, executionReport: nil})
+	}
+}
+
+// GetFunctionQueueLengths returns the number of requests queued by the
+// scheduling policy for each function, or nil if the policy does not keep
+// per-function queues.
+func GetFunctionQueueLengths() map[string]int {
+	if qr, ok := policy.(FunctionQueueReporter); ok {
+		return qr.FunctionQueueLengths()
+	}
+	return nil
+}
+
 // SubmitRequest submits a newly arrived request for scheduling and execution
 func SubmitRequest(r *function.Request) (function.ExecutionReport, error) {
+	if r.Ctx == nil {
+		r.Ctx = context.Background()
+	}
+	if !r.ConcurrencySlotHeld && needsConcurrencySlot(r.Fun) {
+		acquired, err := acquireConcurrencySlot(r.Fun)
+		if err != nil {
+			return function.ExecutionReport{Result: "Throttled", SchedAction: "DROP"}, err
+		}
+		if acquired {
+			defer releaseConcurrencySlot(r.Fun)
+		}
+	}
 	schedRequest := scheduledRequest{
 		Request:         r,
 		decisionChannel: make(chan schedDecision, 1)}
 
-	requests <- &schedRequest
-
 	// wait on channel for scheduling action
-	schedDecision, ok := <-schedRequest.decisionChannel
-	if !ok {
-		return function.ExecutionReport{}, fmt.Errorf("could not schedule the request")
+	schedDecision, err := waitForDecision(&schedRequest)
+	if errors.Is(err, TimeoutErr) {
+		return function.ExecutionReport{TimedOut: true, ResponseTime: clock.Now().Sub(r.Arrival).Seconds()}, err
+	} else if errors.Is(err, OverloadedErr) {
+		return function.ExecutionReport{Result: "Overloaded", SchedAction: "DROP"}, err
+	} else if err != nil {
+		return function.ExecutionReport{}, err
 	}
 	//log.Printf("[%s] Scheduling decision: %v", r, schedDecision)
 
 	if schedDecision.action == DROP {
 		log.Printf("[%s] Dropping request", r)
-		return function.ExecutionReport{
-			Result:      "Dropped",
-			SchedAction: "DROP",
-		}, node.OutOfResourcesErr
+		report := function.ExecutionReport{
+			Result:         "Dropped",
+			SchedAction:    "DROP",
+			DeadlineMissed: schedDecision.deadlineMissed,
+		}
+		if schedDecision.deadlineMissed {
+			return report, DeadlineMissedErr
+		}
+		return report, node.OutOfResourcesErr
 
 	} else if schedDecision.action == EXEC_REMOTE {
 		log.Printf("Offloading request")
-		return Offload(r, schedDecision.remoteHost)
+		report, err := Offload(r, schedDecision.remoteHost)
+		if err != nil {
+			return report, err
+		}
+		if schedDecision.toCloud {
+			report.SchedAction = SCHED_ACTION_CLOUD_OFFLOAD
+		}
+		// notify scheduler, so that the policy can learn about offloading
+		notifyCompletion(&completionNotification{fun: r.Fun, executionReport: &report})
+		return report, nil
 	} else {
-		return Execute(schedDecision.contID, &schedRequest, schedDecision.useWarm)
+		return Execute(schedDecision.contID, &schedRequest, schedDecision.useWarm, schedDecision.instances)
 	}
 }
 
 // SubmitAsyncRequest submits a newly arrived async request for scheduling and execution
 func SubmitAsyncRequest(r *function.Request) {
+	if r.Ctx == nil {
+		r.Ctx = context.Background()
+	}
+	if !r.ConcurrencySlotHeld && needsConcurrencySlot(r.Fun) {
+		acquired, err := acquireConcurrencySlot(r.Fun)
+		if err != nil {
+			publishAsyncResponse(r.ReqId, function.Response{Success: false,
+				ExecutionReport: function.ExecutionReport{Result: "Throttled", SchedAction: "DROP"}})
+			return
+		}
+		if acquired {
+			defer releaseConcurrencySlot(r.Fun)
+		}
+	}
 	schedRequest := scheduledRequest{
 		Request:         r,
 		decisionChannel: make(chan schedDecision, 1)}
-	requests <- &schedRequest
 
 	// wait on channel for scheduling action
-	schedDecision, ok := <-schedRequest.decisionChannel
-	if !ok {
-		publishAsyncResponse(r.ReqId, function.Response{Success: false})
+	schedDecision, err := waitForDecision(&schedRequest)
+	if errors.Is(err, OverloadedErr) {
+		publishAsyncResponse(r.ReqId, function.Response{Success: false,
+			ExecutionReport: function.ExecutionReport{Result: "Overloaded", SchedAction: "DROP"}})
+		return
+	} else if err != nil {
+		publishAsyncResponse(r.ReqId, function.Response{Success: false,
+			ExecutionReport: function.ExecutionReport{TimedOut: errors.Is(err, TimeoutErr)}})
 		return
 	}
 
-	var err error
 	if schedDecision.action == DROP {
-		publishAsyncResponse(r.ReqId, function.Response{Success: false})
+		publishAsyncResponse(r.ReqId, function.Response{Success: false,
+			ExecutionReport: function.ExecutionReport{DeadlineMissed: schedDecision.deadlineMissed}})
 	} else if schedDecision.action == EXEC_REMOTE {
 		log.Printf("Offloading request")
 		err = OffloadAsync(r, schedDecision.remoteHost)
@@ -129,9 +286,10 @@ func SubmitAsyncRequest(r *function.Request) {
 			publishAsyncResponse(r.ReqId, function.Response{Success: false})
 		}
 	} else {
-		report, err := Execute(schedDecision.contID, &schedRequest, schedDecision.useWarm)
+		report, err := Execute(schedDecision.contID, &schedRequest, schedDecision.useWarm, schedDecision.instances)
 		if err != nil {
-			publishAsyncResponse(r.ReqId, function.Response{Success: false})
+			publishAsyncResponse(r.ReqId, function.Response{Success: false, ExecutionReport: report})
+			return
 		}
 		publishAsyncResponse(r.ReqId, function.Response{Success: true, ExecutionReport: report})
 	}
@@ -145,7 +303,7 @@ func handleColdStart(r *scheduledRequest) (isSuccess bool) {
 		log.Printf("Cold start failed: %v\n", err)
 		return false
 	} else { // cold start
-		execLocally(r, newContainer, false)
+		execLocally(r, newContainer, false, 1)
 		return true
 	}
 }
@@ -154,8 +312,12 @@ func dropRequest(r *scheduledRequest) {
 	r.decisionChannel <- schedDecision{action: DROP}
 }
 
-func execLocally(r *scheduledRequest, c container.ContainerID, warmStart bool) {
-	decision := schedDecision{action: EXEC_LOCAL, contID: c, useWarm: warmStart}
+func dropRequestMissingDeadline(r *scheduledRequest) {
+	r.decisionChannel <- schedDecision{action: DROP, deadlineMissed: true}
+}
+
+func execLocally(r *scheduledRequest, c container.ContainerID, warmStart bool, instances int64) {
+	decision := schedDecision{action: EXEC_LOCAL, contID: c, useWarm: warmStart, instances: instances}
 	r.decisionChannel <- decision
 }
 
@@ -170,7 +332,24 @@ func handleOffload(r *scheduledRequest, serverHost string) {
 
 func handleCloudOffload(r *scheduledRequest) {
 	cloudAddress := config.GetString(config.CLOUD_URL, "")
-	handleOffload(r, cloudAddress)
+	r.CanDoOffloading = false // the next server can't offload this request
+	r.decisionChannel <- schedDecision{
+		action:     EXEC_REMOTE,
+		contID:     "",
+		remoteHost: cloudAddress,
+		toCloud:    true,
+	}
+}
+
+// tryLocalExecution serves the request locally, on a running, warm or new
+// container, if there are enough resources.
+func tryLocalExecution(r *scheduledRequest) bool {
+	containerID, instances, err := node.AcquireRunningContainer(r.Fun)
+	if err == nil {
+		execLocally(r, containerID, true, instances)
+		return true
+	}
+	return handleUnavailableRunningContainer(r)
 }
 
 func handleUnavailableRunningContainer(r *scheduledRequest) (isSuccess bool) {
@@ -178,7 +357,7 @@ func handleUnavailableRunningContainer(r *scheduledRequest) (isSuccess bool) {
 	// If there are no running containers executing functions, take one from the warm pool (if any)
 	containerID, err := node.AcquireWarmContainer(r.Fun)
 	if err == nil {
-		execLocally(r, containerID, true)
+		execLocally(r, containerID, true, 1)
 		return true
 	}
 
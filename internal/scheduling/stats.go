@@ -0,0 +1,95 @@
+package scheduling
+
+import (
+	"sync"
+
+	"github.com/grussorusso/serverledge/internal/function"
+)
+
+// weight of the most recent sample in moving averages
+const statsEWMAWeight = 0.1
+
+// functionStats contains statistics about the executions of a function,
+// learnt by scheduling policies upon completions.
+type functionStats struct {
+	Completions int64
+	ColdStarts  int64
+	Duration    float64 // average execution time (s)
+	InitTime    float64 // average initialization time of cold starts (s)
+	ColdProb    float64 // probability of a cold start for local executions
+
+	EdgeOffloads   int64
+	EdgeRespTime   float64 // average response time of requests offloaded to Edge nodes (s)
+	CloudOffloads  int64
+	CloudRespTime  float64 // average response time of requests offloaded to the Cloud (s)
+	OffloadLatency float64 // average offloading overhead (s)
+}
+
+// statsCollector keeps per-function execution statistics.
+type statsCollector struct {
+	sync.RWMutex
+	functions map[string]*functionStats
+}
+
+func newStatsCollector() *statsCollector {
+	return &statsCollector{functions: make(map[string]*functionStats)}
+}
+
+func ewma(current, sample float64, samples int64) float64 {
+	if samples <= 1 {
+		return sample
+	}
+	return (1.0-statsEWMAWeight)*current + statsEWMAWeight*sample
+}
+
+// update records the outcome of a completed (possibly offloaded) execution
+func (sc *statsCollector) update(fun *function.Function, report *function.ExecutionReport) {
+	if report == nil {
+		return
+	}
+
+	sc.Lock()
+	defer sc.Unlock()
+
+	s, ok := sc.functions[fun.Name]
+	if !ok {
+		s = &functionStats{}
+		sc.functions[fun.Name] = s
+	}
+
+	if isOffloaded(report) {
+		// response time as perceived by this node
+		respTime := report.OffloadLatency + report.InitTime + report.Duration
+		if report.SchedAction == SCHED_ACTION_CLOUD_OFFLOAD {
+			s.CloudOffloads++
+			s.CloudRespTime = ewma(s.CloudRespTime, respTime, s.CloudOffloads)
+		} else {
+			s.EdgeOffloads++
+			s.EdgeRespTime = ewma(s.EdgeRespTime, respTime, s.EdgeOffloads)
+		}
+		s.OffloadLatency = ewma(s.OffloadLatency, report.OffloadLatency, s.EdgeOffloads+s.CloudOffloads)
+		return
+	}
+
+	s.Completions++
+	s.Duration = ewma(s.Duration, report.Duration, s.Completions)
+	coldStart := 0.0
+	if !report.IsWarmStart {
+		coldStart = 1.0
+		s.ColdStarts++
+		s.InitTime = ewma(s.InitTime, report.InitTime, s.ColdStarts)
+	}
+	s.ColdProb = ewma(s.ColdProb, coldStart, s.Completions)
+}
+
+// get returns a copy of the statistics of a function
+func (sc *statsCollector) get(fun *function.Function) (functionStats, bool) {
+	sc.RLock()
+	defer sc.RUnlock()
+
+	s, ok := sc.functions[fun.Name]
+	if !ok {
+		return functionStats{}, false
+	}
+	return *s, true
+}
@@ -14,6 +14,7 @@ type scheduledRequest struct {
 type completionNotification struct {
 	fun             *function.Function
 	contID          container.ContainerID
+	instances       int64 // instances sharing the container when the execution started
 	executionReport *function.ExecutionReport
 }
 
@@ -24,7 +25,11 @@ type schedDecision struct {
 	action     action
 	contID     container.ContainerID
 	remoteHost string
+	toCloud    bool // remoteHost is a Cloud node
 	useWarm    bool
+	instances  int64 // instances sharing the container, including this one
+	// set when a request is dropped because its deadline cannot be met
+	deadlineMissed bool
 }
 
 type action int64
@@ -0,0 +1,251 @@
+package simulation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/grussorusso/serverledge/internal/clock"
+	"github.com/grussorusso/serverledge/internal/container"
+	"github.com/grussorusso/serverledge/internal/executor"
+)
+
+// Factory is a container.Factory whose containers only exist in memory.
+// Their executors sleep, according to the clock of the node, for the
+// duration given by the model of the function.
+type Factory struct {
+	sync.Mutex
+	rng        *rand.Rand
+	models     map[string]FunctionModel // indexed by function name
+	containers map[container.ContainerID]*simContainer
+	created    int
+}
+
+type simContainer struct {
+	info   container.ContainerInfo
+	model  FunctionModel
+	active int // running invocations
+}
+
+// NewFactory returns a simulated factory using the given models.
+func NewFactory(models map[string]FunctionModel, seed int64) *Factory {
+	return &Factory{
+		rng:        rand.New(rand.NewSource(seed)),
+		models:     models,
+		containers: make(map[container.ContainerID]*simContainer),
+	}
+}
+
+// getContainer returns a container. The factory must be locked.
+func (f *Factory) getContainer(contID container.ContainerID) (*simContainer, error) {
+	c, ok := f.containers[contID]
+	if !ok {
+		return nil, fmt.Errorf("no such container: %s", contID)
+	}
+	return c, nil
+}
+
+func (f *Factory) Create(image string, opts *container.ContainerOptions) (container.ContainerID, error) {
+	f.Lock()
+	defer f.Unlock()
+
+	f.created++
+	contID := fmt.Sprintf("sim-%d", f.created)
+	labels := make(map[string]string)
+	for key, value := range opts.Labels {
+		labels[key] = value
+	}
+	f.containers[contID] = &simContainer{
+		info: container.ContainerInfo{
+			ID:       contID,
+			MemoryMB: opts.MemoryMB,
+			CPUQuota: opts.CPUQuota,
+			Image:    image,
+			Created:  clock.Now(),
+			State:    container.STATE_CREATED,
+			Labels:   labels,
+		},
+		// unknown functions are served instantly
+		model: f.models[labels[container.LABEL_FUNCTION]],
+	}
+	return contID, nil
+}
+
+func (f *Factory) CopyToContainer(contID container.ContainerID, content io.Reader, _ string) error {
+	_, err := io.Copy(io.Discard, content)
+	return err
+}
+
+// Start waits for the cold start time of the container.
+func (f *Factory) Start(contID container.ContainerID) error {
+	f.Lock()
+	c, err := f.getContainer(contID)
+	if err != nil {
+		f.Unlock()
+		return err
+	}
+	coldStart := c.model.ColdStart.Sample(f.rng)
+	f.Unlock()
+
+	clock.Sleep(time.Duration(coldStart * float64(time.Second)))
+
+	f.Lock()
+	defer f.Unlock()
+	c.info.State = container.STATE_RUNNING
+	return nil
+}
+
+func (f *Factory) Destroy(contID container.ContainerID) error {
+	f.Lock()
+	defer f.Unlock()
+	if _, err := f.getContainer(contID); err != nil {
+		return err
+	}
+	delete(f.containers, contID)
+	return nil
+}
+
+func (f *Factory) HasImage(string) bool {
+	return true
+}
+
+func (f *Factory) PullImage(string) error {
+	return nil
+}
+
+func (f *Factory) Inspect(contID container.ContainerID) (*container.ContainerInfo, error) {
+	f.Lock()
+	defer f.Unlock()
+	c, err := f.getContainer(contID)
+	if err != nil {
+		return nil, err
+	}
+	info := c.info
+	return &info, nil
+}
+
+func (f *Factory) setState(contID container.ContainerID, state string) error {
+	f.Lock()
+	defer f.Unlock()
+	c, err := f.getContainer(contID)
+	if err != nil {
+		return err
+	}
+	c.info.State = state
+	return nil
+}
+
+func (f *Factory) Pause(contID container.ContainerID) error {
+	return f.setState(contID, container.STATE_PAUSED)
+}
+
+func (f *Factory) Unpause(contID container.ContainerID) error {
+	return f.setState(contID, container.STATE_RUNNING)
+}
+
+// Events never notifies anything, as simulated containers do not fail.
+func (f *Factory) Events(context.Context) (<-chan container.ContainerEvent, <-chan error) {
+	return make(chan container.ContainerEvent), make(chan error)
+}
+
+// List returns the containers having all the given labels.
+func (f *Factory) List(labels map[string]string) ([]*container.ContainerInfo, error) {
+	f.Lock()
+	defer f.Unlock()
+	infos := make([]*container.ContainerInfo, 0)
+	for _, c := range f.containers {
+		matching := true
+		for key, value := range labels {
+			matching = matching && c.info.Labels[key] == value
+		}
+		if matching {
+			info := c.info
+			infos = append(infos, &info)
+		}
+	}
+	return infos, nil
+}
+
+// ExecutorTransport returns a transport serving the requests to the executor
+// of a container in memory.
+func (f *Factory) ExecutorTransport(info *container.ContainerInfo) http.RoundTripper {
+	return &executorTransport{factory: f, contID: info.ID}
+}
+
+// executorTransport implements the executor API of a simulated container.
+type executorTransport struct {
+	factory *Factory
+	contID  container.ContainerID
+}
+
+func (t *executorTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		_ = req.Body.Close()
+	}
+
+	if req.URL.Path == executor.READINESS_PATH {
+		return newResponse(req, http.StatusOK, nil), nil
+	}
+
+	duration, err := t.factory.beginInvocation(t.contID)
+	if err != nil {
+		return nil, err
+	}
+	defer t.factory.endInvocation(t.contID)
+
+	timer := time.NewTimer(clock.Real(duration))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-req.Context().Done():
+		return nil, req.Context().Err()
+	}
+
+	body, _ := json.Marshal(&executor.InvocationResult{Success: true, Result: fmt.Sprintf("%f", duration.Seconds())})
+	return newResponse(req, http.StatusOK, body), nil
+}
+
+// beginInvocation starts an invocation on a container, and returns its
+// duration.
+func (f *Factory) beginInvocation(contID container.ContainerID) (time.Duration, error) {
+	f.Lock()
+	defer f.Unlock()
+	c, err := f.getContainer(contID)
+	if err != nil {
+		return 0, err
+	}
+	if c.info.State != container.STATE_RUNNING {
+		return 0, fmt.Errorf("container %s is %s", contID, c.info.State)
+	}
+	c.active++
+	duration := c.model.Duration.Sample(f.rng) * c.model.slowdown(c.active)
+	return time.Duration(duration * float64(time.Second)), nil
+}
+
+func (f *Factory) endInvocation(contID container.ContainerID) {
+	f.Lock()
+	defer f.Unlock()
+	if c, ok := f.containers[contID]; ok {
+		c.active--
+	}
+}
+
+func newResponse(req *http.Request, status int, body []byte) *http.Response {
+	return &http.Response{
+		StatusCode:    status,
+		Status:        http.StatusText(status),
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": []string{"application/json"}},
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
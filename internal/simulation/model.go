@@ -0,0 +1,92 @@
+package simulation
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+)
+
+// Supported distributions.
+const (
+	DIST_CONSTANT    = "constant"
+	DIST_EXPONENTIAL = "exponential"
+	DIST_UNIFORM     = "uniform"
+	DIST_LOGNORMAL   = "lognormal"
+)
+
+// Distribution describes a random quantity, such as a duration in seconds.
+type Distribution struct {
+	Type   string  // DIST_CONSTANT (default), DIST_EXPONENTIAL, DIST_UNIFORM or DIST_LOGNORMAL
+	Mean   float64 // all but DIST_UNIFORM
+	StdDev float64 // DIST_LOGNORMAL only
+	Min    float64 // DIST_UNIFORM only
+	Max    float64 // DIST_UNIFORM only
+}
+
+// Validate returns an error if the distribution is not supported.
+func (d *Distribution) Validate() error {
+	switch d.Type {
+	case "", DIST_CONSTANT, DIST_EXPONENTIAL:
+		if d.Mean < 0.0 {
+			return fmt.Errorf("negative mean")
+		}
+	case DIST_UNIFORM:
+		if d.Min < 0.0 || d.Max < d.Min {
+			return fmt.Errorf("invalid interval [%f, %f]", d.Min, d.Max)
+		}
+	case DIST_LOGNORMAL:
+		if d.Mean <= 0.0 || d.StdDev < 0.0 {
+			return fmt.Errorf("the mean must be positive and the std. deviation non-negative")
+		}
+	default:
+		return fmt.Errorf("unknown distribution '%s'", d.Type)
+	}
+	return nil
+}
+
+// Sample draws a value from the distribution.
+func (d *Distribution) Sample(rng *rand.Rand) float64 {
+	switch d.Type {
+	case DIST_EXPONENTIAL:
+		return rng.ExpFloat64() * d.Mean
+	case DIST_UNIFORM:
+		return d.Min + rng.Float64()*(d.Max-d.Min)
+	case DIST_LOGNORMAL:
+		// parameters of the underlying normal distribution
+		sigma2 := math.Log(1.0 + (d.StdDev*d.StdDev)/(d.Mean*d.Mean))
+		mu := math.Log(d.Mean) - sigma2/2.0
+		return math.Exp(mu + math.Sqrt(sigma2)*rng.NormFloat64())
+	default:
+		return d.Mean
+	}
+}
+
+// FunctionModel describes the behaviour of the containers of a function.
+type FunctionModel struct {
+	ColdStart Distribution // time to start a container (s)
+	Duration  Distribution // execution time of an invocation running alone (s)
+	// Slowdown of concurrent invocations in the same container: with n
+	// active invocations, a new one lasts exp(Alpha*(n-1)) times longer
+	// (as fitted by opt_deg.py).
+	Alpha float64
+}
+
+// Validate returns an error if the model is not valid.
+func (m *FunctionModel) Validate() error {
+	if err := m.ColdStart.Validate(); err != nil {
+		return fmt.Errorf("cold start: %v", err)
+	}
+	if err := m.Duration.Validate(); err != nil {
+		return fmt.Errorf("duration: %v", err)
+	}
+	if m.Alpha < 0.0 {
+		return fmt.Errorf("negative slowdown coefficient")
+	}
+	return nil
+}
+
+// slowdown returns the factor by which the duration of an invocation grows
+// with the given number of active invocations in its container.
+func (m *FunctionModel) slowdown(active int) float64 {
+	return math.Exp(m.Alpha * float64(active-1))
+}
@@ -0,0 +1,103 @@
+package simulation
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/grussorusso/serverledge/internal/container"
+	"github.com/grussorusso/serverledge/internal/function"
+)
+
+// MaxSpeedup is the max speedup of simulations. The real time spent by the
+// node (e.g., scheduling requests) is scaled by the speedup as well, biasing
+// the simulated times: beyond this value, the bias would not be negligible
+// even for durations in the order of seconds.
+const MaxSpeedup = 100.0
+
+// Scenario describes the workload of a simulation.
+type Scenario struct {
+	Duration  float64 // simulated seconds during which requests arrive
+	Speedup   float64 // how many times the simulated time is faster than the real one (default: 1, max: MaxSpeedup)
+	Seed      int64   // seed of the random generators
+	Functions []FunctionWorkload
+}
+
+// FunctionWorkload describes the requests for a function and the behaviour
+// of its containers.
+type FunctionWorkload struct {
+	function.Function
+	FunctionModel
+	Rate     float64               // mean arrival rate of requests (Poisson, req/s)
+	Class    function.ServiceClass // service class of requests
+	MaxRespT float64               // max response time requested (s, 0 = none)
+}
+
+// ReadScenario reads a scenario from a JSON file.
+func ReadScenario(fileName string) (*Scenario, error) {
+	content, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	var s Scenario
+	if err := json.Unmarshal(content, &s); err != nil {
+		return nil, fmt.Errorf("could not parse the scenario: %v", err)
+	}
+	return &s, s.Validate()
+}
+
+// Validate returns an error if the scenario cannot be simulated.
+func (s *Scenario) Validate() error {
+	if s.Duration <= 0.0 {
+		return fmt.Errorf("the duration must be positive")
+	}
+	if s.Speedup < 0.0 {
+		return fmt.Errorf("the speedup cannot be negative")
+	}
+	if s.Speedup > MaxSpeedup {
+		return fmt.Errorf("the speedup cannot exceed %.0f", MaxSpeedup)
+	}
+	if len(s.Functions) == 0 {
+		return fmt.Errorf("no functions")
+	}
+	names := make(map[string]bool)
+	for i := range s.Functions {
+		fw := &s.Functions[i]
+		if fw.Name == "" {
+			return fmt.Errorf("function %d has no name", i)
+		}
+		if names[fw.Name] {
+			return fmt.Errorf("function %s is defined twice", fw.Name)
+		}
+		names[fw.Name] = true
+		if fw.Rate <= 0.0 {
+			return fmt.Errorf("function %s: the arrival rate must be positive", fw.Name)
+		}
+		if fw.MemoryMB <= 0 {
+			return fmt.Errorf("function %s: the memory must be positive", fw.Name)
+		}
+		if _, ok := container.RuntimeToInfo[fw.Runtime]; !ok && fw.Runtime != container.CUSTOM_RUNTIME {
+			return fmt.Errorf("function %s: invalid runtime '%s'", fw.Name, fw.Runtime)
+		}
+		if fw.MaxFunctionInstances < 1 {
+			return fmt.Errorf("function %s: invalid number of max instances", fw.Name)
+		}
+		if fw.MaxConcurrency > 0 {
+			// cluster limits need etcd
+			return fmt.Errorf("function %s: cluster concurrency limits are not supported", fw.Name)
+		}
+		if err := fw.FunctionModel.Validate(); err != nil {
+			return fmt.Errorf("function %s: %v", fw.Name, err)
+		}
+	}
+	return nil
+}
+
+// models returns the models of the functions, indexed by name.
+func (s *Scenario) models() map[string]FunctionModel {
+	models := make(map[string]FunctionModel, len(s.Functions))
+	for _, fw := range s.Functions {
+		models[fw.Name] = fw.FunctionModel
+	}
+	return models
+}
@@ -0,0 +1,143 @@
+package simulation
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/grussorusso/serverledge/internal/clock"
+	"github.com/grussorusso/serverledge/internal/container"
+	"github.com/grussorusso/serverledge/internal/function"
+	"github.com/grussorusso/serverledge/internal/node"
+	"github.com/grussorusso/serverledge/internal/scheduling"
+)
+
+// the node can only be started once in a process
+var started bool
+var startedLock sync.Mutex
+
+// outcome of a simulated request
+type outcome struct {
+	record *Record
+	err    error
+}
+
+// Run simulates the scenario on a node using simulated containers and the
+// scheduling policy selected in the configuration. The records of the
+// requests are written to records (if not nil) as JSON lines, in order of
+// completion. Only one simulation can run in a process.
+func Run(s *Scenario, records io.Writer) (*Summary, error) {
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+	startedLock.Lock()
+	if started {
+		startedLock.Unlock()
+		return nil, fmt.Errorf("a simulation has already run in this process")
+	}
+	started = true
+	startedLock.Unlock()
+
+	clock.SetSpeedup(s.Speedup)
+	container.SetFactory(NewFactory(s.models(), s.Seed))
+	go scheduling.Run(scheduling.NewConfiguredPolicy())
+	scheduling.WaitStarted()
+
+	outcomes := make(chan outcome, 1000)
+	summary := newSummary()
+	collected := make(chan error)
+	go func() {
+		collected <- collect(outcomes, summary, records)
+	}()
+
+	var wg sync.WaitGroup
+	start := clock.Now()
+	submitted := 0
+	generateArrivals(s, func(fw *FunctionWorkload, arrival time.Duration) {
+		if wait := arrival - clock.Since(start); wait > 0 {
+			clock.Sleep(wait)
+		}
+		submitted++
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			outcomes <- submit(fw, id, arrival)
+		}(submitted)
+	})
+	wg.Wait()
+	close(outcomes)
+	err := <-collected
+
+	node.ShutdownAllContainers()
+	log.Printf("Simulation completed: %d requests in %v (real time)\n", submitted, clock.Real(clock.Since(start)))
+	return summary, err
+}
+
+// generateArrivals calls arrive for each request of the scenario, in order
+// of arrival time (since the beginning of the simulation). Requests for each
+// function arrive as a Poisson process.
+func generateArrivals(s *Scenario, arrive func(*FunctionWorkload, time.Duration)) {
+	rng := rand.New(rand.NewSource(s.Seed))
+	next := make([]float64, len(s.Functions))
+	for i := range s.Functions {
+		next[i] = rng.ExpFloat64() / s.Functions[i].Rate
+	}
+	for {
+		first := 0
+		for i := range next {
+			if next[i] < next[first] {
+				first = i
+			}
+		}
+		if next[first] > s.Duration {
+			return
+		}
+		arrive(&s.Functions[first], time.Duration(next[first]*float64(time.Second)))
+		next[first] += rng.ExpFloat64() / s.Functions[first].Rate
+	}
+}
+
+// submit submits a request for a function, arriving at the given time of the
+// scenario, and waits for its outcome.
+func submit(fw *FunctionWorkload, id int, arrival time.Duration) outcome {
+	r := &function.Request{
+		ReqId:      fmt.Sprintf("%s-%d", fw.Name, id),
+		Fun:        &fw.Function,
+		Arrival:    clock.Now(),
+		RequestQoS: function.RequestQoS{Class: fw.Class, MaxRespT: fw.MaxRespT},
+		Ctx:        context.Background(),
+	}
+	if timeout := function.EffectiveTimeout(r.Fun, 0.0); timeout > 0.0 {
+		ctx, cancel := context.WithTimeout(r.Ctx, clock.Real(time.Duration(timeout*float64(time.Second))))
+		defer cancel()
+		r.Ctx = ctx
+	}
+
+	report, err := scheduling.SubmitRequest(r)
+	rec := &Record{Function: fw.Name, Arrival: arrival.Seconds(), ExecutionReport: report}
+	if err != nil {
+		rec.Error = err.Error()
+	}
+	return outcome{rec, err}
+}
+
+// collect adds the outcomes to the summary and writes their records.
+func collect(outcomes <-chan outcome, summary *Summary, records io.Writer) error {
+	var encoder *json.Encoder
+	if records != nil {
+		encoder = json.NewEncoder(records)
+	}
+	var err error
+	for o := range outcomes {
+		summary.add(o.record, o.err)
+		if encoder != nil && err == nil {
+			err = encoder.Encode(o.record)
+		}
+	}
+	return err
+}
@@ -0,0 +1,200 @@
+package simulation
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"math"
+	"math/rand"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/grussorusso/serverledge/internal/config"
+	"github.com/grussorusso/serverledge/internal/function"
+	"github.com/spf13/viper"
+)
+
+func TestDistributionSample(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	distributions := []Distribution{
+		{Type: DIST_CONSTANT, Mean: 0.5},
+		{Type: DIST_EXPONENTIAL, Mean: 0.5},
+		{Type: DIST_UNIFORM, Min: 0.25, Max: 0.75},
+		{Type: DIST_LOGNORMAL, Mean: 0.5, StdDev: 0.2},
+	}
+	for _, d := range distributions {
+		if err := d.Validate(); err != nil {
+			t.Fatalf("%s: %v", d.Type, err)
+		}
+		const samples = 100000
+		sum := 0.0
+		for i := 0; i < samples; i++ {
+			sum += d.Sample(rng)
+		}
+		if mean := sum / samples; math.Abs(mean-0.5) > 0.01 {
+			t.Errorf("%s: sample mean %f, expected 0.5", d.Type, mean)
+		}
+	}
+
+	if err := (&Distribution{Type: "pareto"}).Validate(); err == nil {
+		t.Errorf("unknown distribution accepted")
+	}
+}
+
+func TestRun(t *testing.T) {
+	if started {
+		t.Skip("the node can only be started once (e.g., with -count > 1)")
+	}
+	viper.Set(config.POOL_MEMORY_MB, 1024)
+	viper.Set(config.POOL_CPUS, 4.0)
+
+	s := &Scenario{
+		Duration: 60,
+		Speedup:  20,
+		Seed:     1,
+		Functions: []FunctionWorkload{{
+			Function: function.Function{
+				Name:                 "f",
+				Runtime:              "python310",
+				MemoryMB:             128,
+				CPUDemand:            0.5,
+				MaxFunctionInstances: 1,
+			},
+			FunctionModel: FunctionModel{
+				ColdStart: Distribution{Mean: 1.0},
+				Duration:  Distribution{Mean: 0.2},
+			},
+			Rate: 5,
+		}},
+	}
+	var records bytes.Buffer
+	summary, err := Run(s, &records)
+	if err != nil {
+		t.Fatalf("simulation failed: %v", err)
+	}
+
+	total := summary.Total
+	// ~300 expected arrivals
+	if total.Requests < 200 || total.Requests > 400 {
+		t.Fatalf("unexpected number of requests: %d", total.Requests)
+	}
+	if total.Completed+total.Dropped != total.Requests || total.Failed != 0 || total.TimedOut != 0 {
+		t.Fatalf("unexpected outcomes: %+v", total)
+	}
+	// the load (5 req/s for 0.2 s each) needs a few containers only
+	if total.ColdStarts < 1 || total.ColdStarts > total.Completed/10 {
+		t.Fatalf("unexpected number of cold starts: %d", total.ColdStarts)
+	}
+	if p50 := total.Percentile(50); p50 < 0.2 || p50 > 0.4 {
+		t.Fatalf("unexpected median response time: %f", p50)
+	}
+	if p99 := total.Percentile(99); p99 < 1.2 {
+		t.Fatalf("cold starts not reflected in the response time: %f", p99)
+	}
+
+	lines := 0
+	scanner := bufio.NewScanner(&records)
+	for scanner.Scan() {
+		var rec Record
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			t.Fatalf("invalid record: %v", err)
+		}
+		if rec.Function != "f" || rec.Arrival > s.Duration {
+			t.Fatalf("unexpected record: %+v", rec)
+		}
+		lines++
+	}
+	if lines != total.Requests {
+		t.Fatalf("%d records written for %d requests", lines, total.Requests)
+	}
+}
+
+// if set, the test binary simulates the scenario in the given file and
+// prints the digest of its summary, as a single simulation can run in a
+// process
+const envTestScenario = "SERVERLEDGE_TEST_SCENARIO"
+
+// summaryDigest reports the counts of a summary and some percentiles of the
+// response time.
+type summaryDigest struct {
+	Total    Stats
+	P50, P99 float64
+}
+
+func TestMain(m *testing.M) {
+	if fileName := os.Getenv(envTestScenario); fileName != "" {
+		viper.Set(config.POOL_MEMORY_MB, 1024)
+		viper.Set(config.POOL_CPUS, 4.0)
+		log.SetOutput(io.Discard)
+		s, err := ReadScenario(fileName)
+		if err != nil {
+			panic(err)
+		}
+		summary, err := Run(s, nil)
+		if err != nil {
+			panic(err)
+		}
+		total := summary.Total
+		_ = json.NewEncoder(os.Stdout).Encode(&summaryDigest{total, total.Percentile(50), total.Percentile(99)})
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+func TestRunReproducible(t *testing.T) {
+	s := &Scenario{
+		Duration: 20,
+		Speedup:  20,
+		Seed:     3, // no arrival close to the end of the first cold start
+		Functions: []FunctionWorkload{{
+			Function: function.Function{
+				Name:                 "f",
+				Runtime:              "python310",
+				MemoryMB:             128,
+				CPUDemand:            0.1,
+				MaxFunctionInstances: 10,
+			},
+			FunctionModel: FunctionModel{
+				ColdStart: Distribution{Mean: 0.5},
+				Duration:  Distribution{Type: DIST_EXPONENTIAL, Mean: 0.2},
+			},
+			Rate: 2,
+		}},
+	}
+	content, _ := json.Marshal(s)
+	fileName := filepath.Join(t.TempDir(), "scenario.json")
+	if err := os.WriteFile(fileName, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	run := func() *summaryDigest {
+		cmd := exec.Command(os.Args[0])
+		cmd.Env = append(os.Environ(), envTestScenario+"="+fileName)
+		out, err := cmd.Output()
+		if err != nil {
+			t.Fatalf("simulation failed: %v", err)
+		}
+		var digest summaryDigest
+		if err := json.Unmarshal(out, &digest); err != nil {
+			t.Fatalf("invalid summary: %v", err)
+		}
+		return &digest
+	}
+	first, second := run(), run()
+
+	if !reflect.DeepEqual(first.Total, second.Total) {
+		t.Fatalf("different outcomes with the same seed: %+v, %+v", first.Total, second.Total)
+	}
+	// response times are only reproducible within the bias of the clock,
+	// i.e., the real overhead of the node (up to a few milliseconds, e.g.,
+	// with the race detector) times the speedup
+	tolerance := s.Speedup * 0.005
+	if math.Abs(first.P50-second.P50) > tolerance || math.Abs(first.P99-second.P99) > tolerance {
+		t.Fatalf("different response times with the same seed: %+v, %+v", first, second)
+	}
+}
@@ -0,0 +1,113 @@
+package simulation
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/grussorusso/serverledge/internal/function"
+	"github.com/grussorusso/serverledge/internal/node"
+)
+
+// Record reports the outcome of a simulated request.
+type Record struct {
+	Function string
+	Arrival  float64 // seconds since the beginning of the simulation
+	Error    string  `json:",omitempty"`
+	function.ExecutionReport
+}
+
+// Stats summarizes the outcome of a set of requests.
+type Stats struct {
+	Requests        int
+	Completed       int
+	Dropped         int // dropped by the scheduler (e.g., no resources)
+	TimedOut        int
+	Failed          int
+	ColdStarts      int // among completed requests
+	DeadlinesMissed int
+	responseTimes   []float64 // of completed requests
+}
+
+func (s *Stats) add(rec *Record, err error) {
+	s.Requests++
+	if rec.DeadlineMissed {
+		s.DeadlinesMissed++
+	}
+	switch {
+	case err == nil:
+		s.Completed++
+		if !rec.IsWarmStart {
+			s.ColdStarts++
+		}
+		s.responseTimes = append(s.responseTimes, rec.ResponseTime)
+	case rec.SchedAction == "DROP" || errors.Is(err, node.OutOfResourcesErr):
+		s.Dropped++
+	case rec.TimedOut:
+		s.TimedOut++
+	default:
+		s.Failed++
+	}
+}
+
+// Percentile returns the given percentile (in [0, 100]) of the response time
+// of completed requests, or NaN if no request completed.
+func (s *Stats) Percentile(p float64) float64 {
+	if len(s.responseTimes) == 0 {
+		return math.NaN()
+	}
+	if !sort.Float64sAreSorted(s.responseTimes) {
+		sort.Float64s(s.responseTimes)
+	}
+	// nearest-rank method
+	rank := int(math.Ceil(p / 100.0 * float64(len(s.responseTimes))))
+	if rank < 1 {
+		rank = 1
+	}
+	return s.responseTimes[rank-1]
+}
+
+// Summary summarizes the outcome of a simulation.
+type Summary struct {
+	Total     Stats
+	Functions map[string]*Stats
+}
+
+func newSummary() *Summary {
+	return &Summary{Functions: make(map[string]*Stats)}
+}
+
+func (s *Summary) add(rec *Record, err error) {
+	s.Total.add(rec, err)
+	fs, ok := s.Functions[rec.Function]
+	if !ok {
+		fs = &Stats{}
+		s.Functions[rec.Function] = fs
+	}
+	fs.add(rec, err)
+}
+
+// Write prints the summary as a table, one row for each function.
+func (s *Summary) Write(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "Function\tRequests\tCompleted\tDropped\tTimedOut\tFailed\tColdStarts\tDeadlinesMissed\tp50(ms)\tp90(ms)\tp95(ms)\tp99(ms)\t")
+
+	names := make([]string, 0, len(s.Functions))
+	for name := range s.Functions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	writeRow := func(name string, st *Stats) {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%.1f\t%.1f\t%.1f\t%.1f\t\n", name,
+			st.Requests, st.Completed, st.Dropped, st.TimedOut, st.Failed, st.ColdStarts, st.DeadlinesMissed,
+			st.Percentile(50)*1000, st.Percentile(90)*1000, st.Percentile(95)*1000, st.Percentile(99)*1000)
+	}
+	for _, name := range names {
+		writeRow(name, s.Functions[name])
+	}
+	writeRow("TOTAL", &s.Total)
+	return tw.Flush()
+}